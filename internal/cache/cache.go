@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/fileutil"
+)
+
+// Kinds of cached responses
+const (
+	KindGenerate = "generate"
+	KindExplain  = "explain"
+	KindReview   = "review"
+)
+
+// Entry is a cached provider response
+type Entry struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Kind      string          `json:"kind"`
+	Provider  string          `json:"provider"`
+	Model     string          `json:"model"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// Cache is a content-addressed store of provider responses. Each entry lives
+// in its own file named after the SHA-256 of its key.
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// Stats summarizes the contents of the cache
+type Stats struct {
+	Entries int
+	Expired int
+	Bytes   int64
+	ByKind  map[string]int
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// GetCachePath returns the path to the cache directory
+func GetCachePath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "cache"), nil
+}
+
+// Open opens the cache in the config directory with the given TTL
+func Open(ttl time.Duration) (*Cache, error) {
+	dir, err := GetCachePath()
+	if err != nil {
+		return nil, err
+	}
+	return New(dir, ttl), nil
+}
+
+// New creates a cache stored in dir with the given TTL
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, ttl: ttl}
+}
+
+// Key returns the content address for the given key parts
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// path returns the file path of an entry, sharded by the first two hex digits
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// Get returns the entry stored under key, or nil if there is none or it has expired
+func (c *Cache) Get(key string) (*Entry, error) {
+	data, err := os.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	entry := &Entry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		// A corrupt entry is as good as a missing one
+		os.Remove(c.path(key))
+		return nil, nil
+	}
+	if c.expired(entry) {
+		os.Remove(c.path(key))
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// Put stores a value under key
+func (c *Cache) Put(key, kind, provider, model string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache value: %w", err)
+	}
+
+	data, err := json.Marshal(Entry{
+		CreatedAt: time.Now(),
+		Kind:      kind,
+		Provider:  provider,
+		Model:     model,
+		Value:     raw,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	if err := fileutil.AtomicWriteFile(c.path(key), data, 0600); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Stats returns a summary of the cache contents
+func (c *Cache) Stats() (Stats, error) {
+	stats := Stats{ByKind: map[string]int{}}
+	err := c.walk(func(path string, info fs.FileInfo, entry *Entry) {
+		stats.Entries++
+		stats.Bytes += info.Size()
+		if entry == nil {
+			stats.Expired++
+			return
+		}
+		stats.ByKind[entry.Kind]++
+		if c.expired(entry) {
+			stats.Expired++
+		}
+		if stats.Oldest.IsZero() || entry.CreatedAt.Before(stats.Oldest) {
+			stats.Oldest = entry.CreatedAt
+		}
+		if entry.CreatedAt.After(stats.Newest) {
+			stats.Newest = entry.CreatedAt
+		}
+	})
+	return stats, err
+}
+
+// Prune removes expired and unreadable entries and returns how many were removed
+func (c *Cache) Prune() (int, error) {
+	removed := 0
+	err := c.walk(func(path string, info fs.FileInfo, entry *Entry) {
+		if entry == nil || c.expired(entry) {
+			if os.Remove(path) == nil {
+				removed++
+			}
+		}
+	})
+	return removed, err
+}
+
+// Clear removes all entries and returns how many were removed
+func (c *Cache) Clear() (int, error) {
+	removed := 0
+	err := c.walk(func(path string, info fs.FileInfo, entry *Entry) {
+		if os.Remove(path) == nil {
+			removed++
+		}
+	})
+	return removed, err
+}
+
+// expired reports whether an entry is older than the TTL
+func (c *Cache) expired(entry *Entry) bool {
+	return c.ttl > 0 && time.Since(entry.CreatedAt) > c.ttl
+}
+
+// walk calls fn for every entry file; entry is nil if the file cannot be parsed
+func (c *Cache) walk(fn func(path string, info fs.FileInfo, entry *Entry)) error {
+	err := filepath.Walk(c.dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		var entry *Entry
+		if data, err := os.ReadFile(path); err == nil {
+			entry = &Entry{}
+			if json.Unmarshal(data, entry) != nil {
+				entry = nil
+			}
+		}
+		fn(path, info, entry)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachePutGet(t *testing.T) {
+	c := New(t.TempDir(), time.Hour)
+	key := Key(KindExplain, "openai", "gpt-4o", "ls -la")
+
+	if entry, err := c.Get(key); err != nil || entry != nil {
+		t.Fatalf("Get on empty cache = %v, %v; expected nil, nil", entry, err)
+	}
+
+	if err := c.Put(key, KindExplain, "openai", "gpt-4o", "Lists files"); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+
+	entry, err := c.Get(key)
+	if err != nil || entry == nil {
+		t.Fatalf("Get = %v, %v; expected an entry", entry, err)
+	}
+	if string(entry.Value) != `"Lists files"` || entry.Provider != "openai" || entry.Kind != KindExplain {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestKeyIsUnambiguous(t *testing.T) {
+	if Key("ab", "c") == Key("a", "bc") {
+		t.Error("Key should separate its parts")
+	}
+	if Key("a", "b") != Key("a", "b") {
+		t.Error("Key should be deterministic")
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	dir := t.TempDir()
+	c := New(dir, time.Hour)
+
+	fresh, stale := Key("fresh"), Key("stale")
+	if err := c.Put(fresh, KindGenerate, "grok", "grok-3", []string{"ls"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(stale, KindGenerate, "grok", "grok-3", []string{"pwd"}); err != nil {
+		t.Fatal(err)
+	}
+	// Age the stale entry past the TTL by rewriting its timestamp
+	old := New(dir, 0)
+	entry, _ := old.Get(stale)
+	entry.CreatedAt = time.Now().Add(-2 * time.Hour)
+	writeEntry(t, c.path(stale), entry)
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || stats.Expired != 1 || stats.ByKind[KindGenerate] != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	removed, err := c.Prune()
+	if err != nil || removed != 1 {
+		t.Errorf("Prune = %d, %v; expected 1, nil", removed, err)
+	}
+	if entry, _ := c.Get(fresh); entry == nil {
+		t.Error("fresh entry should survive pruning")
+	}
+
+	removed, err = c.Clear()
+	if err != nil || removed != 1 {
+		t.Errorf("Clear = %d, %v; expected 1, nil", removed, err)
+	}
+}
+
+func TestCacheStatsMissingDir(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "missing"), time.Hour)
+	stats, err := c.Stats()
+	if err != nil || stats.Entries != 0 {
+		t.Errorf("Stats on missing dir = %+v, %v; expected empty, nil", stats, err)
+	}
+}
+
+func writeEntry(t *testing.T, path string, entry *Entry) {
+	t.Helper()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
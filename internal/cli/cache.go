@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Hermithic/aiask/internal/cache"
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the response cache",
+	Long: `Manage the on-disk cache of generated commands and explanations.
+
+Identical requests (same prompt, model, shell and directory context) are
+answered from the cache until the entry expires. Use --refresh to ask the
+provider again, or --no-cache to bypass the cache entirely.
+
+Examples:
+  aiask cache                # Show cache statistics
+  aiask cache stats          # Show cache statistics
+  aiask cache prune          # Remove expired entries
+  aiask cache clear          # Remove all entries`,
+	Run: runCacheStats,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show cache statistics",
+	Run:   runCacheStats,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached responses",
+	Run:   runCacheClear,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove expired cached responses",
+	Run:   runCachePrune,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+}
+
+// withCache wraps the provider with the response cache unless caching is
+// disabled. Recording and replaying cassettes bypass the cache so every
+// request reaches the provider.
+func withCache(provider llm.Provider, cfg *config.Config) llm.Provider {
+	if noCache || cfg.DisableCache || recordPath != "" || cfg.Provider == config.ProviderReplay {
+		return provider
+	}
+
+	c, err := cache.Open(cfg.GetCacheTTL())
+	if err != nil {
+		if verbose {
+			fmt.Printf("%s[DEBUG] Cache disabled: %s%s\n", ui.ColorDim, err, ui.ColorReset)
+		}
+		return provider
+	}
+	return llm.NewCachingProvider(provider, c, cfg, refreshCache)
+}
+
+// servedFromCache reports whether the provider's last response came from the cache
+func servedFromCache(provider llm.Provider) bool {
+	cp, ok := provider.(*llm.CachingProvider)
+	return ok && cp.CacheHit()
+}
+
+// openCache opens the cache with the configured TTL, using the default if there is no config
+func openCache() (*cache.Cache, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+	return cache.Open(cfg.GetCacheTTL())
+}
+
+func runCacheStats(cmd *cobra.Command, args []string) {
+	c, err := openCache()
+	if err != nil {
+		ui.ShowError(fmt.Errorf("failed to open cache: %w", err))
+		return
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		ui.ShowError(err)
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Header("Response Cache", 44))
+	fmt.Println()
+
+	if stats.Entries == 0 {
+		fmt.Println(ui.InfoMessage("The cache is empty."))
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("  %sEntries:%s   %s%d%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, stats.Entries, ui.ColorReset)
+
+	kinds := make([]string, 0, len(stats.ByKind))
+	for kind := range stats.ByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("  %s  %-9s%s %d\n", ui.ColorDim, kind+":", ui.ColorReset, stats.ByKind[kind])
+	}
+
+	fmt.Printf("  %sExpired:%s   %s%d%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, stats.Expired, ui.ColorReset)
+	fmt.Printf("  %sSize:%s      %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, formatBytes(stats.Bytes), ui.ColorReset)
+	if !stats.Oldest.IsZero() {
+		fmt.Printf("  %sOldest:%s    %s\n", ui.ColorDim, ui.ColorReset, formatRelativeTime(stats.Oldest))
+		fmt.Printf("  %sNewest:%s    %s\n", ui.ColorDim, ui.ColorReset, formatRelativeTime(stats.Newest))
+	}
+	fmt.Println()
+
+	if stats.Expired > 0 {
+		fmt.Printf("%sRun %saiask cache prune%s%s to remove expired entries.%s\n", ui.ColorDim, ui.ColorCyan, ui.ColorReset, ui.ColorDim, ui.ColorReset)
+		fmt.Println()
+	}
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) {
+	c, err := openCache()
+	if err != nil {
+		ui.ShowError(fmt.Errorf("failed to open cache: %w", err))
+		return
+	}
+
+	removed, err := c.Clear()
+	if err != nil {
+		ui.ShowError(err)
+		return
+	}
+	fmt.Println(ui.SuccessMessage(fmt.Sprintf("Removed %d cached responses.", removed)))
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) {
+	c, err := openCache()
+	if err != nil {
+		ui.ShowError(fmt.Errorf("failed to open cache: %w", err))
+		return
+	}
+
+	removed, err := c.Prune()
+	if err != nil {
+		ui.ShowError(err)
+		return
+	}
+	fmt.Println(ui.SuccessMessage(fmt.Sprintf("Removed %d expired cached responses.", removed)))
+}
+
+// formatBytes formats a byte count for display
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
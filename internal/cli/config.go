@@ -1,11 +1,16 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 
 	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/ollama"
+	"github.com/Hermithic/aiask/internal/transport"
 	"github.com/Hermithic/aiask/internal/ui"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
@@ -21,7 +26,21 @@ Supported providers:
   - openai    : OpenAI GPT - https://platform.openai.com/
   - anthropic : Anthropic Claude - https://console.anthropic.com/
   - gemini    : Google Gemini - https://ai.google.dev/
-  - ollama    : Ollama (local) - https://ollama.ai/`,
+  - ollama    : Ollama (local) - https://ollama.ai/
+  - azure     : Azure OpenAI - https://portal.azure.com/
+  - openai-compatible : Any OpenAI-compatible server (LM Studio, vLLM,
+                        llama.cpp server, LiteLLM, internal gateways)
+
+Extra HTTP headers, organization and project IDs for OpenAI-compatible
+endpoints can be set in the config file:
+
+  provider: openai-compatible
+  base_url: https://llm-gateway.internal/v1
+  model: llama-3.1-70b
+  headers:
+    X-Team: platform
+  organization: org-123
+  project: proj-456`,
 	Run: runConfig,
 }
 
@@ -31,6 +50,7 @@ type providerOption struct {
 	Description string
 	URL         string
 	NeedsAPIKey bool
+	OptionalKey bool // The API key may be left empty
 	Icon        string
 }
 
@@ -52,6 +72,8 @@ func runConfig(cmd *cobra.Command, args []string) {
 		{Name: "anthropic", Description: "Anthropic Claude", URL: "https://console.anthropic.com/", NeedsAPIKey: true, Icon: "🧠"},
 		{Name: "gemini", Description: "Google Gemini", URL: "https://ai.google.dev/", NeedsAPIKey: true, Icon: "✨"},
 		{Name: "ollama", Description: "Ollama (local)", URL: "https://ollama.ai/", NeedsAPIKey: false, Icon: "🏠"},
+		{Name: "azure", Description: "Azure OpenAI", URL: "https://portal.azure.com/", NeedsAPIKey: true, Icon: "☁️"},
+		{Name: "openai-compatible", Description: "OpenAI-compatible server (LM Studio, vLLM, LiteLLM...)", URL: "https://platform.openai.com/docs/api-reference/chat", OptionalKey: true, Icon: "🔌"},
 	}
 
 	// Find current provider index
@@ -71,7 +93,7 @@ func runConfig(cmd *cobra.Command, args []string) {
 		Details: `
 {{ "────────────────────────────────────────────" | faint }}
 {{ "Provider:" | faint }}  {{ .Name }}
-{{ "API Key:" | faint }}   {{ if .NeedsAPIKey }}Required{{ else }}Not needed (local){{ end }}
+{{ "API Key:" | faint }}   {{ if .NeedsAPIKey }}Required{{ else if .OptionalKey }}Optional{{ else }}Not needed (local){{ end }}
 {{ "Website:" | faint }}   {{ .URL | faint }}`,
 	}
 
@@ -79,7 +101,7 @@ func runConfig(cmd *cobra.Command, args []string) {
 		Label:     fmt.Sprintf("%sSelect your LLM provider%s", ui.ColorBold, ui.ColorReset),
 		Items:     providers,
 		Templates: templates,
-		Size:      5,
+		Size:      len(providers),
 		CursorPos: currentIdx,
 	}
 
@@ -102,17 +124,91 @@ func runConfig(cmd *cobra.Command, args []string) {
 		Timeout:            existingCfg.Timeout,
 		SystemPromptSuffix: existingCfg.SystemPromptSuffix,
 		CheckUpdates:       existingCfg.CheckUpdates,
+		ConversationTurns:  existingCfg.ConversationTurns,
+		CacheTTL:           existingCfg.CacheTTL,
+		DisableCache:       existingCfg.DisableCache,
+		Review:             existingCfg.Review,
+		ContextBudget:      existingCfg.ContextBudget,
+		Retry:              existingCfg.Retry,
+		Fallbacks:          existingCfg.Fallbacks,
+		Prices:             existingCfg.Prices,
+		Ollama:             existingCfg.Ollama,
+		Tools:              existingCfg.Tools,
+		Network:            existingCfg.Network,
+		Trace:              existingCfg.Trace,
+		Scrub:              existingCfg.Scrub,
 	}
 
-	// API Key (not needed for Ollama)
-	if providers[idx].NeedsAPIKey {
+	// Endpoint settings only carry over when the provider is unchanged, since
+	// base_url also overrides the grok and openai URLs
+	sameProvider := existingCfg.Provider == selectedProvider
+	if sameProvider {
+		cfg.BaseURL = existingCfg.BaseURL
+		cfg.Headers = existingCfg.Headers
+		cfg.Organization = existingCfg.Organization
+		cfg.Project = existingCfg.Project
+		cfg.APIVersion = existingCfg.APIVersion
+		switch selectedProvider {
+		case config.ProviderOpenAICompatible:
+			cfg.Model = existingCfg.Model
+		case config.ProviderAzure:
+			cfg.Model = existingCfg.GetDeployment()
+		}
+	}
+
+	// Base URL (only for OpenAI-compatible servers and Azure)
+	if selectedProvider == config.ProviderOpenAICompatible || selectedProvider == config.ProviderAzure {
+		fmt.Println()
+
+		label, defaultURL := "Base URL", "http://localhost:1234/v1"
+		if selectedProvider == config.ProviderAzure {
+			label, defaultURL = "Azure OpenAI endpoint (https://<resource>.openai.azure.com)", ""
+		}
+		if cfg.BaseURL != "" {
+			defaultURL = cfg.BaseURL
+		}
+
+		baseURLPrompt := promptui.Prompt{
+			Label:   label,
+			Default: defaultURL,
+			Templates: &promptui.PromptTemplates{
+				Prompt:  fmt.Sprintf("%s{{ . }}:%s ", ui.ColorCyan, ui.ColorReset),
+				Valid:   fmt.Sprintf("%s{{ . }}:%s ", ui.ColorGreen, ui.ColorReset),
+				Invalid: fmt.Sprintf("%s{{ . }}:%s ", ui.ColorRed, ui.ColorReset),
+				Success: fmt.Sprintf("%s%s {{ . }}:%s ", ui.ColorGreen, ui.IconCheck, ui.ColorReset),
+			},
+		}
+
+		baseURL, err := baseURLPrompt.Run()
+		if err != nil {
+			if err == promptui.ErrInterrupt {
+				fmt.Println("\nConfiguration cancelled.")
+				return
+			}
+		}
+
+		if strings.TrimSpace(baseURL) != "" {
+			cfg.BaseURL = strings.TrimSpace(baseURL)
+		} else {
+			cfg.BaseURL = defaultURL
+		}
+		if cfg.BaseURL == "" {
+			ui.ShowError(fmt.Errorf("an endpoint is required for the %s provider", selectedProvider))
+			return
+		}
+	}
+
+	// API Key (not needed for Ollama, optional for OpenAI-compatible servers)
+	if providers[idx].NeedsAPIKey || providers[idx].OptionalKey {
 		fmt.Println()
 
-		hasExistingKey := existingCfg.APIKey != "" && existingCfg.Provider == selectedProvider
+		hasExistingKey := existingCfg.APIKey != "" && sameProvider
 		defaultText := ""
 		if hasExistingKey {
 			maskedKey := maskAPIKey(existingCfg.APIKey)
 			defaultText = fmt.Sprintf(" (current: %s)", maskedKey)
+		} else if providers[idx].OptionalKey {
+			defaultText = " (optional)"
 		}
 
 		apiKeyPrompt := promptui.Prompt{
@@ -138,18 +234,83 @@ func runConfig(cmd *cobra.Command, args []string) {
 		if apiKey == "" && hasExistingKey {
 			cfg.APIKey = existingCfg.APIKey
 			fmt.Printf("%sUsing existing API key.%s\n", ui.ColorDim, ui.ColorReset)
-		} else if apiKey == "" {
+		} else if apiKey == "" && providers[idx].NeedsAPIKey {
 			fmt.Println(ui.WarningMessage("No API key provided. You'll need to set it later."))
 		} else {
 			cfg.APIKey = apiKey
 		}
 	}
 
-	// Model selection
+	// Ollama URL (only for Ollama)
+	if selectedProvider == config.ProviderOllama {
+		fmt.Println()
+
+		defaultURL := config.DefaultConfig().OllamaURL
+		if existingCfg.OllamaURL != "" {
+			defaultURL = existingCfg.OllamaURL
+		}
+
+		ollamaPrompt := promptui.Prompt{
+			Label:   "Ollama server URL",
+			Default: defaultURL,
+			Templates: &promptui.PromptTemplates{
+				Prompt:  fmt.Sprintf("%s{{ . }}:%s ", ui.ColorCyan, ui.ColorReset),
+				Valid:   fmt.Sprintf("%s{{ . }}:%s ", ui.ColorGreen, ui.ColorReset),
+				Invalid: fmt.Sprintf("%s{{ . }}:%s ", ui.ColorRed, ui.ColorReset),
+				Success: fmt.Sprintf("%s%s {{ . }}:%s ", ui.ColorGreen, ui.IconCheck, ui.ColorReset),
+			},
+		}
+
+		ollamaURL, err := ollamaPrompt.Run()
+		if err != nil {
+			if err == promptui.ErrInterrupt {
+				fmt.Println("\nConfiguration cancelled.")
+				return
+			}
+		}
+
+		if strings.TrimSpace(ollamaURL) != "" {
+			cfg.OllamaURL = ollamaURL
+		} else {
+			cfg.OllamaURL = defaultURL
+		}
+	}
+
+	// Model selection; Azure routes requests by deployment instead
 	fmt.Println()
 
+	modelLabel := "Model name"
+	if selectedProvider == config.ProviderAzure {
+		modelLabel = "Deployment name"
+	}
+
+	// Pick from the provider's models when they can be listed
+	var listedModels []llm.ModelInfo
+	modelsListed := false
+	modelChosen := false
+	if selectedProvider == config.ProviderOllama && sameProvider && existingCfg.Model != "" {
+		cfg.Model = existingCfg.Model
+	}
+	if selectedProvider != config.ProviderAzure {
+		listedModels, err = listModels(cfg, modelsListTimeout)
+		if err != nil {
+			fmt.Println(ui.WarningMessage(fmt.Sprintf("Could not list models: %s", err)))
+		} else if len(listedModels) > 0 {
+			modelsListed = true
+			model, err := selectModel(listedModels, cfg.Model, selectedProvider)
+			if err == promptui.ErrInterrupt {
+				fmt.Println("\nConfiguration cancelled.")
+				return
+			}
+			if err == nil && model != "" {
+				cfg.Model = model
+				modelChosen = true
+			}
+		}
+	}
+
 	modelPrompt := promptui.Prompt{
-		Label:   "Model name",
+		Label:   modelLabel,
 		Default: cfg.Model,
 		Templates: &promptui.PromptTemplates{
 			Prompt:  fmt.Sprintf("%s{{ . }}:%s ", ui.ColorCyan, ui.ColorReset),
@@ -159,30 +320,57 @@ func runConfig(cmd *cobra.Command, args []string) {
 		},
 	}
 
-	modelInput, err := modelPrompt.Run()
-	if err != nil {
-		if err == promptui.ErrInterrupt {
-			fmt.Println("\nConfiguration cancelled.")
-			return
+	if !modelChosen {
+		modelInput, err := modelPrompt.Run()
+		if err != nil {
+			if err == promptui.ErrInterrupt {
+				fmt.Println("\nConfiguration cancelled.")
+				return
+			}
 		}
-	}
 
-	if strings.TrimSpace(modelInput) != "" {
-		cfg.Model = modelInput
+		if strings.TrimSpace(modelInput) != "" {
+			cfg.Model = strings.TrimSpace(modelInput)
+		}
+	}
+	if strings.TrimSpace(cfg.Model) == "" {
+		ui.ShowError(fmt.Errorf("a %s is required for the %s provider", strings.ToLower(modelLabel), selectedProvider))
+		return
 	}
 
-	// Ollama URL (only for Ollama)
-	if selectedProvider == config.ProviderOllama {
+	// Offer to pull an Ollama model that isn't installed yet
+	if selectedProvider == config.ProviderOllama && modelsListed && !llm.HasModel(listedModels, cfg.Model) {
 		fmt.Println()
 
-		defaultURL := config.DefaultConfig().OllamaURL
-		if existingCfg.OllamaURL != "" {
-			defaultURL = existingCfg.OllamaURL
+		pullPrompt := promptui.Prompt{
+			Label:     fmt.Sprintf("%s is not installed. Pull it now", cfg.Model),
+			IsConfirm: true,
+		}
+		if _, err := pullPrompt.Run(); err == nil {
+			// The pull goes through the same proxy and certificates as provider requests
+			base, err := transport.Shared(cfg.Network)
+			if err != nil {
+				err = fmt.Errorf("invalid network settings: %w", err)
+			} else {
+				err = pullOllamaModel(ollama.New(cfg.GetOllamaURL(), &http.Client{Transport: base}), cfg.Model)
+			}
+			if err != nil {
+				ui.ShowError(err)
+				fmt.Println(ui.WarningMessage(fmt.Sprintf("Run 'ollama pull %s' before using aiask.", cfg.Model)))
+			}
+		} else if err == promptui.ErrInterrupt {
+			fmt.Println("\nConfiguration cancelled.")
+			return
 		}
+	}
 
-		ollamaPrompt := promptui.Prompt{
-			Label:   "Ollama server URL",
-			Default: defaultURL,
+	// API version (only for Azure)
+	if selectedProvider == config.ProviderAzure {
+		fmt.Println()
+
+		apiVersionPrompt := promptui.Prompt{
+			Label:   "API version",
+			Default: cfg.GetAPIVersion(),
 			Templates: &promptui.PromptTemplates{
 				Prompt:  fmt.Sprintf("%s{{ . }}:%s ", ui.ColorCyan, ui.ColorReset),
 				Valid:   fmt.Sprintf("%s{{ . }}:%s ", ui.ColorGreen, ui.ColorReset),
@@ -191,7 +379,7 @@ func runConfig(cmd *cobra.Command, args []string) {
 			},
 		}
 
-		ollamaURL, err := ollamaPrompt.Run()
+		apiVersion, err := apiVersionPrompt.Run()
 		if err != nil {
 			if err == promptui.ErrInterrupt {
 				fmt.Println("\nConfiguration cancelled.")
@@ -199,10 +387,8 @@ func runConfig(cmd *cobra.Command, args []string) {
 			}
 		}
 
-		if strings.TrimSpace(ollamaURL) != "" {
-			cfg.OllamaURL = ollamaURL
-		} else {
-			cfg.OllamaURL = defaultURL
+		if strings.TrimSpace(apiVersion) != "" {
+			cfg.APIVersion = strings.TrimSpace(apiVersion)
 		}
 	}
 
@@ -218,6 +404,12 @@ func runConfig(cmd *cobra.Command, args []string) {
 	if selectedProvider == config.ProviderOllama {
 		fmt.Printf("  URL:      %s%s%s\n", ui.ColorCyan, cfg.OllamaURL, ui.ColorReset)
 	}
+	if selectedProvider == config.ProviderOpenAICompatible || selectedProvider == config.ProviderAzure {
+		fmt.Printf("  URL:      %s%s%s\n", ui.ColorCyan, cfg.BaseURL, ui.ColorReset)
+	}
+	if selectedProvider == config.ProviderAzure {
+		fmt.Printf("  Version:  %s%s%s\n", ui.ColorCyan, cfg.GetAPIVersion(), ui.ColorReset)
+	}
 	fmt.Println(ui.Divider(44))
 	fmt.Println()
 
@@ -258,3 +450,74 @@ func maskAPIKey(key string) string {
 	}
 	return key[:4] + strings.Repeat("*", len(key)-8) + key[len(key)-4:]
 }
+
+// modelOption is a listed model, or the entry for typing a model name, in the model menu
+type modelOption struct {
+	Name    string
+	Details string
+}
+
+// selectModel lets the user pick one of the provider's models, searching with
+// "/" when the list is long. It returns an empty name if the user wants to
+// enter another model.
+func selectModel(models []llm.ModelInfo, current string, provider config.Provider) (string, error) {
+	options := make([]modelOption, 0, len(models)+1)
+	cursor := 0
+	for _, m := range models {
+		if llm.HasModel([]llm.ModelInfo{m}, current) {
+			cursor = len(options)
+		}
+		options = append(options, modelOption{Name: m.ID, Details: describeModel(m)})
+	}
+	other := modelOption{Name: "Other...", Details: "enter a model name"}
+	if provider == config.ProviderOllama {
+		other.Details = "enter a model to pull"
+	}
+	options = append(options, other)
+
+	label := "Select a model"
+	if provider == config.ProviderOllama {
+		label = "Select an installed model"
+	}
+	modelSelect := promptui.Select{
+		Label: fmt.Sprintf("%s%s%s", ui.ColorBold, label, ui.ColorReset),
+		Items: options,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}",
+			Active:   fmt.Sprintf("%s%s {{ .Name | cyan | bold }}%s {{ .Details | faint }}", ui.ColorCyan, ui.IconArrow, ui.ColorReset),
+			Inactive: "  {{ .Name }} {{ .Details | faint }}",
+			Selected: fmt.Sprintf("%s%s {{ .Name }}%s", ui.ColorGreen, ui.IconCheck, ui.ColorReset),
+		},
+		Size:      10,
+		CursorPos: cursor,
+		Searcher: func(input string, index int) bool {
+			return strings.Contains(strings.ToLower(options[index].Name), strings.ToLower(input))
+		},
+	}
+
+	idx, _, err := modelSelect.Run()
+	if err != nil {
+		return "", err
+	}
+	if idx == len(options)-1 {
+		return "", nil
+	}
+	return options[idx].Name, nil
+}
+
+// pullOllamaModel downloads a model, showing the progress of each layer
+func pullOllamaModel(client *ollama.Client, model string) error {
+	err := client.Pull(context.Background(), model, func(p ollama.PullProgress) {
+		line := p.Status
+		if p.Total > 0 {
+			line = fmt.Sprintf("%s  %3d%% (%s / %s)", p.Status, p.Completed*100/p.Total, formatBytes(p.Completed), formatBytes(p.Total))
+		}
+		fmt.Printf("\r\033[K  %s%s%s", ui.ColorDim, truncateString(line, 70), ui.ColorReset)
+	})
+	fmt.Print("\r\033[K")
+	if err != nil {
+		return err
+	}
+	fmt.Println(ui.SuccessMessage(fmt.Sprintf("Pulled %s.", model)))
+	return nil
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/safety"
+	"github.com/Hermithic/aiask/internal/ui"
+)
+
+// newConsensusProvider creates the provider for --consensus, which asks the
+// main provider and each fallback
+func newConsensusProvider(cfg *config.Config) (llm.Provider, error) {
+	if recordPath != "" {
+		return nil, fmt.Errorf("--record can't be combined with --consensus")
+	}
+
+	cp, err := llm.NewConsensusProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		var names []string
+		names = append(names, fmt.Sprintf("%s (%s)", cfg.Provider, cfg.Model))
+		for _, fb := range cfg.Fallbacks {
+			names = append(names, fmt.Sprintf("%s (%s)", fb.Provider, cfg.WithProvider(fb).Model))
+		}
+		fmt.Printf("%s[DEBUG] Consensus of: %s%s\n", ui.ColorDim, strings.Join(names, ", "), ui.ColorReset)
+		if streaming || alternatives > 1 || probingEnabled(cfg) {
+			fmt.Printf("%s[DEBUG] Streaming, alternatives and probing are not used in consensus mode%s\n", ui.ColorDim, ui.ColorReset)
+		}
+	}
+	return cp, nil
+}
+
+// jsonConsensus converts the answers of a consensus request to JSON output
+func jsonConsensus(consensus *llm.Consensus) *JSONConsensus {
+	out := &JSONConsensus{Agreed: consensus.Agreed()}
+	for _, a := range consensus.Answers {
+		answer := JSONConsensusAnswer{
+			Provider:  string(a.Provider),
+			Model:     a.Model,
+			LatencyMs: a.Latency.Milliseconds(),
+		}
+		if a.Err != nil {
+			answer.Error = a.Err.Error()
+		} else {
+			answer.Command = a.Result.Command()
+			answer.Safety = strings.ToLower(safety.GetLevelName(safety.Analyze(answer.Command).Level))
+		}
+		out.Answers = append(out.Answers, answer)
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Hermithic/aiask/internal/doctor"
+	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var doctorSkipRequest bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the setup and diagnose problems",
+	Long: `Check the setup and print a report with hints for anything that fails:
+
+  - the config file parses, and which environment variables override it
+  - which shell commands are generated for, and its binary
+  - whether commands can be copied to the clipboard
+  - each provider's host is reachable, the API key and model work, and how
+    long a request takes (one small request per provider)
+  - the history and templates files can be written
+
+Exits with status 1 if any check fails. Attach the --json output to bug
+reports; API keys are masked.
+
+Examples:
+  aiask doctor                    # Run all checks
+  aiask doctor --skip-request     # Don't send test requests to the providers
+  aiask doctor --json             # Report for a bug report`,
+	Args: cobra.NoArgs,
+	Run:  runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorSkipRequest, "skip-request", false, "Don't send test requests to the providers")
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	opts := doctor.Options{
+		Version:      Version,
+		Config:       cfg,
+		ConfigErr:    err,
+		SkipRequests: doctorSkipRequest,
+	}
+
+	if !jsonOutput {
+		fmt.Println()
+		fmt.Println(ui.Header("AIask Doctor", 64))
+		fmt.Println()
+		opts.OnCheck = printCheck
+	}
+
+	report := doctor.Run(context.Background(), opts)
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Println()
+		fmt.Printf("%d passed, %d warnings, %d failed\n",
+			report.Count(doctor.Pass), report.Count(doctor.Warn), report.Count(doctor.Fail))
+		fmt.Println()
+	}
+
+	if report.Count(doctor.Fail) > 0 {
+		os.Exit(1)
+	}
+}
+
+// printCheck prints a check result and its hint
+func printCheck(c doctor.Check) {
+	icon := ui.ColorGreen + ui.IconCheck
+	switch c.Status {
+	case doctor.Warn:
+		icon = ui.ColorYellow + ui.IconWarning
+	case doctor.Fail:
+		icon = ui.ColorRed + ui.IconCross
+	}
+	fmt.Printf("  %s%s %-28s %s\n", icon, ui.ColorReset, c.Name, c.Detail)
+	if c.Hint != "" && c.Status != doctor.Pass {
+		fmt.Printf("    %s%s %s%s\n", ui.ColorDim, ui.IconArrow, c.Hint, ui.ColorReset)
+	}
+}
@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/docs"
+	"github.com/Hermithic/aiask/internal/interrupt"
 	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/probe"
+	"github.com/Hermithic/aiask/internal/shell"
 	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/Hermithic/aiask/internal/usage"
 	"github.com/spf13/cobra"
 )
 
@@ -17,6 +22,10 @@ var explainCmd = &cobra.Command{
 	Short: "Explain what a command does",
 	Long: `Explain what a shell command does in plain English.
 
+The man pages (or --help output) of the programs in the command are looked
+up locally and sent along, so the explanation matches the installed
+versions. The flags found in the local docs are listed afterwards.
+
 Examples:
   aiask explain "tar -xzvf archive.tar.gz"
   aiask explain "find . -name '*.log' -mtime +7 -delete"
@@ -33,7 +42,7 @@ func runExplain(cmd *cobra.Command, args []string) {
 	command := strings.Join(args, " ")
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		ui.ShowError(fmt.Errorf("configuration error: %w", err))
 		fmt.Println("Run 'aiask config' to set up your configuration.")
@@ -46,40 +55,95 @@ func runExplain(cmd *cobra.Command, args []string) {
 		ui.ShowError(fmt.Errorf("failed to create LLM provider: %w", err))
 		os.Exit(1)
 	}
+	reportFailovers(provider)
+	provider = withCache(provider, cfg)
+	if provider, err = withRecording(provider, cfg); err != nil {
+		ui.ShowError(err)
+		os.Exit(1)
+	}
 	defer llm.CloseProvider(provider)
 
 	if verbose {
 		fmt.Printf("%s[DEBUG] Command to explain: %s%s\n", ui.ColorDim, command, ui.ColorReset)
 	}
 
-	fmt.Printf("\n%sAnalyzing command...%s\n\n", ui.ColorDim, ui.ColorReset)
-
 	// Generate explanation
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.GetTimeout())
+	ctx, cancel := interrupt.WithTimeout(context.Background(), cfg.GetTimeout())
 	defer cancel()
+	ctx, tokens := llm.WithUsage(ctx)
+	ctx, masked := llm.WithScrubReport(ctx)
+
+	// Ground the explanation in the local documentation of each program
+	refs := docs.Lookup(ctx, command, probe.HelpCommands(cfg))
+	req := llm.ExplainRequest{Command: command, ShellInfo: shell.Detect(), Reference: docs.Format(refs, docs.DefaultBudget)}
+	if verbose {
+		for _, ref := range refs {
+			fmt.Printf("%s[DEBUG] Reference: %s (%d bytes)%s\n", ui.ColorDim, ref.Source, len(ref.Text), ui.ColorReset)
+		}
+	}
 
-	explanation, err := provider.ExplainCommand(ctx, command)
+	startTime := time.Now()
+	if streaming && llm.SupportsExplainStreaming(provider) {
+		err = streamExplanation(ctx, provider, req)
+	} else {
+		fmt.Printf("\n%sAnalyzing command...%s\n\n", ui.ColorDim, ui.ColorReset)
+
+		var explanation string
+		if explanation, err = provider.ExplainCommand(ctx, req); err == nil {
+			printExplanationHeader(command)
+			ui.RenderMarkdown(os.Stdout, explanation, "  ")
+			fmt.Println()
+		}
+	}
 	if err != nil {
+		if interrupt.Interrupted(ctx) {
+			fmt.Println(ui.WarningMessage("Cancelled."))
+			cancel()
+			llm.CloseProvider(provider)
+			os.Exit(interrupt.ExitCode)
+		}
 		ui.ShowError(fmt.Errorf("failed to explain command: %w", err))
 		return
 	}
+	printReferenceNotes(refs)
+	ui.ShowMasked(masked)
+	recordUsage(usage.TypeExplain, provider, cfg, tokens, time.Since(startTime))
 
-	// Display the command
-	fmt.Printf("%s%sCommand:%s\n", ui.ColorBold, ui.ColorCyan, ui.ColorReset)
-	fmt.Printf("  %s%s%s\n\n", ui.ColorGreen, command, ui.ColorReset)
-
-	// Display the explanation
-	fmt.Printf("%s%sExplanation:%s\n", ui.ColorBold, ui.ColorCyan, ui.ColorReset)
-	
-	// Format the explanation with proper indentation
-	lines := strings.Split(explanation, "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" {
-			fmt.Printf("  %s\n", line)
-		} else {
-			fmt.Println()
+	if verbose {
+		answeredProvider, answeredModel := llm.AnsweredBy(provider, cfg)
+		fmt.Printf("%s[DEBUG] Answered by: %s (%s)%s\n", ui.ColorDim, answeredProvider, answeredModel, ui.ColorReset)
+		if servedFromCache(provider) {
+			fmt.Printf("%s[DEBUG] Served from cache%s\n", ui.ColorDim, ui.ColorReset)
 		}
 	}
+}
+
+// streamExplanation prints the explanation of a command as it is generated
+func streamExplanation(ctx context.Context, provider llm.Provider, req llm.ExplainRequest) error {
+	fmt.Println()
+	printExplanationHeader(req.Command)
+
+	renderer := ui.NewMarkdownRenderer(os.Stdout, "  ")
+	_, err := provider.(llm.ExplainStreamingProvider).ExplainCommandStream(ctx, req, renderer.Write)
+	renderer.Flush()
 	fmt.Println()
+	return err
 }
 
+// printExplanationHeader prints the command being explained and the explanation heading
+func printExplanationHeader(command string) {
+	fmt.Printf("%s%sCommand:%s\n", ui.ColorBold, ui.ColorCyan, ui.ColorReset)
+	fmt.Printf("  %s%s%s\n\n", ui.ColorGreen, command, ui.ColorReset)
+	fmt.Printf("%s%sExplanation:%s\n", ui.ColorBold, ui.ColorCyan, ui.ColorReset)
+}
+
+// printReferenceNotes lists the local documentation the explanation was
+// checked against
+func printReferenceNotes(refs []docs.Reference) {
+	for _, ref := range refs {
+		fmt.Printf("%s  ℹ %s%s\n", ui.ColorDim, ref.Note(), ui.ColorReset)
+	}
+	if len(refs) > 0 {
+		fmt.Println()
+	}
+}
@@ -19,9 +19,20 @@ var interactiveCmd = &cobra.Command{
 	Long: `Start an interactive REPL (Read-Eval-Print Loop) mode for continuous
 interaction with AIask without restarting.
 
+Follow-up requests remember the previous prompts and commands of the session,
+so "now do the same for .js files" works. The number of remembered turns can
+be set with conversation_turns in the config file.
+
 Commands available in REPL:
   /help     - Show available commands
   /history  - Show session history
+  /reset    - Forget the conversation and start fresh
+  /alt [n]  - Toggle alternative commands (or set how many, "off" to disable)
+  /explain  - Explain a command, or the last one generated
+  /probe    - Toggle read-only tools the model uses to inspect the system
+  /review   - Toggle the review of generated commands in a second pass
+  /provider - Show or switch the provider for the rest of the session
+  /model    - List the provider's models, or switch model
   /clear    - Clear the screen
   /config   - Show current configuration
   /exit     - Exit interactive mode`,
@@ -34,7 +45,7 @@ func init() {
 
 func runInteractive(cmd *cobra.Command, args []string) {
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		fmt.Printf("Configuration error: %s\n", err)
 		fmt.Println("Run 'aiask config' to set up your configuration.")
@@ -44,16 +55,27 @@ func runInteractive(cmd *cobra.Command, args []string) {
 	// Detect shell
 	shellInfo := shell.Detect()
 
-	// Create LLM provider
-	provider, err := llm.NewProvider(cfg)
+	// Create LLM provider; /provider and /model create new ones the same way
+	newProvider := func(cfg *config.Config) (llm.Provider, error) {
+		provider, err := llm.NewProvider(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create LLM provider: %w", err)
+		}
+		reportFailovers(provider)
+		return withRecording(provider, cfg)
+	}
+	provider, err := newProvider(cfg)
 	if err != nil {
-		ui.ShowError(fmt.Errorf("failed to create LLM provider: %w", err))
+		ui.ShowError(err)
 		os.Exit(1)
 	}
-	defer llm.CloseProvider(provider)
 
 	// Start REPL
 	r := repl.New(cfg, provider, shellInfo)
+	defer r.Close()
+	r.SetProviderFactory(newProvider)
+	r.SetAlternatives(alternatives)
+	r.SetTools(newToolbox(cfg), probingEnabled(cfg))
+	r.SetReview(reviewEnabled(cfg))
 	r.Run()
 }
-
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// modelsListTimeout bounds how long listing models may take in the config wizard
+const modelsListTimeout = 10 * time.Second
+
+var modelsForce bool
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List the models of the configured provider",
+	Long: `List the models offered by the configured provider, with their context
+size where the provider reports it.
+
+Models are read from the provider's model list: /models for OpenAI-compatible
+servers (OpenAI, Grok, LM Studio, vLLM...), the Anthropic and Gemini model
+APIs, and the installed models of the Ollama server. Azure routes requests by
+deployment name, so its deployments can't be listed.
+
+Examples:
+  aiask models                       # List the available models
+  aiask models use gpt-4o-mini       # Save the model to use
+  aiask models --json                # Machine-readable list`,
+	Args: cobra.NoArgs,
+	Run:  runModels,
+}
+
+var modelsUseCmd = &cobra.Command{
+	Use:   "use <model>",
+	Short: "Save the model to use",
+	Long: `Save the model to use in the config file. The model must be one the
+provider lists, unless --force is given.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runModelsUse,
+}
+
+func init() {
+	modelsUseCmd.Flags().BoolVar(&modelsForce, "force", false, "Save the model even if the provider doesn't list it")
+	modelsCmd.AddCommand(modelsUseCmd)
+}
+
+// listModels lists the models of the configured provider
+func listModels(cfg *config.Config, timeout time.Duration) ([]llm.ModelInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return llm.ListModels(ctx, cfg)
+}
+
+func runModels(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		ui.ShowError(fmt.Errorf("configuration error: %w", err))
+		fmt.Println("Run 'aiask config' to set up your configuration.")
+		os.Exit(1)
+	}
+
+	models, err := listModels(cfg, cfg.GetTimeout())
+	if err != nil {
+		ui.ShowError(err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		if models == nil {
+			models = []llm.ModelInfo{}
+		}
+		data, _ := json.MarshalIndent(models, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Header(fmt.Sprintf("Models: %s", cfg.Provider), 64))
+	fmt.Println()
+
+	if len(models) == 0 {
+		fmt.Println(ui.InfoMessage("The provider lists no models."))
+		fmt.Println()
+		return
+	}
+
+	for _, m := range models {
+		marker := "  "
+		if llm.HasModel([]llm.ModelInfo{m}, cfg.Model) {
+			marker = ui.ColorGreen + ui.IconCheck + ui.ColorReset + " "
+		}
+		fmt.Printf("%s%s%-40s%s %s%s%s\n", marker, ui.ColorCyan, m.ID, ui.ColorReset, ui.ColorDim, describeModel(m), ui.ColorReset)
+	}
+	fmt.Println()
+	fmt.Printf("%sCurrent model: %s. Switch with 'aiask models use <model>'.%s\n", ui.ColorDim, cfg.Model, ui.ColorReset)
+	fmt.Println()
+}
+
+func runModelsUse(cmd *cobra.Command, args []string) {
+	model := args[0]
+
+	cfg, err := loadConfig()
+	if err != nil {
+		ui.ShowError(fmt.Errorf("configuration error: %w", err))
+		fmt.Println("Run 'aiask config' to set up your configuration.")
+		os.Exit(1)
+	}
+
+	// The config file is changed without the environment overrides, so they
+	// aren't saved with it
+	fileCfg, err := config.LoadFile()
+	if os.IsNotExist(err) {
+		ui.ShowError(fmt.Errorf("no config file to save the model in; run 'aiask config' first, or set %s", config.EnvModel))
+		os.Exit(1)
+	}
+	if err != nil {
+		ui.ShowError(err)
+		os.Exit(1)
+	}
+	if fileCfg.Provider != cfg.Provider {
+		ui.ShowError(fmt.Errorf("the %s provider is selected with %s or --provider, but the config file uses %s", cfg.Provider, config.EnvProvider, fileCfg.Provider))
+		os.Exit(1)
+	}
+
+	if !modelsForce {
+		models, err := listModels(cfg, cfg.GetTimeout())
+		if err != nil {
+			fmt.Println(ui.WarningMessage(fmt.Sprintf("Could not check the model: %s", err)))
+		} else if !llm.HasModel(models, model) {
+			hint := "run 'aiask models' to see them"
+			if cfg.Provider == config.ProviderOllama {
+				hint = fmt.Sprintf("pull it with 'ollama pull %s'", model)
+			}
+			ui.ShowError(fmt.Errorf("%s doesn't list %s; %s, or use --force to save it anyway", cfg.Provider, model, hint))
+			os.Exit(1)
+		}
+	}
+
+	fileCfg.Model = model
+	if fileCfg.Deployment != "" {
+		fileCfg.Deployment = model
+	}
+	if err := config.Save(fileCfg); err != nil {
+		ui.ShowError(fmt.Errorf("error saving configuration: %w", err))
+		os.Exit(1)
+	}
+
+	fmt.Println(ui.SuccessMessage(fmt.Sprintf("Now using %s.", model)))
+	if os.Getenv(config.EnvModel) != "" {
+		fmt.Println(ui.WarningMessage(fmt.Sprintf("%s is set and overrides the saved model.", config.EnvModel)))
+	}
+}
+
+// describeModel summarizes what is known about a model, e.g.
+// "128K context, 8K output · Gemini 2.0 Flash"
+func describeModel(m llm.ModelInfo) string {
+	var parts []string
+	if m.ContextWindow > 0 {
+		parts = append(parts, formatTokens(m.ContextWindow)+" context")
+	}
+	if m.MaxOutput > 0 {
+		parts = append(parts, formatTokens(m.MaxOutput)+" output")
+	}
+	if m.Size > 0 {
+		parts = append(parts, formatBytes(m.Size))
+	}
+
+	description := strings.Join(parts, ", ")
+	for _, extra := range []string{m.Details, m.DisplayName} {
+		if extra == "" || extra == m.ID {
+			continue
+		}
+		if description != "" {
+			description += " · "
+		}
+		description += extra
+	}
+	return description
+}
+
+// formatTokens formats a token count, e.g. 131072 as "128K" and 200000 as "200K"
+func formatTokens(n int) string {
+	base := 1000
+	if n%1024 == 0 {
+		base = 1024
+	}
+	switch {
+	case n >= base*base:
+		return fmt.Sprintf("%gM", float64(n)/float64(base*base))
+	case n >= base:
+		return fmt.Sprintf("%gK", float64(n)/float64(base))
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/prompts"
+	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	promptsShowDefault  bool
+	promptsShowRendered bool
+)
+
+var promptsCmd = &cobra.Command{
+	Use:   "prompts",
+	Short: "Show and customize the system prompts",
+	Long: `Show and customize the system prompts sent to the provider.
+
+The system prompts are Go text/template files. Each task has a built-in
+template, which you can override with a file in ~/.aiask/prompts/:
+
+  generate.tmpl   Generating commands
+  explain.tmpl    Explaining commands (aiask explain, /explain)
+  recovery.tmpl   Fixing a command that failed
+
+Templates can use these fields:
+
+  {{.Shell}}                Shell name, e.g. Bash
+  {{.OS}}                   Operating system, e.g. macOS
+  {{.CWD}}                  Current directory
+  {{.Git.IsRepo}}           Whether the directory is in a git repository
+  {{.Git.Branch}}           Current branch
+  {{.Git.Dirty}}            Whether there are uncommitted changes
+  {{.Git.Status}}           Status summary, for git-related requests
+  {{.Git.RecentCommits}}    Last commits, for git-related requests
+  {{.Project}}              Project types detected, e.g. Go, Node.js
+  {{.Directory}}            Directory listing, for file-related requests
+  {{.Rules}}                Response format rules; keep these in the template
+  {{.Suffix}}               system_prompt_suffix from the config
+  {{.Failure.Command}}      The failed command (recovery)
+  {{.Failure.Error}}        Its error (recovery)
+
+The functions join, lower and upper are available, and a template can
+include another, e.g. {{template "generate" .}}. Explain templates only get
+the OS, CWD and Project fields.
+
+Examples:
+  aiask prompts                       # List the prompts and which are overridden
+  aiask prompts show generate         # Print the template in use
+  aiask prompts show generate --rendered  # Print the prompt for this directory
+  aiask prompts edit generate         # Override the template in $EDITOR
+  aiask prompts reset generate        # Go back to the built-in template`,
+	Run: runPromptsList,
+}
+
+var promptsShowCmd = &cobra.Command{
+	Use:       "show <prompt>",
+	Short:     "Print a prompt template",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: prompts.Tasks,
+	Run:       runPromptsShow,
+}
+
+var promptsEditCmd = &cobra.Command{
+	Use:   "edit <prompt>",
+	Short: "Override a prompt template in your editor",
+	Long: `Copy the built-in template to ~/.aiask/prompts/ if it isn't overridden yet,
+and open it in $VISUAL or $EDITOR. The template is checked after editing.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: prompts.Tasks,
+	Run:       runPromptsEdit,
+}
+
+var promptsResetCmd = &cobra.Command{
+	Use:       "reset <prompt>",
+	Short:     "Remove an override and use the built-in template again",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: prompts.Tasks,
+	Run:       runPromptsReset,
+}
+
+func init() {
+	promptsShowCmd.Flags().BoolVar(&promptsShowDefault, "default", false, "Print the built-in template, even if it is overridden")
+	promptsShowCmd.Flags().BoolVar(&promptsShowRendered, "rendered", false, "Print the prompt rendered for the current shell and directory")
+
+	promptsCmd.AddCommand(promptsShowCmd)
+	promptsCmd.AddCommand(promptsEditCmd)
+	promptsCmd.AddCommand(promptsResetCmd)
+}
+
+func runPromptsList(cmd *cobra.Command, args []string) {
+	for _, task := range prompts.Tasks {
+		_, path, err := prompts.Source(task)
+		switch {
+		case err != nil:
+			fmt.Printf("  %s%-10s%s %s%s%s\n", ui.ColorBold, task, ui.ColorReset, ui.ColorRed, err, ui.ColorReset)
+		case path == "":
+			fmt.Printf("  %s%-10s%s %sbuilt-in%s\n", ui.ColorBold, task, ui.ColorReset, ui.ColorDim, ui.ColorReset)
+		default:
+			status := ui.ColorGreen + "overridden" + ui.ColorReset
+			if err := prompts.Check(task); err != nil {
+				status = ui.ColorRed + "invalid" + ui.ColorReset
+			}
+			fmt.Printf("  %s%-10s%s %s %s%s%s\n", ui.ColorBold, task, ui.ColorReset, status, ui.ColorDim, path, ui.ColorReset)
+		}
+	}
+	fmt.Println()
+	fmt.Printf("%sShow one with: aiask prompts show <prompt>%s\n", ui.ColorDim, ui.ColorReset)
+}
+
+func runPromptsShow(cmd *cobra.Command, args []string) {
+	task := args[0]
+	if !prompts.Valid(task) {
+		ui.ShowError(fmt.Errorf("unknown prompt %q (valid prompts: %s)", task, strings.Join(prompts.Tasks, ", ")))
+		os.Exit(1)
+	}
+
+	switch {
+	case promptsShowDefault:
+		fmt.Print(prompts.Default(task))
+	case promptsShowRendered:
+		rendered, err := renderPrompt(task)
+		if err != nil {
+			ui.ShowError(err)
+			os.Exit(1)
+		}
+		fmt.Println(rendered)
+	default:
+		source, _, err := prompts.Source(task)
+		if err != nil {
+			ui.ShowError(err)
+			os.Exit(1)
+		}
+		fmt.Print(source)
+	}
+}
+
+// renderPrompt renders a prompt the way it would be sent for a request in the
+// current directory. Recovery prompts get an example failure.
+func renderPrompt(task string) (string, error) {
+	if task == prompts.TaskExplain {
+		return llm.BuildExplainPrompt(shell.Detect())
+	}
+
+	suffix := systemSuffixFlag
+	if suffix == "" {
+		if cfg, err := config.Load(); err == nil {
+			suffix = cfg.SystemPromptSuffix
+		}
+	}
+	req := llm.GenerateRequest{ShellInfo: shell.Detect()}
+	if task == prompts.TaskRecovery {
+		req.Failed = &llm.FailedCommand{Command: "tar -xzf archive.tar", Error: "gzip: stdin: not in gzip format"}
+	}
+	return llm.BuildStructuredSystemPrompt(req, suffix)
+}
+
+func runPromptsEdit(cmd *cobra.Command, args []string) {
+	task := args[0]
+	path, err := prompts.Create(task)
+	if err != nil {
+		ui.ShowError(err)
+		os.Exit(1)
+	}
+
+	editor := editorCommand()
+	editCmd := exec.Command(editor[0], append(editor[1:], path)...)
+	editCmd.Stdin, editCmd.Stdout, editCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := editCmd.Run(); err != nil {
+		ui.ShowError(fmt.Errorf("failed to run %s: %w", editor[0], err))
+		fmt.Printf("Edit the template at %s\n", path)
+		os.Exit(1)
+	}
+
+	if err := prompts.Check(task); err != nil {
+		ui.ShowError(err)
+		fmt.Printf("Fix it with 'aiask prompts edit %s', or go back to the built-in template with 'aiask prompts reset %s'.\n", task, task)
+		os.Exit(1)
+	}
+	fmt.Println(ui.SuccessMessage(fmt.Sprintf("Saved the %s prompt to %s", task, path)))
+}
+
+// editorCommand returns the user's editor from $VISUAL or $EDITOR, split into
+// the program and its arguments
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+func runPromptsReset(cmd *cobra.Command, args []string) {
+	task := args[0]
+	removed, err := prompts.Reset(task)
+	if err != nil {
+		ui.ShowError(err)
+		os.Exit(1)
+	}
+	if !removed {
+		fmt.Println(ui.InfoMessage(fmt.Sprintf("The %s prompt is not overridden.", task)))
+		return
+	}
+	fmt.Println(ui.SuccessMessage(fmt.Sprintf("The %s prompt uses the built-in template again.", task)))
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/interrupt"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/Hermithic/aiask/internal/usage"
+)
+
+// JSONReview represents the review of the generated command in JSON output
+type JSONReview struct {
+	Issues    []string `json:"issues"`
+	Corrected string   `json:"corrected,omitempty"` // The corrected command, if the review proposes one
+	Error     string   `json:"error,omitempty"`
+}
+
+// reviewEnabled reports whether generated commands are reviewed in a second
+// pass, with --review or review in the config
+func reviewEnabled(cfg *config.Config) bool {
+	return reviewFlag || cfg.Review
+}
+
+// newReviewer returns the function that reviews generated commands with the
+// provider, or nil when reviews are off or the provider can't review
+func newReviewer(provider llm.Provider, shellInfo shell.ShellInfo, cfg *config.Config) ui.ReviewFunc {
+	if !reviewEnabled(cfg) {
+		return nil
+	}
+	if !llm.SupportsReview(provider) {
+		if verbose {
+			fmt.Printf("%s[DEBUG] Review disabled: the provider can't review commands%s\n", ui.ColorDim, ui.ColorReset)
+		}
+		return nil
+	}
+
+	return func(command string) (*llm.Review, error) {
+		if !jsonOutput {
+			fmt.Printf("%sReviewing command...%s\n", ui.ColorDim, ui.ColorReset)
+		}
+		return reviewCommand(provider, command, shellInfo, cfg)
+	}
+}
+
+// reviewCommand reviews a command in a second pass and records its usage
+func reviewCommand(provider llm.Provider, command string, shellInfo shell.ShellInfo, cfg *config.Config) (*llm.Review, error) {
+	ctx, cancel := interrupt.WithTimeout(context.Background(), cfg.GetTimeout())
+	defer cancel()
+	ctx, tokens := llm.WithUsage(ctx)
+
+	startTime := time.Now()
+	review, err := provider.(llm.ReviewProvider).ReviewCommand(ctx, llm.ReviewRequest{Command: command, ShellInfo: shellInfo})
+	if verbose {
+		fmt.Printf("%s[DEBUG] Review time: %v%s\n", ui.ColorDim, time.Since(startTime), ui.ColorReset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	recordUsage(usage.TypeReview, provider, cfg, tokens, time.Since(startTime))
+	return review, nil
+}
+
+// jsonReview reviews a command for JSON output. A failed review is reported
+// in the output rather than failing the whole request.
+func jsonReview(review ui.ReviewFunc, command string) *JSONReview {
+	if review == nil {
+		return nil
+	}
+
+	r, err := review(command)
+	if err != nil {
+		return &JSONReview{Issues: []string{}, Error: err.Error()}
+	}
+	out := &JSONReview{Issues: r.Issues}
+	if out.Issues == nil {
+		out.Issues = []string{}
+	}
+	if r.Corrects(command) {
+		out.Corrected = r.Command()
+	}
+	return out
+}
@@ -13,10 +13,18 @@ import (
 
 	"github.com/Hermithic/aiask/internal/config"
 	"github.com/Hermithic/aiask/internal/history"
+	"github.com/Hermithic/aiask/internal/interrupt"
 	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/probe"
+	"github.com/Hermithic/aiask/internal/repl"
+	"github.com/Hermithic/aiask/internal/safety"
+	"github.com/Hermithic/aiask/internal/scrub"
 	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/trace"
+	"github.com/Hermithic/aiask/internal/transport"
 	"github.com/Hermithic/aiask/internal/ui"
 	"github.com/Hermithic/aiask/internal/update"
+	"github.com/Hermithic/aiask/internal/usage"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +38,21 @@ var (
 	useStdin   bool
 	streaming  bool
 
+	alternatives int
+	noCache      bool
+	refreshCache bool
+	recordPath   string
+	probing      bool
+	consensus    bool
+	reviewFlag   bool
+
+	// Per-run config overrides
+	providerFlag     string
+	modelFlag        string
+	timeoutFlag      int
+	systemSuffixFlag string
+	traceFlag        string
+
 	// Update check result (stored to avoid race condition with main output)
 	pendingUpdateMessage string
 	pendingUpdateMu      sync.Mutex
@@ -37,12 +60,49 @@ var (
 
 // JSONOutput represents the JSON output format
 type JSONOutput struct {
-	Command  string `json:"command"`
-	Shell    string `json:"shell"`
-	OS       string `json:"os"`
-	Prompt   string `json:"prompt"`
-	Provider string `json:"provider,omitempty"`
-	Model    string `json:"model,omitempty"`
+	Command      string   `json:"command"`
+	Commands     []string `json:"commands,omitempty"`
+	Explanation  string   `json:"explanation,omitempty"`
+	Assumptions  []string `json:"assumptions,omitempty"`
+	Placeholders []string `json:"placeholders,omitempty"`
+	Risk         string   `json:"risk,omitempty"`
+	Shell        string   `json:"shell"`
+	OS           string   `json:"os"`
+	Prompt       string   `json:"prompt"`
+	Provider     string   `json:"provider,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Cached       bool     `json:"cached,omitempty"`
+	Probes       []string `json:"probes,omitempty"` // Tool calls the model made before answering
+	Masked       []string `json:"masked,omitempty"` // Secrets masked before the request was sent
+
+	Candidates []JSONCandidate `json:"candidates,omitempty"`
+	Consensus  *JSONConsensus  `json:"consensus,omitempty"`
+	Review     *JSONReview     `json:"review,omitempty"`
+}
+
+// JSONCandidate represents one of several alternative commands in JSON output
+type JSONCandidate struct {
+	Command     string   `json:"command"`
+	Commands    []string `json:"commands"`
+	Explanation string   `json:"explanation,omitempty"`
+	Risk        string   `json:"risk,omitempty"`
+	Safety      string   `json:"safety"`
+}
+
+// JSONConsensus represents the answers of each provider in consensus mode
+type JSONConsensus struct {
+	Agreed  bool                  `json:"agreed"`
+	Answers []JSONConsensusAnswer `json:"answers"`
+}
+
+// JSONConsensusAnswer represents one provider's answer in consensus mode
+type JSONConsensusAnswer struct {
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Command   string `json:"command,omitempty"`
+	Safety    string `json:"safety,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
 }
 
 var rootCmd = &cobra.Command{
@@ -57,11 +117,27 @@ Example:
   aiask "compress the current directory into a zip file"
 
 Environment Variables:
-  AIASK_PROVIDER    - LLM provider (grok, openai, anthropic, gemini, ollama)
+  AIASK_PROVIDER    - LLM provider (grok, openai, anthropic, gemini, ollama, azure, openai-compatible, replay)
   AIASK_API_KEY     - API key for the provider
   AIASK_MODEL       - Model name to use
   AIASK_OLLAMA_URL  - Ollama server URL (default: http://localhost:11434)
-  AIASK_TIMEOUT     - Request timeout in seconds (default: 60)`,
+  AIASK_BASE_URL    - API URL for openai-compatible, or the Azure OpenAI endpoint
+  AIASK_AZURE_DEPLOYMENT  - Azure OpenAI deployment name (default: the model name)
+  AIASK_AZURE_API_VERSION - Azure OpenAI API version (default: 2024-10-21)
+  AIASK_CASSETTE    - Cassette file served by the replay provider (see --record)
+  AIASK_TIMEOUT     - Request timeout in seconds (default: 60)
+
+The --provider, --model, --timeout and --system-suffix flags override the
+config for a single run, e.g. to compare a local model with a hosted one:
+  aiask --provider ollama --model qwen2.5-coder "find large log files"
+
+With --consensus, the main provider and every fallback provider are asked at
+once, and their commands compared. When they disagree, the commands are shown
+side by side and running one needs a stronger confirmation:
+  aiask --consensus "drain node worker-3 and cordon it"
+
+With --review, each command is checked in a second pass for mistakes such as
+GNU-only flags on macOS or quoting bugs, and a corrected version is offered.`,
 	Args: cobra.ArbitraryArgs,
 	Run:  runMain,
 }
@@ -71,6 +147,21 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Output result as JSON (non-interactive)")
 	rootCmd.PersistentFlags().BoolVar(&useStdin, "stdin", false, "Read additional context from stdin")
 	rootCmd.PersistentFlags().BoolVarP(&streaming, "stream", "s", false, "Stream the response as it generates")
+	rootCmd.PersistentFlags().IntVar(&alternatives, "alternatives", 0, "Generate N alternative commands and choose one")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Don't read or write the response cache")
+	rootCmd.PersistentFlags().BoolVar(&refreshCache, "refresh", false, "Ignore cached responses and store fresh ones")
+	rootCmd.PersistentFlags().StringVar(&recordPath, "record", "", "Record requests and responses to a cassette `file` for the replay provider")
+	rootCmd.PersistentFlags().BoolVar(&probing, "probe", false, "Let the model inspect the system with read-only tools before answering")
+	rootCmd.PersistentFlags().StringVar(&providerFlag, "provider", "", "Use this provider for this run instead of the configured one")
+	rootCmd.PersistentFlags().StringVar(&modelFlag, "model", "", "Use this model for this run instead of the configured one")
+	rootCmd.PersistentFlags().IntVar(&timeoutFlag, "timeout", 0, "Request timeout in `seconds` for this run")
+	rootCmd.PersistentFlags().BoolVar(&reviewFlag, "review", false, "Review each generated command in a second pass before showing it")
+	rootCmd.PersistentFlags().StringVar(&systemSuffixFlag, "system-suffix", "", "Extra instructions appended to the system prompt for this run")
+	rootCmd.PersistentFlags().StringVar(&traceFlag, "trace", "", "Log provider requests and responses to a JSONL `file`, with secrets redacted")
+	rootCmd.Flags().BoolVar(&consensus, "consensus", false, "Ask the main and fallback providers at once and compare their commands")
+	rootCmd.RegisterFlagCompletionFunc("provider", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return config.ValidProviders(), cobra.ShellCompDirectiveNoFileComp
+	})
 
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(versionCmd)
@@ -79,6 +170,11 @@ func init() {
 	rootCmd.AddCommand(explainCmd)
 	rootCmd.AddCommand(interactiveCmd)
 	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(usageCmd)
+	rootCmd.AddCommand(modelsCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(promptsCmd)
 }
 
 // Execute runs the root command
@@ -88,6 +184,40 @@ func Execute() error {
 	return rootCmd.Execute()
 }
 
+// loadConfig loads the configuration and applies the per-run overrides given
+// with --provider, --model, --timeout, --system-suffix and --trace. With
+// --provider, aiask also runs without a config file, taking the rest of the
+// settings from the environment. It also checks the number of --alternatives.
+func loadConfig() (*config.Config, error) {
+	if alternatives < 0 || alternatives > repl.MaxAlternatives {
+		return nil, fmt.Errorf("--alternatives must be from 2 to %d, or 1 for a single command", repl.MaxAlternatives)
+	}
+	overrides := config.Overrides{
+		Provider:           config.Provider(strings.ToLower(providerFlag)),
+		Model:              modelFlag,
+		Timeout:            timeoutFlag,
+		SystemPromptSuffix: systemSuffixFlag,
+		Trace:              traceFlag,
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		if overrides.Provider == "" || config.Exists() {
+			return nil, err
+		}
+		cfg = config.LoadEnv()
+	}
+	if cfg, err = cfg.Override(overrides); err != nil {
+		return nil, err
+	}
+	if cfg.Trace != "" {
+		if err := trace.Check(cfg.Trace); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
 // checkForUpdates checks for updates asynchronously and stores the message for later display
 func checkForUpdates() {
 	// Load config to check if update checks are enabled
@@ -96,8 +226,14 @@ func checkForUpdates() {
 		return
 	}
 
+	// The update check goes through the same proxy as provider requests
+	base, err := transport.Shared(cfg.Network)
+	if err != nil {
+		return
+	}
+
 	// Check for updates in the background and store the message
-	update.CheckForUpdatesAsync(Version, func(result *update.CheckResult) {
+	update.CheckForUpdatesAsync(Version, base, func(result *update.CheckResult) {
 		if result.UpdateAvailable {
 			pendingUpdateMu.Lock()
 			pendingUpdateMessage = update.FormatUpdateMessage(result)
@@ -132,7 +268,7 @@ func runMain(cmd *cobra.Command, args []string) {
 	}
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		if !jsonOutput {
 			fmt.Printf("Configuration error: %s\n", err)
@@ -151,8 +287,14 @@ func runMain(cmd *cobra.Command, args []string) {
 		printVerboseInfo(cfg, shellInfo)
 	}
 
-	// Create LLM provider
-	provider, err := llm.NewProvider(cfg)
+	// Create LLM provider. Consensus answers are never cached, so each run
+	// gets fresh opinions.
+	var provider llm.Provider
+	if consensus {
+		provider, err = newConsensusProvider(cfg)
+	} else {
+		provider, err = llm.NewProvider(cfg)
+	}
 	if err != nil {
 		if !jsonOutput {
 			ui.ShowError(fmt.Errorf("failed to create LLM provider: %w", err))
@@ -161,6 +303,18 @@ func runMain(cmd *cobra.Command, args []string) {
 		}
 		os.Exit(1)
 	}
+	reportFailovers(provider)
+	if !consensus {
+		provider = withCache(provider, cfg)
+	}
+	if provider, err = withRecording(provider, cfg); err != nil {
+		if !jsonOutput {
+			ui.ShowError(err)
+		} else {
+			outputJSON(JSONOutput{}, err)
+		}
+		os.Exit(1)
+	}
 	defer llm.CloseProvider(provider)
 
 	// Join args into a single prompt
@@ -169,14 +323,15 @@ func runMain(cmd *cobra.Command, args []string) {
 	// Read from stdin if requested or if stdin has data
 	stdinContent := readStdin()
 	if stdinContent != "" {
-		if prompt != "" {
-			prompt = prompt + "\n\nContext:\n" + stdinContent
-		} else {
-			prompt = "Analyze this output and suggest a solution:\n\n" + stdinContent
-		}
 		if verbose {
 			fmt.Printf("%s[DEBUG] Read %d bytes from stdin%s\n", ui.ColorDim, len(stdinContent), ui.ColorReset)
 		}
+		if prompt != "" {
+			prompt = prompt + "\n\nContext:\n"
+		} else {
+			prompt = "Analyze this output and suggest a solution:\n\n"
+		}
+		prompt += fitStdin(stdinContent, prompt, shellInfo, cfg)
 	}
 
 	if verbose {
@@ -202,8 +357,9 @@ func readStdin() string {
 		}
 	}
 
-	// Read stdin with a limit to avoid memory issues
-	const maxStdinBytes = 50000 // ~50KB limit
+	// Read stdin with a limit to avoid memory issues; fitStdin trims it
+	// further to the model's context budget
+	const maxStdinBytes = 1 << 20 // 1MB limit
 	reader := bufio.NewReader(os.Stdin)
 	var content strings.Builder
 	bytesRead := 0
@@ -246,6 +402,44 @@ func readStdin() string {
 	return result
 }
 
+// fitStdin trims piped input to the context budget of the model, keeping its
+// beginning and end
+func fitStdin(input, prompt string, shellInfo shell.ShellInfo, cfg *config.Config) string {
+	req := llm.GenerateRequest{Prompt: prompt, ShellInfo: shellInfo, Alternatives: alternatives, Budget: llm.ContextBudget(cfg)}
+	fitted, plan, err := llm.FitInput(req, cfg.SystemPromptSuffix, input)
+	if err != nil {
+		// The request reports the broken prompt template
+		return input
+	}
+	if verbose && fitted != input {
+		for _, fit := range plan.Fits {
+			if fit.Name == llm.PartInput {
+				fmt.Printf("%s[DEBUG] Trimmed stdin from %d to %d tokens to fit the context budget of %d tokens%s\n", ui.ColorDim, fit.Tokens, fit.Kept, plan.Budget, ui.ColorReset)
+			}
+		}
+	}
+	return fitted
+}
+
+// printContextPlan prints how the context of a request fits its budget
+func printContextPlan(req llm.GenerateRequest, cfg *config.Config) {
+	plan, err := llm.PlanContext(req, cfg.SystemPromptSuffix)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%s[DEBUG] Context: %d of %d tokens (%s context window: %d tokens)%s\n", ui.ColorDim, plan.Used(), plan.Budget, cfg.Model, llm.ContextWindow(cfg), ui.ColorReset)
+	for _, fit := range plan.Fits {
+		switch {
+		case fit.Dropped:
+			fmt.Printf("%s[DEBUG]   %-15s %6d tokens, dropped%s\n", ui.ColorDim, fit.Name, fit.Tokens, ui.ColorReset)
+		case fit.Trimmed():
+			fmt.Printf("%s[DEBUG]   %-15s %6d tokens, trimmed from %d%s\n", ui.ColorDim, fit.Name, fit.Kept, fit.Tokens, ui.ColorReset)
+		default:
+			fmt.Printf("%s[DEBUG]   %-15s %6d tokens%s\n", ui.ColorDim, fit.Name, fit.Kept, ui.ColorReset)
+		}
+	}
+}
+
 // truncateString truncates a string to max length
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -260,12 +454,94 @@ func printVerboseInfo(cfg *config.Config, shellInfo shell.ShellInfo) {
 	fmt.Printf("%s[DEBUG] OS: %s%s\n", ui.ColorDim, shell.GetOSName(), ui.ColorReset)
 	fmt.Printf("%s[DEBUG] Provider: %s%s\n", ui.ColorDim, cfg.Provider, ui.ColorReset)
 	fmt.Printf("%s[DEBUG] Model: %s%s\n", ui.ColorDim, cfg.Model, ui.ColorReset)
+	if cfg.BaseURL != "" {
+		fmt.Printf("%s[DEBUG] Base URL: %s%s\n", ui.ColorDim, cfg.GetBaseURL(), ui.ColorReset)
+	}
+	if cfg.Provider == config.ProviderAzure {
+		fmt.Printf("%s[DEBUG] Deployment: %s (api-version %s)%s\n", ui.ColorDim, cfg.GetDeployment(), cfg.GetAPIVersion(), ui.ColorReset)
+	}
+	for i, fb := range cfg.Fallbacks {
+		fmt.Printf("%s[DEBUG] Fallback %d: %s (%s)%s\n", ui.ColorDim, i+1, fb.Provider, cfg.WithProvider(fb).Model, ui.ColorReset)
+	}
 	fmt.Printf("%s[DEBUG] Timeout: %v%s\n", ui.ColorDim, cfg.GetTimeout(), ui.ColorReset)
+	if cfg.Network != nil {
+		fmt.Printf("%s[DEBUG] Network: %s%s\n", ui.ColorDim, transport.Describe(cfg.Network), ui.ColorReset)
+	}
+	if cfg.Trace != "" {
+		fmt.Printf("%s[DEBUG] Tracing requests to %s%s\n", ui.ColorDim, cfg.Trace, ui.ColorReset)
+	}
 	if cfg.SystemPromptSuffix != "" {
 		fmt.Printf("%s[DEBUG] System prompt suffix: %s%s\n", ui.ColorDim, cfg.SystemPromptSuffix, ui.ColorReset)
 	}
 }
 
+// withRecording wraps the provider so its interactions are saved to the
+// cassette given with --record
+func withRecording(provider llm.Provider, cfg *config.Config) (llm.Provider, error) {
+	if recordPath == "" {
+		return provider, nil
+	}
+
+	rp, err := llm.NewRecordingProvider(provider, recordPath, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	rp.OnError = func(err error) {
+		ui.ShowError(fmt.Errorf("failed to record interaction: %w", err))
+	}
+	if verbose {
+		fmt.Printf("%s[DEBUG] Recording to %s%s\n", ui.ColorDim, recordPath, ui.ColorReset)
+	}
+	return rp, nil
+}
+
+// probingEnabled reports whether the model may call probing tools, with
+// --probe or tools.enabled in the config
+func probingEnabled(cfg *config.Config) bool {
+	return probing || (cfg.Tools != nil && cfg.Tools.Enabled)
+}
+
+// newToolbox creates the probing tools allowed by the config. Each tool call
+// is printed as it happens, except in JSON mode.
+func newToolbox(cfg *config.Config) *probe.Toolbox {
+	policy := probe.Policy{HelpCommands: probe.HelpCommands(cfg)}
+	if cwd, err := os.Getwd(); err == nil {
+		policy.Roots = append(policy.Roots, cwd)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		policy.Roots = append(policy.Roots, home)
+	}
+	if cfg.Tools != nil {
+		policy.Roots = append(policy.Roots, cfg.Tools.AllowPaths...)
+	}
+
+	tools := probe.New(policy, cfg.GetToolRounds())
+	if !jsonOutput {
+		tools.OnCall = printProbe
+	}
+	return tools
+}
+
+// printProbe prints a line of the probing trace, e.g. "which docker → /usr/bin/docker"
+func printProbe(call probe.Call) {
+	result := call.Result()
+	if lines := strings.Split(strings.TrimSpace(result), "\n"); len(lines) > 1 {
+		result = fmt.Sprintf("%d lines", len(lines))
+	}
+	fmt.Printf("%s  %s %s %s %s%s\n", ui.ColorDim, ui.IconInfo, call.Summary(), ui.IconArrow, truncateString(result, 60), ui.ColorReset)
+}
+
+// reportFailovers prints a debug line in verbose mode whenever a fallback provider takes over
+func reportFailovers(provider llm.Provider) {
+	fp, ok := provider.(*llm.FallbackProvider)
+	if !ok || !verbose {
+		return
+	}
+	fp.OnFailover = func(name config.Provider, model string, err error) {
+		fmt.Printf("\n%s[DEBUG] %s (%s) unavailable, trying next provider: %s%s\n", ui.ColorDim, name, model, err, ui.ColorReset)
+	}
+}
+
 // outputJSON outputs the result as JSON
 func outputJSON(output JSONOutput, err error) {
 	type jsonError struct {
@@ -283,21 +559,52 @@ func outputJSON(output JSONOutput, err error) {
 }
 
 func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.ShellInfo, cfg *config.Config) {
+	callType := usage.TypeGenerate
+	consensusProvider, _ := provider.(*llm.ConsensusProvider)
+	review := newReviewer(provider, shellInfo, cfg)
+	var failed *llm.FailedCommand
+
+	var tools *probe.Toolbox
+	if probingEnabled(cfg) && llm.SupportsTools(provider) {
+		tools = newToolbox(cfg)
+		if verbose {
+			fmt.Printf("%s[DEBUG] Probing tools enabled: up to %d rounds%s\n", ui.ColorDim, tools.MaxRounds, ui.ColorReset)
+		}
+	}
 	for {
-		// Generate command with configurable timeout
-		ctx, cancel := context.WithTimeout(context.Background(), cfg.GetTimeout())
+		// Generate command with configurable timeout; Ctrl-C cancels the request
+		ctx, cancel := interrupt.WithTimeout(context.Background(), cfg.GetTimeout())
+		ctx, tokens := llm.WithUsage(ctx)
+		ctx, masked := llm.WithScrubReport(ctx)
 
 		startTime := time.Now()
-		var command string
+		var result *llm.CommandResult
 		var err error
 
-		// Use streaming if enabled and provider supports it
-		if streaming && llm.SupportsStreaming(provider) {
+		req := llm.GenerateRequest{Prompt: prompt, ShellInfo: shellInfo, Alternatives: alternatives, Failed: failed, Budget: llm.ContextBudget(cfg)}
+		if verbose {
+			printContextPlan(req, cfg)
+		}
+
+		// Use streaming if enabled and provider supports it. Alternatives need
+		// the structured response, so they are never streamed.
+		if streaming && alternatives > 1 && verbose {
+			fmt.Printf("%s[DEBUG] Streaming disabled: alternatives require a structured response%s\n", ui.ColorDim, ui.ColorReset)
+		}
+		if streaming && tools != nil && verbose {
+			fmt.Printf("%s[DEBUG] Streaming disabled: probing tools require a structured response%s\n", ui.ColorDim, ui.ColorReset)
+		}
+		if tools != nil {
+			if !jsonOutput {
+				fmt.Printf("\n%sGenerating command...%s\n", ui.ColorDim, ui.ColorReset)
+			}
+			result, err = provider.(llm.ToolProvider).GenerateCommandWithTools(ctx, req, tools)
+		} else if streaming && alternatives <= 1 && llm.SupportsStreaming(provider) {
 			if !jsonOutput {
 				fmt.Printf("\n%sGenerating command...%s\n", ui.ColorDim, ui.ColorReset)
 			}
 			streamProvider := provider.(llm.StreamingProvider)
-			command, err = streamProvider.GenerateCommandStream(ctx, prompt, shellInfo, func(chunk string) {
+			result, err = streamProvider.GenerateCommandStream(ctx, req, func(chunk string) {
 				if !jsonOutput {
 					fmt.Print(chunk)
 				}
@@ -309,14 +616,38 @@ func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.Sh
 			if !jsonOutput {
 				fmt.Printf("\n%sGenerating command...%s\n", ui.ColorDim, ui.ColorReset)
 			}
-			command, err = provider.GenerateCommand(ctx, prompt, shellInfo)
+			result, err = provider.GenerateCommand(ctx, req)
 		}
 		cancel()
 
+		answeredProvider, answeredModel := llm.AnsweredBy(provider, cfg)
 		if verbose {
 			fmt.Printf("%s[DEBUG] Response time: %v%s\n", ui.ColorDim, time.Since(startTime), ui.ColorReset)
+			if err == nil {
+				fmt.Printf("%s[DEBUG] Answered by: %s (%s)%s\n", ui.ColorDim, answeredProvider, answeredModel, ui.ColorReset)
+			}
+			if servedFromCache(provider) {
+				fmt.Printf("%s[DEBUG] Served from cache%s\n", ui.ColorDim, ui.ColorReset)
+			}
+		}
+		var answers *llm.Consensus
+		if consensusProvider != nil {
+			answers = consensusProvider.Last()
+			recordConsensusUsage(callType, answers)
+		} else if err == nil {
+			recordUsage(callType, provider, cfg, tokens, time.Since(startTime))
 		}
 
+		if err != nil && interrupt.Interrupted(ctx) {
+			if jsonOutput {
+				outputJSON(JSONOutput{Prompt: prompt}, interrupt.ErrInterrupted)
+			} else {
+				fmt.Println()
+				fmt.Println(ui.WarningMessage("Cancelled."))
+			}
+			llm.CloseProvider(provider)
+			os.Exit(interrupt.ExitCode)
+		}
 		if err != nil {
 			if jsonOutput {
 				outputJSON(JSONOutput{Prompt: prompt}, fmt.Errorf("failed to generate command: %w", err))
@@ -327,19 +658,38 @@ func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.Sh
 			return
 		}
 
-		// Clean up the command (remove any markdown code blocks if present)
-		command = llm.CleanCommand(command)
+		if !jsonOutput {
+			ui.ShowMasked(masked)
+		}
+		if verbose && alternatives > 1 {
+			fmt.Printf("%s[DEBUG] Candidates: %d requested, %d distinct%s\n", ui.ColorDim, alternatives, len(result.Candidates()), ui.ColorReset)
+		}
 
 		// JSON output mode - non-interactive
 		if jsonOutput {
-			outputJSON(JSONOutput{
-				Command:  command,
-				Shell:    string(shellInfo.Shell),
-				OS:       shellInfo.OS,
-				Prompt:   prompt,
-				Provider: string(cfg.Provider),
-				Model:    cfg.Model,
-			}, nil)
+			command := result.Command()
+			output := JSONOutput{
+				Command:      command,
+				Commands:     result.Commands,
+				Explanation:  result.Explanation,
+				Assumptions:  result.Assumptions,
+				Placeholders: result.Placeholders,
+				Risk:         result.Risk,
+				Shell:        string(shellInfo.Shell),
+				OS:           shellInfo.OS,
+				Prompt:       prompt,
+				Provider:     string(answeredProvider),
+				Model:        answeredModel,
+				Cached:       servedFromCache(provider),
+				Candidates:   jsonCandidates(result),
+				Probes:       probeSummaries(tools),
+				Masked:       maskedSummaries(masked),
+			}
+			if answers != nil {
+				output.Consensus = jsonConsensus(answers)
+			}
+			output.Review = jsonReview(review, command)
+			outputJSON(output, nil)
 			// Record in history (not executed)
 			if err := history.AddEntry(prompt, command, string(shellInfo.Shell), false); err != nil && verbose {
 				fmt.Printf("%s[DEBUG] Failed to record history: %s%s\n", ui.ColorDim, err, ui.ColorReset)
@@ -347,11 +697,20 @@ func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.Sh
 			return
 		}
 
-		// Display the command
-		ui.DisplayCommand(command)
-
-		// Get user action (with safety checks for dangerous commands)
-		action := ui.PromptActionForCommand(command)
+		// Display the command, or let the user pick one of the alternatives or
+		// of the providers' commands, and get the user action (with safety
+		// checks for dangerous and disputed commands)
+		var chosen *llm.CommandResult
+		var action ui.Action
+		if answers != nil {
+			chosen, action = ui.ChooseConsensus(answers, review)
+		} else {
+			chosen, action = ui.ChooseCommand(result, review)
+		}
+		var command string
+		if chosen != nil {
+			command = chosen.Command()
+		}
 
 		switch action {
 		case ui.ActionExecute:
@@ -365,6 +724,8 @@ func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.Sh
 			if wantsRecovery && execErr != nil {
 				recoveryPrompt := fmt.Sprintf("The command '%s' failed with error: %s. How can I fix this?", command, execErr.Error())
 				prompt = recoveryPrompt
+				failed = &llm.FailedCommand{Command: command, Error: execErr.Error()}
+				callType = usage.TypeRecovery
 				continue
 			}
 			printPendingUpdateMessage()
@@ -399,6 +760,8 @@ func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.Sh
 				if wantsRecovery && execErr != nil {
 					recoveryPrompt := fmt.Sprintf("The command '%s' failed with error: %s. How can I fix this?", editedCommand, execErr.Error())
 					prompt = recoveryPrompt
+					failed = &llm.FailedCommand{Command: editedCommand, Error: execErr.Error()}
+					callType = usage.TypeRecovery
 					continue
 				}
 			case ui.ActionCopy:
@@ -422,6 +785,8 @@ func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.Sh
 				return
 			}
 			prompt = newPrompt
+			failed = nil
+			callType = usage.TypeGenerate
 			continue
 
 		case ui.ActionQuit:
@@ -432,6 +797,54 @@ func runInteractionLoop(provider llm.Provider, prompt string, shellInfo shell.Sh
 	}
 }
 
+// jsonCandidates converts the candidates of a result to JSON output, or nil
+// when there is only one
+func jsonCandidates(result *llm.CommandResult) []JSONCandidate {
+	candidates := result.Candidates()
+	if len(candidates) < 2 {
+		return nil
+	}
+
+	out := make([]JSONCandidate, len(candidates))
+	for i, candidate := range candidates {
+		command := candidate.Command()
+		out[i] = JSONCandidate{
+			Command:     command,
+			Commands:    candidate.Commands,
+			Explanation: candidate.Explanation,
+			Risk:        candidate.Risk,
+			Safety:      strings.ToLower(safety.GetLevelName(safety.Analyze(command).Level)),
+		}
+	}
+	return out
+}
+
+// probeSummaries returns the tool calls made with a toolbox for JSON output
+func probeSummaries(tools *probe.Toolbox) []string {
+	if tools == nil {
+		return nil
+	}
+	summaries := make([]string, len(tools.Calls))
+	for i, call := range tools.Calls {
+		summaries[i] = call.Summary()
+	}
+	return summaries
+}
+
+// maskedSummaries describes the secrets masked before a request was sent for
+// JSON output, e.g. "AWS access key in prompt"
+func maskedSummaries(report *llm.ScrubReport) []string {
+	var summaries []string
+	seen := map[scrub.Match]bool{}
+	for _, m := range report.Matches() {
+		if !seen[m] {
+			seen[m] = true
+			summaries = append(summaries, m.Kind+" in "+m.Source)
+		}
+	}
+	return summaries
+}
+
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number",
@@ -439,4 +852,3 @@ var versionCmd = &cobra.Command{
 		fmt.Printf("aiask version %s\n", Version)
 	},
 }
-
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/Hermithic/aiask/internal/config"
 	"github.com/Hermithic/aiask/internal/llm"
 	"github.com/Hermithic/aiask/internal/shell"
 	"github.com/Hermithic/aiask/internal/templates"
@@ -162,7 +161,7 @@ func runTemplatesRun(cmd *cobra.Command, args []string) {
 	_ = t.Save()
 
 	// Load config and run the prompt
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		ui.ShowError(fmt.Errorf("configuration error: %w", err))
 		return
@@ -175,6 +174,12 @@ func runTemplatesRun(cmd *cobra.Command, args []string) {
 		ui.ShowError(fmt.Errorf("failed to create LLM provider: %w", err))
 		return
 	}
+	reportFailovers(provider)
+	provider = withCache(provider, cfg)
+	if provider, err = withRecording(provider, cfg); err != nil {
+		ui.ShowError(err)
+		return
+	}
 	defer llm.CloseProvider(provider)
 
 	fmt.Printf("%sRunning template '%s': %s%s\n", ui.ColorDim, name, tmpl.Prompt, ui.ColorReset)
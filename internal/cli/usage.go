@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/Hermithic/aiask/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	usageDays int
+	usageBy   string
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show token usage and estimated cost",
+	Long: `Summarize the tokens used by aiask per day, provider, model and
+command type (generate, explain, recovery, review).
+
+Costs are estimated from the optional prices table in the config file, in USD
+per million tokens, keyed by "provider/model" or model name:
+
+  prices:
+    gpt-4o:
+      input: 2.50
+      output: 10.00
+    anthropic/claude-sonnet-4-20250514:
+      input: 3.00
+      output: 15.00
+
+Examples:
+  aiask usage                # Last 30 days, all breakdowns
+  aiask usage --days 7       # Last 7 days
+  aiask usage --by model     # Only the per-model breakdown
+  aiask usage --json         # Machine-readable summary`,
+	Run: runUsage,
+}
+
+func init() {
+	usageCmd.Flags().IntVarP(&usageDays, "days", "d", 30, "Number of days to include")
+	usageCmd.Flags().StringVar(&usageBy, "by", "", "Only show one breakdown: day, provider, model or type")
+}
+
+// recordUsage appends a completed provider call to the usage log. Responses
+// served from the cache cost nothing and are not recorded.
+func recordUsage(callType string, provider llm.Provider, cfg *config.Config, tokens *llm.Usage, latency time.Duration) {
+	if servedFromCache(provider) {
+		return
+	}
+	printTokens(tokens)
+	reportUsageError(llm.RecordUsage(callType, provider, cfg, tokens, latency))
+}
+
+// recordConsensusUsage appends each provider's answer to a consensus request
+// to the usage log
+func recordConsensusUsage(callType string, consensus *llm.Consensus) {
+	for _, a := range consensus.Succeeded() {
+		printTokens(a.Usage)
+		reportUsageError(llm.AppendUsage(callType, a.Provider, a.Model, a.Usage, a.Latency))
+	}
+}
+
+// printTokens prints the token usage of a call in verbose mode
+func printTokens(tokens *llm.Usage) {
+	if verbose {
+		input, output := tokens.Tokens()
+		fmt.Printf("%s[DEBUG] Tokens: %d input, %d output%s\n", ui.ColorDim, input, output, ui.ColorReset)
+	}
+}
+
+// reportUsageError notes a failure to record usage in verbose mode
+func reportUsageError(err error) {
+	if err != nil && verbose {
+		fmt.Printf("%s[DEBUG] Failed to record usage: %s%s\n", ui.ColorDim, err, ui.ColorReset)
+	}
+}
+
+// usageBreakdown is a named way of grouping usage records
+type usageBreakdown struct {
+	Name  string
+	Title string
+	Key   func(usage.Record) string
+}
+
+var usageBreakdowns = []usageBreakdown{
+	{Name: "day", Title: "By Day", Key: usage.ByDay},
+	{Name: "provider", Title: "By Provider", Key: usage.ByProvider},
+	{Name: "model", Title: "By Model", Key: usage.ByModel},
+	{Name: "type", Title: "By Command Type", Key: usage.ByType},
+}
+
+func runUsage(cmd *cobra.Command, args []string) {
+	breakdowns := usageBreakdowns
+	if usageBy != "" {
+		breakdowns = nil
+		for _, b := range usageBreakdowns {
+			if b.Name == strings.ToLower(usageBy) {
+				breakdowns = append(breakdowns, b)
+			}
+		}
+		if len(breakdowns) == 0 {
+			ui.ShowError(fmt.Errorf("unknown breakdown %q: use day, provider, model or type", usageBy))
+			return
+		}
+	}
+
+	// Prices are optional, so a missing config is not an error
+	var prices map[string]config.Price
+	if cfg, err := config.Load(); err == nil {
+		prices = cfg.Prices
+	}
+
+	since := time.Now().AddDate(0, 0, -usageDays)
+	records, err := usage.Load(since)
+	if err != nil {
+		ui.ShowError(fmt.Errorf("failed to load usage: %w", err))
+		return
+	}
+
+	if jsonOutput {
+		summary := map[string][]usage.Row{}
+		for _, b := range breakdowns {
+			summary[b.Name] = usage.Summarize(records, b.Key, prices)
+		}
+		summary["total"] = usage.Summarize(records, func(usage.Record) string { return "total" }, prices)
+		data, _ := json.MarshalIndent(summary, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(ui.Header(fmt.Sprintf("Usage: last %d days", usageDays), 64))
+	fmt.Println()
+
+	if len(records) == 0 {
+		fmt.Println(ui.InfoMessage("No usage recorded in this period."))
+		fmt.Println()
+		return
+	}
+
+	for _, b := range breakdowns {
+		fmt.Printf("%s%s%s\n", ui.ColorBold, b.Title, ui.ColorReset)
+		printUsageRows(usage.Summarize(records, b.Key, prices))
+		fmt.Println()
+	}
+
+	total := usage.Summarize(records, func(usage.Record) string { return "Total" }, prices)
+	fmt.Println(ui.Divider(64))
+	printUsageRows(total)
+	if total[0].Unpriced > 0 {
+		fmt.Printf("%s%d calls have no price in the config; see 'aiask usage --help'.%s\n", ui.ColorDim, total[0].Unpriced, ui.ColorReset)
+	}
+	fmt.Println()
+}
+
+// printUsageRows prints a usage summary table
+func printUsageRows(rows []usage.Row) {
+	for _, row := range rows {
+		cost := fmt.Sprintf("%s—%s", ui.ColorDim, ui.ColorReset)
+		if row.Unpriced < row.Calls {
+			cost = fmt.Sprintf("$%.4f", row.Cost)
+			if row.Unpriced > 0 {
+				cost += "*"
+			}
+		}
+		fmt.Printf("  %s%-28s%s %5d calls  %9d in  %8d out  %6s avg  %s\n",
+			ui.ColorCyan, truncateString(row.Key, 25), ui.ColorReset,
+			row.Calls, row.InputTokens, row.OutputTokens,
+			ui.FormatDuration(float64(row.AvgLatencyMs)/1000), cost)
+	}
+}
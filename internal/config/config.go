@@ -18,6 +18,10 @@ const (
 	EnvAPIKey             = "AIASK_API_KEY"
 	EnvModel              = "AIASK_MODEL"
 	EnvOllamaURL          = "AIASK_OLLAMA_URL"
+	EnvBaseURL            = "AIASK_BASE_URL"
+	EnvAzureDeployment    = "AIASK_AZURE_DEPLOYMENT"
+	EnvAzureAPIVersion    = "AIASK_AZURE_API_VERSION"
+	EnvCassette           = "AIASK_CASSETTE"
 	EnvTimeout            = "AIASK_TIMEOUT"
 	EnvSystemPromptSuffix = "AIASK_SYSTEM_PROMPT_SUFFIX"
 )
@@ -31,6 +35,15 @@ const (
 	ProviderAnthropic Provider = "anthropic"
 	ProviderGemini    Provider = "gemini"
 	ProviderOllama    Provider = "ollama"
+	ProviderAzure     Provider = "azure"
+
+	// ProviderOpenAICompatible is any server that speaks the OpenAI chat
+	// completions API, such as LM Studio, vLLM, llama.cpp or LiteLLM
+	ProviderOpenAICompatible Provider = "openai-compatible"
+
+	// ProviderReplay answers from a recorded cassette file instead of an LLM,
+	// for tests, CI and demos
+	ProviderReplay Provider = "replay"
 )
 
 // Config represents the application configuration
@@ -39,9 +52,255 @@ type Config struct {
 	APIKey             string   `yaml:"api_key,omitempty"`
 	Model              string   `yaml:"model"`
 	OllamaURL          string   `yaml:"ollama_url,omitempty"`
-	Timeout            int      `yaml:"timeout,omitempty"`             // Timeout in seconds (default: 60)
+	Timeout            int      `yaml:"timeout,omitempty"`              // Timeout in seconds (default: 60)
 	SystemPromptSuffix string   `yaml:"system_prompt_suffix,omitempty"` // Custom suffix for system prompt
-	CheckUpdates       bool     `yaml:"check_updates,omitempty"`       // Whether to check for updates on startup
+	CheckUpdates       bool     `yaml:"check_updates,omitempty"`        // Whether to check for updates on startup
+	ConversationTurns  int      `yaml:"conversation_turns,omitempty"`   // Turns remembered in interactive mode (default: 10)
+	CacheTTL           int      `yaml:"cache_ttl,omitempty"`            // Hours cached responses stay valid (default: 24)
+	DisableCache       bool     `yaml:"disable_cache,omitempty"`        // Always send requests to the provider
+	Review             bool     `yaml:"review,omitempty"`               // Review generated commands in a second pass before showing them
+	ContextBudget      int      `yaml:"context_budget,omitempty"`       // Most tokens of context sent with a request (default: 16000)
+
+	// OpenAI-compatible endpoint settings. BaseURL is required for the
+	// openai-compatible and azure providers and overrides the URL of grok
+	// and openai.
+	BaseURL      string            `yaml:"base_url,omitempty"`
+	Headers      map[string]string `yaml:"headers,omitempty"`      // Extra HTTP headers sent with every request
+	Organization string            `yaml:"organization,omitempty"` // OpenAI-Organization header
+	Project      string            `yaml:"project,omitempty"`      // OpenAI-Project header
+
+	// Azure OpenAI settings; BaseURL is the resource endpoint, e.g.
+	// https://my-resource.openai.azure.com
+	Deployment string `yaml:"deployment,omitempty"`  // Deployment name (default: the model name)
+	APIVersion string `yaml:"api_version,omitempty"` // api-version query parameter (default: 2024-10-21)
+
+	Ollama *OllamaConfig `yaml:"ollama,omitempty"` // Model options for the native Ollama API
+
+	Cassette string `yaml:"cassette,omitempty"` // Recorded interactions served by the replay provider
+	Trace    string `yaml:"trace,omitempty"`    // File that provider requests and responses are logged to, with secrets redacted
+
+	Retry     *RetryConfig     `yaml:"retry,omitempty"`     // Retry policy for the main provider
+	Fallbacks []ProviderConfig `yaml:"fallbacks,omitempty"` // Providers tried in order when the main provider is unavailable
+
+	// FallbackAfter is how many seconds a provider in a fallback chain has
+	// to start answering before the next one is tried (default: half the
+	// time left of the timeout)
+	FallbackAfter int `yaml:"fallback_after,omitempty"`
+
+	Prices map[string]Price `yaml:"prices,omitempty"` // Token prices by "provider/model" or model name, for usage reports
+
+	Tools *ToolsConfig `yaml:"tools,omitempty"` // Read-only tools the model may call to inspect the system
+
+	Network *NetworkConfig `yaml:"network,omitempty"` // Proxy and TLS settings for provider requests and update checks
+
+	Scrub *ScrubConfig `yaml:"scrub,omitempty"` // Masking of secrets in content sent to providers
+}
+
+// Price is the cost of a model's tokens in USD per million tokens
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// OllamaConfig holds options passed to Ollama with every request
+type OllamaConfig struct {
+	NumCtx    int    `yaml:"num_ctx,omitempty"`    // Context window size in tokens (default: the model's)
+	KeepAlive string `yaml:"keep_alive,omitempty"` // How long the model stays loaded, e.g. "10m" or -1 (default: 5m)
+}
+
+// NetworkConfig configures the HTTP connections to providers and the update
+// check, e.g. behind a corporate proxy that intercepts TLS. Paths may start
+// with ~.
+type NetworkConfig struct {
+	Proxy              string   `yaml:"proxy,omitempty"`                // Proxy URL, e.g. http://proxy.corp:8080 (default: HTTPS_PROXY and HTTP_PROXY)
+	NoProxy            []string `yaml:"no_proxy,omitempty"`             // Hosts, domains (.corp.com), IPs and CIDRs reached without the proxy, added to NO_PROXY
+	CACert             string   `yaml:"ca_cert,omitempty"`              // PEM file of CA certificates trusted in addition to the system's
+	ClientCert         string   `yaml:"client_cert,omitempty"`          // PEM client certificate for mutual TLS
+	ClientKey          string   `yaml:"client_key,omitempty"`           // PEM key of the client certificate (default: read from client_cert)
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify,omitempty"` // Don't verify server certificates; for testing only
+}
+
+// ToolsConfig configures the read-only tools the model may call before
+// answering (agentic mode)
+type ToolsConfig struct {
+	Enabled      bool     `yaml:"enabled"`                 // Offer the tools on every request (or use --probe)
+	MaxRounds    int      `yaml:"max_rounds,omitempty"`    // Tool-calling rounds before the model must answer (default: 4)
+	AllowPaths   []string `yaml:"allow_paths,omitempty"`   // Directories the tools may inspect besides the working and home directories
+	HelpCommands []string `yaml:"help_commands,omitempty"` // Programs whose --help output may be read besides the built-in list
+}
+
+// ScrubConfig controls the masking of secrets in prompts, piped input and
+// context before they are sent to a provider
+type ScrubConfig struct {
+	Disabled  bool     `yaml:"disabled,omitempty"`   // Send content without masking secrets
+	NoEntropy bool     `yaml:"no_entropy,omitempty"` // Only mask known credential formats, not random-looking strings
+	Patterns  []string `yaml:"patterns,omitempty"`   // Extra regular expressions of secrets; a group named "secret" limits the mask to it
+}
+
+// ScrubSecrets reports whether secrets are masked before content is sent to a provider
+func (c *Config) ScrubSecrets() bool {
+	return c.Scrub == nil || !c.Scrub.Disabled
+}
+
+// MaxToolRounds is the hard limit on tool-calling rounds per request
+const MaxToolRounds = 8
+
+// GetToolRounds returns the number of tool-calling rounds per request
+func (c *Config) GetToolRounds() int {
+	if c.Tools == nil || c.Tools.MaxRounds <= 0 {
+		return 4
+	}
+	if c.Tools.MaxRounds > MaxToolRounds {
+		return MaxToolRounds
+	}
+	return c.Tools.MaxRounds
+}
+
+// RetryConfig configures how failed provider requests are retried. Unset
+// fields use the defaults; max_attempts: 1 disables retries.
+type RetryConfig struct {
+	MaxAttempts      int `yaml:"max_attempts,omitempty"`       // Total attempts per request (default: 3)
+	InitialBackoffMs int `yaml:"initial_backoff_ms,omitempty"` // Delay before the first retry (default: 500)
+	MaxBackoffMs     int `yaml:"max_backoff_ms,omitempty"`     // Upper bound for the exponential delay (default: 8000)
+}
+
+// GetRetry returns the retry policy with defaults applied
+func (c *Config) GetRetry() RetryConfig {
+	retry := RetryConfig{MaxAttempts: 3, InitialBackoffMs: 500, MaxBackoffMs: 8000}
+	if c.Retry == nil {
+		return retry
+	}
+	if c.Retry.MaxAttempts > 0 {
+		retry.MaxAttempts = c.Retry.MaxAttempts
+	}
+	if c.Retry.InitialBackoffMs > 0 {
+		retry.InitialBackoffMs = c.Retry.InitialBackoffMs
+	}
+	if c.Retry.MaxBackoffMs > 0 {
+		retry.MaxBackoffMs = c.Retry.MaxBackoffMs
+	}
+	return retry
+}
+
+// ProviderConfig configures a fallback provider
+type ProviderConfig struct {
+	Provider  Provider `yaml:"provider"`
+	APIKey    string   `yaml:"api_key,omitempty"`
+	Model     string   `yaml:"model,omitempty"` // Defaults to the provider's default model
+	OllamaURL string   `yaml:"ollama_url,omitempty"`
+
+	BaseURL      string            `yaml:"base_url,omitempty"`
+	Headers      map[string]string `yaml:"headers,omitempty"`
+	Organization string            `yaml:"organization,omitempty"`
+	Project      string            `yaml:"project,omitempty"`
+	Deployment   string            `yaml:"deployment,omitempty"`
+	APIVersion   string            `yaml:"api_version,omitempty"`
+
+	Ollama *OllamaConfig `yaml:"ollama,omitempty"`
+	Retry  *RetryConfig  `yaml:"retry,omitempty"` // Defaults to the main provider's retry policy
+}
+
+// WithProvider returns a copy of the config that uses the given provider
+// settings, keeping all other options
+func (c *Config) WithProvider(p ProviderConfig) *Config {
+	cfg := *c
+	cfg.Provider = p.Provider
+	cfg.APIKey = p.APIKey
+	cfg.Model = p.Model
+	if cfg.Model == "" {
+		cfg.Model = GetDefaultModel(p.Provider)
+	}
+	cfg.OllamaURL = p.OllamaURL
+	if cfg.OllamaURL == "" {
+		cfg.OllamaURL = c.OllamaURL
+	}
+	cfg.BaseURL = p.BaseURL
+	cfg.Headers = p.Headers
+	cfg.Organization = p.Organization
+	cfg.Project = p.Project
+	cfg.Deployment = p.Deployment
+	cfg.APIVersion = p.APIVersion
+	if p.Ollama != nil {
+		cfg.Ollama = p.Ollama
+	}
+	if p.Retry != nil {
+		cfg.Retry = p.Retry
+	}
+	cfg.Fallbacks = nil
+	return &cfg
+}
+
+// Overrides are settings that apply to a single run, such as command-line
+// flags. Empty fields leave the config unchanged.
+type Overrides struct {
+	Provider           Provider
+	Model              string
+	Timeout            int // Seconds
+	SystemPromptSuffix string
+	Trace              string // Trace file
+}
+
+// Override returns a copy of the config with the overrides applied. Switching
+// to another provider takes its settings, including the API key, from the
+// fallback entry for that provider if there is one, and otherwise uses the
+// provider's defaults. The API key, model and base URL set in the environment
+// apply to the provider switched to unless its fallback entry sets them.
+// Fallbacks are not used after a switch.
+func (c *Config) Override(o Overrides) (*Config, error) {
+	cfg := *c
+	if o.Provider != "" && o.Provider != c.Provider {
+		if !isValidProvider(o.Provider) {
+			return nil, fmt.Errorf("unknown provider %q (valid: %s)", o.Provider, strings.Join(ValidProviders(), ", "))
+		}
+
+		settings := ProviderConfig{Provider: o.Provider}
+		for _, fb := range c.Fallbacks {
+			if fb.Provider == o.Provider {
+				settings = fb
+				break
+			}
+		}
+		cfg = *c.WithProvider(settings)
+		if apiKey := os.Getenv(EnvAPIKey); apiKey != "" && settings.APIKey == "" {
+			cfg.APIKey = apiKey
+		}
+		if model := os.Getenv(EnvModel); model != "" && settings.Model == "" {
+			cfg.Model = model
+		}
+		if baseURL := os.Getenv(EnvBaseURL); baseURL != "" && settings.BaseURL == "" {
+			cfg.BaseURL = baseURL
+		}
+		if cfg.APIKey == "" && RequiresAPIKey(o.Provider) {
+			return nil, fmt.Errorf("no API key for the %s provider; set %s or add it under fallbacks in the config file", o.Provider, EnvAPIKey)
+		}
+	}
+
+	if o.Model != "" {
+		cfg.Model = o.Model
+		if cfg.Deployment != "" {
+			cfg.Deployment = o.Model
+		}
+	}
+	if o.Timeout > 0 {
+		cfg.Timeout = o.Timeout
+	}
+	if o.SystemPromptSuffix != "" {
+		cfg.SystemPromptSuffix = o.SystemPromptSuffix
+	}
+	if o.Trace != "" {
+		cfg.Trace = o.Trace
+	}
+	return &cfg, nil
+}
+
+// isValidProvider reports whether p is one of the supported providers
+func isValidProvider(p Provider) bool {
+	for _, name := range ValidProviders() {
+		if Provider(name) == p {
+			return true
+		}
+	}
+	return false
 }
 
 // GetTimeout returns the timeout duration
@@ -52,14 +311,49 @@ func (c *Config) GetTimeout() time.Duration {
 	return time.Duration(c.Timeout) * time.Second
 }
 
+// GetFallbackAfter returns how long a provider in a fallback chain has to
+// start answering, or zero for the default share of the timeout
+func (c *Config) GetFallbackAfter() time.Duration {
+	if c.FallbackAfter <= 0 {
+		return 0
+	}
+	return time.Duration(c.FallbackAfter) * time.Second
+}
+
+// GetConversationTurns returns the maximum number of turns remembered in interactive mode
+func (c *Config) GetConversationTurns() int {
+	if c.ConversationTurns <= 0 {
+		return 10
+	}
+	return c.ConversationTurns
+}
+
+// GetCacheTTL returns how long cached responses stay valid
+func (c *Config) GetCacheTTL() time.Duration {
+	if c.CacheTTL <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.CacheTTL) * time.Hour
+}
+
+// GetContextBudget returns the most tokens of context sent with a request.
+// Models with a smaller context window get less.
+func (c *Config) GetContextBudget() int {
+	if c.ContextBudget <= 0 {
+		return 16000
+	}
+	return c.ContextBudget
+}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
-		Provider:     ProviderGrok,
-		Model:        "grok-3",
-		OllamaURL:    "http://localhost:11434",
-		Timeout:      60,
-		CheckUpdates: true,
+		Provider:          ProviderGrok,
+		Model:             "grok-3",
+		OllamaURL:         "http://localhost:11434",
+		Timeout:           60,
+		CheckUpdates:      true,
+		ConversationTurns: 10,
 	}
 }
 
@@ -85,28 +379,44 @@ func GetConfigPath() (string, error) {
 func Load() (*Config, error) {
 	// Check if we can load entirely from environment variables
 	if envProvider := os.Getenv(EnvProvider); envProvider != "" {
-		cfg := loadFromEnv()
-		if cfg.Provider != "" && (cfg.APIKey != "" || cfg.Provider == ProviderOllama) {
+		cfg := LoadEnv()
+		if cfg.Provider != "" && (cfg.APIKey != "" || !RequiresAPIKey(cfg.Provider)) {
 			return cfg, nil
 		}
 	}
 
-	configPath, err := GetConfigPath()
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	cfg, err := LoadFile()
+	if os.IsNotExist(err) {
 		// Try loading from env vars only
-		cfg := loadFromEnv()
-		if cfg.Provider != "" && (cfg.APIKey != "" || cfg.Provider == ProviderOllama) {
+		cfg := LoadEnv()
+		if cfg.Provider != "" && (cfg.APIKey != "" || !RequiresAPIKey(cfg.Provider)) {
 			return cfg, nil
 		}
 		return nil, fmt.Errorf("config not found. Run 'aiask config' to set up, or set AIASK_PROVIDER and AIASK_API_KEY environment variables")
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply environment variable overrides (env vars take precedence)
+	applyEnvOverrides(cfg)
+
+	return cfg, nil
+}
+
+// LoadFile loads the config file without environment variable overrides, for
+// changing and saving it. The error satisfies os.IsNotExist if there is no
+// config file.
+func LoadFile() (*Config, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
 
 	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -115,15 +425,12 @@ func Load() (*Config, error) {
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
-
-	// Apply environment variable overrides (env vars take precedence)
-	applyEnvOverrides(cfg)
-
 	return cfg, nil
 }
 
-// loadFromEnv creates a config entirely from environment variables
-func loadFromEnv() *Config {
+// LoadEnv creates a config entirely from environment variables, with defaults
+// for everything they leave unset
+func LoadEnv() *Config {
 	cfg := DefaultConfig()
 
 	if provider := os.Getenv(EnvProvider); provider != "" {
@@ -143,6 +450,22 @@ func loadFromEnv() *Config {
 		cfg.OllamaURL = ollamaURL
 	}
 
+	if baseURL := os.Getenv(EnvBaseURL); baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+
+	if deployment := os.Getenv(EnvAzureDeployment); deployment != "" {
+		cfg.Deployment = deployment
+	}
+
+	if apiVersion := os.Getenv(EnvAzureAPIVersion); apiVersion != "" {
+		cfg.APIVersion = apiVersion
+	}
+
+	if cassette := os.Getenv(EnvCassette); cassette != "" {
+		cfg.Cassette = cassette
+	}
+
 	if timeout := os.Getenv(EnvTimeout); timeout != "" {
 		if t, err := strconv.Atoi(timeout); err == nil {
 			cfg.Timeout = t
@@ -174,6 +497,22 @@ func applyEnvOverrides(cfg *Config) {
 		cfg.OllamaURL = ollamaURL
 	}
 
+	if baseURL := os.Getenv(EnvBaseURL); baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+
+	if deployment := os.Getenv(EnvAzureDeployment); deployment != "" {
+		cfg.Deployment = deployment
+	}
+
+	if apiVersion := os.Getenv(EnvAzureAPIVersion); apiVersion != "" {
+		cfg.APIVersion = apiVersion
+	}
+
+	if cassette := os.Getenv(EnvCassette); cassette != "" {
+		cfg.Cassette = cassette
+	}
+
 	if timeout := os.Getenv(EnvTimeout); timeout != "" {
 		if t, err := strconv.Atoi(timeout); err == nil {
 			cfg.Timeout = t
@@ -227,6 +566,8 @@ func GetDefaultModel(provider Provider) string {
 		return "gemini-2.0-flash"
 	case ProviderOllama:
 		return "llama3.2"
+	case ProviderReplay:
+		return "cassette"
 	default:
 		return ""
 	}
@@ -249,6 +590,45 @@ func GetProviderURL(provider Provider, ollamaURL string) string {
 	}
 }
 
+// GetBaseURL returns the API URL of an OpenAI-compatible provider, preferring
+// the configured base_url over the provider's default. Ollama uses ollama_url.
+func (c *Config) GetBaseURL() string {
+	if c.BaseURL != "" && c.Provider != ProviderOllama {
+		return strings.TrimRight(c.BaseURL, "/")
+	}
+	return GetProviderURL(c.Provider, c.OllamaURL)
+}
+
+// GetOllamaURL returns the address of the Ollama server
+func (c *Config) GetOllamaURL() string {
+	if c.OllamaURL == "" {
+		return "http://localhost:11434"
+	}
+	return strings.TrimRight(c.OllamaURL, "/")
+}
+
+// GetDeployment returns the Azure OpenAI deployment name, which defaults to the model name
+func (c *Config) GetDeployment() string {
+	if c.Deployment != "" {
+		return c.Deployment
+	}
+	return c.Model
+}
+
+// GetAPIVersion returns the Azure OpenAI API version
+func (c *Config) GetAPIVersion() string {
+	if c.APIVersion == "" {
+		return "2024-10-21"
+	}
+	return c.APIVersion
+}
+
+// RequiresAPIKey reports whether a provider cannot be used without an API key.
+// Local and self-hosted servers often don't need one, and replay makes no requests.
+func RequiresAPIKey(provider Provider) bool {
+	return provider != ProviderOllama && provider != ProviderOpenAICompatible && provider != ProviderReplay
+}
+
 // ValidProviders returns a list of valid provider names
 func ValidProviders() []string {
 	return []string{
@@ -257,6 +637,8 @@ func ValidProviders() []string {
 		string(ProviderAnthropic),
 		string(ProviderGemini),
 		string(ProviderOllama),
+		string(ProviderAzure),
+		string(ProviderOpenAICompatible),
+		string(ProviderReplay),
 	}
 }
-
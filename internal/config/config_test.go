@@ -0,0 +1,87 @@
+package config
+
+import "testing"
+
+func TestOverride(t *testing.T) {
+	for _, name := range []string{EnvAPIKey, EnvModel, EnvBaseURL} {
+		t.Setenv(name, "")
+	}
+	cfg := &Config{
+		Provider: ProviderOpenAI,
+		APIKey:   "sk-openai",
+		Model:    "gpt-4o",
+		Timeout:  60,
+		Fallbacks: []ProviderConfig{
+			{Provider: ProviderAnthropic, APIKey: "sk-ant"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		overrides Overrides
+		provider  Provider
+		apiKey    string
+		model     string
+		timeout   int
+		wantErr   bool
+	}{
+		{"no overrides", Overrides{}, ProviderOpenAI, "sk-openai", "gpt-4o", 60, false},
+		{"model and timeout", Overrides{Model: "gpt-4o-mini", Timeout: 5}, ProviderOpenAI, "sk-openai", "gpt-4o-mini", 5, false},
+		{"same provider", Overrides{Provider: ProviderOpenAI}, ProviderOpenAI, "sk-openai", "gpt-4o", 60, false},
+		{"provider from fallback", Overrides{Provider: ProviderAnthropic}, ProviderAnthropic, "sk-ant", "claude-sonnet-4-20250514", 60, false},
+		{"local provider", Overrides{Provider: ProviderOllama, Model: "qwen2.5-coder"}, ProviderOllama, "", "qwen2.5-coder", 60, false},
+		{"provider without a key", Overrides{Provider: ProviderGemini}, "", "", "", 0, true},
+		{"unknown provider", Overrides{Provider: "nope"}, "", "", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := cfg.Override(tt.overrides)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got.Provider != tt.provider || got.APIKey != tt.apiKey || got.Model != tt.model || got.Timeout != tt.timeout {
+			t.Errorf("%s: got %s/%s/%s/%d", tt.name, got.Provider, got.APIKey, got.Model, got.Timeout)
+		}
+		// Fallbacks only apply when the provider is unchanged
+		if (len(got.Fallbacks) > 0) != (got.Provider == ProviderOpenAI) {
+			t.Errorf("%s: fallbacks = %v", tt.name, got.Fallbacks)
+		}
+	}
+
+	if cfg.Model != "gpt-4o" || cfg.Timeout != 60 {
+		t.Error("Override changed the original config")
+	}
+}
+
+func TestOverrideFromEnv(t *testing.T) {
+	t.Setenv(EnvProvider, "")
+	t.Setenv(EnvAPIKey, "sk-env")
+	t.Setenv(EnvModel, "gpt-4o-mini")
+	t.Setenv(EnvBaseURL, "https://gateway.example.com/v1")
+
+	// Without a config file, the environment describes the provider switched to
+	got, err := LoadEnv().Override(Overrides{Provider: ProviderOpenAI})
+	if err != nil {
+		t.Fatalf("Override returned error: %v", err)
+	}
+	if got.Provider != ProviderOpenAI || got.APIKey != "sk-env" || got.Model != "gpt-4o-mini" || got.BaseURL != "https://gateway.example.com/v1" {
+		t.Errorf("got %s/%s/%s/%s", got.Provider, got.APIKey, got.Model, got.BaseURL)
+	}
+
+	// A fallback entry's own settings come first, and --model beats the environment
+	cfg := &Config{Provider: ProviderOpenAI, Fallbacks: []ProviderConfig{{Provider: ProviderAnthropic, APIKey: "sk-ant"}}}
+	got, err = cfg.Override(Overrides{Provider: ProviderAnthropic, Model: "claude-3-5-haiku-latest"})
+	if err != nil {
+		t.Fatalf("Override returned error: %v", err)
+	}
+	if got.APIKey != "sk-ant" || got.Model != "claude-3-5-haiku-latest" {
+		t.Errorf("got %s/%s", got.APIKey, got.Model)
+	}
+}
@@ -0,0 +1,39 @@
+package context
+
+// projectMarkers maps files that identify a kind of project to its name
+var projectMarkers = []struct {
+	pattern string
+	name    string
+}{
+	{"go.mod", "Go"},
+	{"package.json", "Node.js"},
+	{"Cargo.toml", "Rust"},
+	{"pyproject.toml", "Python"},
+	{"requirements.txt", "Python"},
+	{"Gemfile", "Ruby"},
+	{"pom.xml", "Maven"},
+	{"build.gradle*", "Gradle"},
+	{"composer.json", "PHP"},
+	{"*.csproj", ".NET"},
+	{"*.sln", ".NET"},
+	{"CMakeLists.txt", "CMake"},
+	{"Makefile", "Make"},
+	{"Dockerfile", "Docker"},
+	{"docker-compose.y*ml", "Docker Compose"},
+	{"compose.y*ml", "Docker Compose"},
+	{"*.tf", "Terraform"},
+}
+
+// GetProjectTypes returns the kinds of project the current directory holds,
+// detected from marker files such as go.mod or package.json
+func GetProjectTypes() []string {
+	var types []string
+	seen := map[string]bool{}
+	for _, marker := range projectMarkers {
+		if !seen[marker.name] && HasFiles(marker.pattern) {
+			types = append(types, marker.name)
+			seen[marker.name] = true
+		}
+	}
+	return types
+}
@@ -0,0 +1,339 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultBudget is the number of bytes of documentation sent with a command
+const DefaultBudget = 6000
+
+// lookupTimeout bounds how long man or --help may run for one program
+const lookupTimeout = 3 * time.Second
+
+// maxSectionLines is the number of lines taken from the documentation of one flag
+const maxSectionLines = 6
+
+// wrappers are programs that run the command that follows them
+var wrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "time": true, "nohup": true,
+	"nice": true, "command": true, "exec": true, "builtin": true,
+}
+
+var (
+	// overstrikeRegex matches the backspace sequences man uses for bold and underline
+	overstrikeRegex = regexp.MustCompile(".\x08")
+	// assignmentRegex matches environment assignments before a command, e.g. FOO=bar
+	assignmentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	// subcommandRegex matches subcommand names such as "commit" in "git commit"
+	subcommandRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+)
+
+// Invocation is a program and the flags it is called with
+type Invocation struct {
+	Program    string
+	Subcommand string // First plain argument, used to find pages like git-commit
+	Flags      []string
+}
+
+// Reference is the documentation found for an invocation
+type Reference struct {
+	Program    string
+	Source     string   // The man page or --help command the text came from
+	Text       string   // Excerpts for the flags used
+	Verified   []string // Flags found in the documentation
+	Unverified []string // Flags not found
+}
+
+// Note describes which flags were checked against the documentation, e.g.
+// "Verified against `man tar`: -x -f (not found: -Q)". A reference without
+// verified flags is only noted as the source, e.g. "Based on `man ls`".
+func (r Reference) Note() string {
+	note := fmt.Sprintf("Based on `%s`", r.Source)
+	if len(r.Verified) > 0 {
+		note = fmt.Sprintf("Verified against `%s`: %s", r.Source, strings.Join(r.Verified, " "))
+	}
+	if len(r.Unverified) > 0 {
+		note += fmt.Sprintf(" (not found: %s)", strings.Join(r.Unverified, " "))
+	}
+	return note
+}
+
+// Parse splits a command line into the programs it runs and their flags
+func Parse(command string) []Invocation {
+	var invocations []Invocation
+	for _, words := range segments(command) {
+		// Skip environment assignments and wrappers like sudo
+		for len(words) > 1 && (assignmentRegex.MatchString(words[0]) || (wrappers[words[0]] && !strings.HasPrefix(words[1], "-"))) {
+			words = words[1:]
+		}
+		// Redirections after a subshell, e.g. $(ls) > out, are not commands
+		if len(words) == 0 || assignmentRegex.MatchString(words[0]) || strings.ContainsAny(words[0][:1], "<>") {
+			continue
+		}
+
+		inv := Invocation{Program: filepath.Base(words[0])}
+		seen := map[string]bool{}
+		for i, word := range words[1:] {
+			if i == 0 && subcommandRegex.MatchString(word) {
+				inv.Subcommand = word
+			}
+			if !strings.HasPrefix(word, "-") || word == "-" || word == "--" {
+				continue
+			}
+			flag, _, _ := strings.Cut(word, "=")
+			if !seen[flag] {
+				seen[flag] = true
+				inv.Flags = append(inv.Flags, flag)
+			}
+		}
+		invocations = append(invocations, inv)
+	}
+	return invocations
+}
+
+// segments splits a command line into the words of each simple command,
+// honoring quotes and splitting at pipes, lists and subshells
+func segments(command string) [][]string {
+	var result [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	// Empty words such as "" are dropped; they name no program or flag
+	endWord := func() {
+		if inWord && word.Len() > 0 {
+			words = append(words, word.String())
+		}
+		word.Reset()
+		inWord = false
+	}
+	endSegment := func() {
+		endWord()
+		if len(words) > 0 {
+			result = append(result, words)
+			words = nil
+		}
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t':
+			endWord()
+		case strings.ContainsRune("|&;\n()`", r) || (r == '$' && i+1 < len(runes) && runes[i+1] == '('):
+			endSegment()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endSegment()
+	return result
+}
+
+// Lookup finds local documentation for each program in a command, taken from
+// its man page or, for programs in helpCommands, its --help output. Programs
+// that are not installed or have no documentation are left out.
+func Lookup(ctx context.Context, command string, helpCommands []string) []Reference {
+	var refs []Reference
+	seen := map[string]bool{}
+	for _, inv := range Parse(command) {
+		if seen[inv.Program+" "+inv.Subcommand] {
+			continue
+		}
+		seen[inv.Program+" "+inv.Subcommand] = true
+
+		source, text := document(ctx, inv, helpCommands)
+		if text == "" {
+			continue
+		}
+		ref := Reference{Program: inv.Program, Source: source}
+		ref.Text, ref.Verified, ref.Unverified = excerpt(text, inv.Flags)
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// document returns the documentation of an invoked program and where it came from
+func document(ctx context.Context, inv Invocation, helpCommands []string) (string, string) {
+	if _, err := exec.LookPath(inv.Program); err != nil {
+		return "", ""
+	}
+
+	if _, err := exec.LookPath("man"); err == nil {
+		var pages []string
+		if inv.Subcommand != "" {
+			pages = append(pages, inv.Program+"-"+inv.Subcommand)
+		}
+		for _, page := range append(pages, inv.Program) {
+			if text := run(ctx, "man", page); text != "" {
+				return "man " + page, text
+			}
+		}
+	}
+
+	for _, allowed := range helpCommands {
+		if allowed == inv.Program {
+			path, _ := exec.LookPath(inv.Program)
+			return inv.Program + " --help", run(ctx, path, "--help")
+		}
+	}
+	return "", ""
+}
+
+// run runs a program without input and returns its output, with man's
+// formatting removed
+func run(ctx context.Context, name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=100")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// Many programs exit with an error status after printing their help
+	_ = cmd.Run()
+	if ctx.Err() != nil {
+		return ""
+	}
+
+	text := overstrikeRegex.ReplaceAllString(out.String(), "")
+	if strings.Contains(text, "No manual entry") {
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
+
+// excerpt returns the summary of a document and the sections describing the
+// given flags, along with which flags were found
+func excerpt(text string, flags []string) (string, []string, []string) {
+	lines := strings.Split(text, "\n")
+	var b strings.Builder
+	b.WriteString(summary(lines))
+
+	var verified, unverified []string
+	for _, flag := range flags {
+		if section := flagSection(lines, flag); section != "" {
+			b.WriteString("\n" + section)
+			verified = append(verified, flag)
+			continue
+		}
+
+		// Try a cluster of short flags like -xzf one letter at a time
+		if len(flag) > 2 && flag[1] != '-' {
+			all := true
+			var sections []string
+			for _, letter := range flag[1:] {
+				section := flagSection(lines, "-"+string(letter))
+				if section == "" {
+					all = false
+					break
+				}
+				sections = append(sections, section)
+			}
+			if all {
+				b.WriteString("\n" + strings.Join(sections, "\n"))
+				verified = append(verified, flag)
+				continue
+			}
+		}
+		unverified = append(unverified, flag)
+	}
+	return b.String(), verified, unverified
+}
+
+// summary returns the one-line description from the NAME section, or the
+// first line of --help output
+func summary(lines []string) string {
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "NAME" && i+1 < len(lines) {
+			return strings.TrimSpace(lines[i+1])
+		}
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// flagSection returns the lines documenting a flag: the line defining it and
+// the more indented description lines that follow
+func flagSection(lines []string, flag string) string {
+	definition := regexp.MustCompile(`^\s*(?:-[-\w]+(?:[ =]\S+)?,\s*)*` + regexp.QuoteMeta(flag) + `(?:$|[\s,=\[<])`)
+	for i, line := range lines {
+		if !definition.MatchString(line) {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		section := []string{strings.TrimSpace(line)}
+		for _, next := range lines[i+1:] {
+			if len(section) == maxSectionLines || strings.TrimSpace(next) == "" {
+				break
+			}
+			// Stop at the next option, even if it is indented further
+			trimmed := strings.TrimLeft(next, " \t")
+			if len(next)-len(trimmed) <= indent || strings.HasPrefix(trimmed, "-") {
+				break
+			}
+			section = append(section, "  "+strings.TrimSpace(next))
+		}
+		return strings.Join(section, "\n")
+	}
+	return ""
+}
+
+// Format combines references into reference text for the model, sharing the
+// budget evenly between the programs
+func Format(refs []Reference, budget int) string {
+	if len(refs) == 0 {
+		return ""
+	}
+	if budget <= 0 {
+		budget = DefaultBudget
+	}
+	share := budget / len(refs)
+
+	var parts []string
+	for _, ref := range refs {
+		text := ref.Text
+		if len(text) > share {
+			text = truncate(text, share) + "\n... (truncated)"
+		}
+		parts = append(parts, fmt.Sprintf("From `%s`:\n%s", ref.Source, text))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// truncate cuts a text to at most n bytes without splitting a character
+func truncate(text string, n int) string {
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
@@ -0,0 +1,125 @@
+package docs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected []Invocation
+	}{
+		{
+			`tar -xzvf "my archive.tgz" -C /tmp`,
+			[]Invocation{{Program: "tar", Flags: []string{"-xzvf", "-C"}}},
+		},
+		{
+			`sudo LANG=C /usr/bin/grep -rn --include='*.go' "a|b" . | sort -u`,
+			[]Invocation{
+				{Program: "grep", Flags: []string{"-rn", "--include"}},
+				{Program: "sort", Flags: []string{"-u"}},
+			},
+		},
+		{
+			`git commit -m "fix: a && b" --amend; find . -name '*.log' -delete`,
+			[]Invocation{
+				{Program: "git", Subcommand: "commit", Flags: []string{"-m", "--amend"}},
+				{Program: "find", Flags: []string{"-name", "-delete"}},
+			},
+		},
+		{
+			`echo $(ls -la) > out.txt`,
+			[]Invocation{{Program: "echo"}, {Program: "ls", Flags: []string{"-la"}}},
+		},
+		{
+			`"" ls -a; '' | wc -l`,
+			[]Invocation{{Program: "ls", Flags: []string{"-a"}}, {Program: "wc", Flags: []string{"-l"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := Parse(tt.command)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Parse(%q) = %+v, expected %+v", tt.command, got, tt.expected)
+		}
+	}
+}
+
+const tarHelp = `Usage: tar [OPTION...] [FILE]...
+GNU 'tar' saves many files together into a single tape or disk archive.
+
+  -x, --extract, --get       extract files from an archive
+  -v, --verbose              verbosely list files processed
+      --warning=KEYWORD      warning control
+  -f, --file=ARCHIVE         use archive file or device ARCHIVE
+      --exclude=PATTERN      exclude files, given as a PATTERN
+  -z, --gzip, --gunzip, --ungzip   filter the archive through gzip`
+
+const findMan = `FIND(1)                 General Commands Manual                FIND(1)
+
+NAME
+       find - search for files in a directory hierarchy
+
+EXPRESSION
+       -name pattern
+              Base of file name (the path with the leading
+              directories removed) matches shell pattern pattern.
+
+       -newer reference
+              Time of the last data modification of the current file
+              is more recent than that of the last data modification.`
+
+func TestExcerpt(t *testing.T) {
+	text, verified, unverified := excerpt(tarHelp, []string{"-xzvf", "--exclude", "-Q"})
+	if !reflect.DeepEqual(verified, []string{"-xzvf", "--exclude"}) || !reflect.DeepEqual(unverified, []string{"-Q"}) {
+		t.Errorf("verified %v, unverified %v", verified, unverified)
+	}
+	if strings.Contains(text, "--warning") {
+		t.Errorf("excerpt includes the next option:\n%s", text)
+	}
+	if !strings.HasPrefix(text, "Usage: tar") || !strings.Contains(text, "--exclude=PATTERN") {
+		t.Errorf("excerpt = %q", text)
+	}
+
+	text, verified, _ = excerpt(findMan, []string{"-name"})
+	if len(verified) != 1 || !strings.HasPrefix(text, "find - search for files") {
+		t.Errorf("excerpt = %q, verified %v", text, verified)
+	}
+	if !strings.Contains(text, "directories removed") || strings.Contains(text, "-newer") {
+		t.Errorf("excerpt of -name = %q", text)
+	}
+}
+
+func TestFormatBudget(t *testing.T) {
+	refs := []Reference{
+		{Source: "man tar", Text: strings.Repeat("x", 500)},
+		{Source: "man grep", Text: strings.Repeat("y", 50)},
+	}
+	text := Format(refs, 200)
+	if strings.Count(text, "x") != 100 || strings.Count(text, "y") != 50 {
+		t.Errorf("Format did not share the budget: %q", text)
+	}
+	if Format(nil, 200) != "" {
+		t.Error("Format of no references is not empty")
+	}
+
+	// Excerpts are cut between characters
+	text = Format([]Reference{{Source: "man ls", Text: strings.Repeat("é", 100)}}, 51)
+	if !utf8.ValidString(text) || strings.Count(text, "é") != 25 {
+		t.Errorf("Format split a character: %q", text)
+	}
+}
+
+func TestReferenceNote(t *testing.T) {
+	ref := Reference{Source: "tar --help", Verified: []string{"-xzf"}, Unverified: []string{"-Q"}}
+	if got := ref.Note(); got != "Verified against `tar --help`: -xzf (not found: -Q)" {
+		t.Errorf("Note() = %q", got)
+	}
+	ref = Reference{Source: "man ls", Unverified: []string{"-Q"}}
+	if got := ref.Note(); got != "Based on `man ls` (not found: -Q)" {
+		t.Errorf("Note() = %q", got)
+	}
+}
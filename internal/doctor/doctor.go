@@ -0,0 +1,470 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/history"
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/prompts"
+	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/templates"
+	"github.com/Hermithic/aiask/internal/transport"
+	"github.com/Hermithic/aiask/internal/ui"
+)
+
+// slowResponse is the response time above which the latency check warns
+const slowResponse = 10 * time.Second
+
+// testPrompt is the request sent to check that a provider answers
+const testPrompt = "print the current date"
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Check is the result of one diagnostic check
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"` // How to fix a warning or failure
+}
+
+// Report is the result of all checks, with details of the system for bug reports
+type Report struct {
+	Version   string  `json:"version"`
+	OS        string  `json:"os"`
+	Arch      string  `json:"arch"`
+	GoVersion string  `json:"go_version"`
+	Checks    []Check `json:"checks"`
+}
+
+// Count returns the number of checks with the given status
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Options configures which checks are run
+type Options struct {
+	Version string
+
+	// Config is the configuration in effect, or nil if it failed to load
+	// with ConfigErr
+	Config    *config.Config
+	ConfigErr error
+
+	// SkipRequests leaves out the test requests to the providers, which use
+	// a few tokens
+	SkipRequests bool
+
+	// OnCheck, if set, is called as each check completes
+	OnCheck func(Check)
+}
+
+// Run runs all checks
+func Run(ctx context.Context, opts Options) *Report {
+	r := &Report{
+		Version:   opts.Version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+	}
+	add := func(c Check) {
+		r.Checks = append(r.Checks, c)
+		if opts.OnCheck != nil {
+			opts.OnCheck(c)
+		}
+	}
+
+	add(ConfigFile())
+	add(EnvOverrides(os.Getenv))
+	add(Configuration(opts.Config, opts.ConfigErr))
+
+	shellInfo := shell.Detect()
+	add(Shell(shellInfo))
+	add(Clipboard())
+	add(PromptTemplates())
+
+	if opts.Config != nil {
+		network, client := Network(opts.Config.Network)
+		add(network)
+		for _, cfg := range providerConfigs(opts.Config) {
+			if cfg.Provider == config.ProviderReplay {
+				add(Cassette(cfg.Cassette))
+				continue
+			}
+			host := Reachable(ctx, string(cfg.Provider), Endpoint(cfg), client)
+			add(host)
+			if host.Status == Fail || opts.SkipRequests {
+				continue
+			}
+			request, latency := Request(ctx, cfg, shellInfo)
+			add(request)
+			if latency != nil {
+				add(*latency)
+			}
+		}
+	}
+
+	if path, err := history.GetHistoryPath(); err == nil {
+		add(Writable("History file", path))
+	}
+	if path, err := templates.GetTemplatesPath(); err == nil {
+		add(Writable("Templates file", path))
+	}
+	return r
+}
+
+// providerConfigs returns the config of the main provider and of each
+// fallback, so they are checked separately
+func providerConfigs(cfg *config.Config) []*config.Config {
+	main := *cfg
+	main.Fallbacks = nil
+	configs := []*config.Config{&main}
+	for _, fb := range cfg.Fallbacks {
+		configs = append(configs, cfg.WithProvider(fb))
+	}
+	return configs
+}
+
+// ConfigFile checks that the config file exists and parses
+func ConfigFile() Check {
+	c := Check{Name: "Config file"}
+	path, err := config.GetConfigPath()
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Hint = "Set HOME (or USERPROFILE on Windows) so the config directory can be found"
+		return c
+	}
+
+	_, err = config.LoadFile()
+	switch {
+	case os.IsNotExist(err):
+		c.Status, c.Detail = Warn, "not found at "+path
+		c.Hint = "Run 'aiask config' to create it, or set AIASK_PROVIDER and AIASK_API_KEY"
+	case err != nil:
+		c.Status, c.Detail = Fail, err.Error()
+		c.Hint = fmt.Sprintf("Fix the YAML in %s, or run 'aiask config' to rewrite it", path)
+	default:
+		c.Status, c.Detail = Pass, path
+	}
+	return c
+}
+
+// EnvOverrides lists the environment variables that override the config file
+func EnvOverrides(getenv func(string) string) Check {
+	names := []string{
+		config.EnvProvider, config.EnvAPIKey, config.EnvModel, config.EnvOllamaURL,
+		config.EnvBaseURL, config.EnvAzureDeployment, config.EnvAzureAPIVersion,
+		config.EnvCassette, config.EnvTimeout, config.EnvSystemPromptSuffix,
+	}
+
+	var active []string
+	for _, name := range names {
+		value := getenv(name)
+		if value == "" {
+			continue
+		}
+		if name == config.EnvAPIKey {
+			value = maskSecret(value)
+		}
+		active = append(active, name+"="+value)
+	}
+
+	c := Check{Name: "Environment overrides", Status: Pass, Detail: "none"}
+	if len(active) > 0 {
+		c.Detail = strings.Join(active, ", ")
+		c.Hint = "Environment variables take precedence over the config file"
+	}
+	return c
+}
+
+// Configuration checks that the configuration in effect loaded
+func Configuration(cfg *config.Config, err error) Check {
+	c := Check{Name: "Configuration"}
+	if cfg == nil {
+		c.Status, c.Detail = Fail, fmt.Sprint(err)
+		c.Hint = "Run 'aiask config' to set up a provider"
+		return c
+	}
+
+	c.Status = Pass
+	c.Detail = fmt.Sprintf("%s, model %s, timeout %s", cfg.Provider, cfg.Model, cfg.GetTimeout())
+	if len(cfg.Fallbacks) > 0 {
+		c.Detail += fmt.Sprintf(", %d fallbacks", len(cfg.Fallbacks))
+	}
+	if cfg.APIKey == "" && config.RequiresAPIKey(cfg.Provider) {
+		c.Status = Fail
+		c.Detail += ", no API key"
+		c.Hint = "Run 'aiask config' or set AIASK_API_KEY"
+	}
+	return c
+}
+
+// Shell checks which shell commands are generated for and which binary runs them
+func Shell(info shell.ShellInfo) Check {
+	c := Check{Name: "Shell", Status: Pass}
+
+	var path string
+	if runtime.GOOS == "windows" {
+		name := "powershell"
+		if info.Shell == shell.ShellCmd {
+			name = "cmd"
+		}
+		path, _ = exec.LookPath(name)
+	} else {
+		path = ui.ShellPath(info.Shell)
+	}
+	c.Detail = fmt.Sprintf("%s (%s)", shell.GetShellName(info.Shell), path)
+
+	if _, err := os.Stat(path); path == "" || err != nil {
+		c.Status = Fail
+		c.Detail = fmt.Sprintf("%s, but no shell binary was found", shell.GetShellName(info.Shell))
+		c.Hint = "Set SHELL to the full path of your shell"
+	} else if info.Shell == shell.ShellUnknown {
+		c.Status = Warn
+		c.Hint = "Set SHELL to the full path of your shell so commands use its syntax"
+	}
+	return c
+}
+
+// Clipboard checks that commands can be copied to the clipboard
+func Clipboard() Check {
+	c := Check{Name: "Clipboard", Status: Pass, Detail: "available"}
+	if !ui.ClipboardAvailable() {
+		c.Status, c.Detail = Warn, "no clipboard backend found"
+		c.Hint = "Install xclip or xsel (X11), or wl-clipboard (Wayland), to copy commands"
+	}
+	return c
+}
+
+// Endpoint returns the URL a provider's requests are sent to
+func Endpoint(cfg *config.Config) string {
+	switch cfg.Provider {
+	case config.ProviderAnthropic:
+		return "https://api.anthropic.com"
+	case config.ProviderGemini:
+		return "https://generativelanguage.googleapis.com"
+	case config.ProviderOllama:
+		return cfg.GetOllamaURL()
+	default:
+		return cfg.GetBaseURL()
+	}
+}
+
+// Reachable checks that a provider's host answers HTTP requests. Any HTTP
+// response counts, since the check is not authenticated.
+func Reachable(ctx context.Context, provider, url string, client *http.Client) Check {
+	c := Check{Name: provider + " host"}
+	if url == "" {
+		c.Status, c.Detail = Fail, "no URL configured"
+		c.Hint = "Set base_url in the config file or AIASK_BASE_URL"
+		return c
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Hint = "Check the URL in the config file"
+		return c
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		c.Status, c.Detail = Fail, fmt.Sprintf("%s: %s", url, unwrapURLError(err))
+		c.Hint = "Check the URL, your network connection and proxy settings (network.proxy or HTTPS_PROXY)"
+		if provider == string(config.ProviderOllama) {
+			c.Hint = "Start the Ollama server with 'ollama serve', or check ollama_url"
+		}
+		return c
+	}
+	resp.Body.Close()
+
+	c.Status = Pass
+	c.Detail = fmt.Sprintf("%s (HTTP %d in %s)", url, resp.StatusCode, ui.FormatDuration(time.Since(start).Seconds()))
+	return c
+}
+
+// Cassette checks that the replay provider's cassette can be read
+func Cassette(path string) Check {
+	c := Check{Name: "replay cassette"}
+	if _, err := llm.LoadCassette(path); err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Hint = "Record a cassette with --record, and set cassette or AIASK_CASSETTE to its path"
+		return c
+	}
+	c.Status, c.Detail = Pass, path
+	return c
+}
+
+// Network checks the proxy and TLS settings, and returns an HTTP client that
+// uses them, or the default client if they are invalid
+func Network(cfg *config.NetworkConfig) (Check, *http.Client) {
+	c := Check{Name: "Network settings", Status: Pass, Detail: transport.Describe(cfg)}
+	t, err := transport.Shared(cfg)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Hint = "Fix the network section of the config file"
+		return c, http.DefaultClient
+	}
+	if cfg != nil && cfg.InsecureSkipVerify {
+		c.Status = Warn
+		c.Hint = "insecure_skip_verify is for testing only; trust your proxy's CA with ca_cert instead"
+	}
+	return c, &http.Client{Transport: t}
+}
+
+// PromptTemplates checks that the user's prompt template overrides render
+func PromptTemplates() Check {
+	c := Check{Name: "Prompt templates", Status: Pass}
+	var overridden []string
+	for _, task := range prompts.Tasks {
+		_, path, err := prompts.Source(task)
+		if err == nil && path != "" {
+			overridden = append(overridden, task)
+			err = prompts.Check(task)
+		}
+		if err != nil {
+			c.Status, c.Detail = Fail, err.Error()
+			c.Hint = fmt.Sprintf("Fix it with 'aiask prompts edit %s', or run 'aiask prompts reset %s'", task, task)
+			return c
+		}
+	}
+	if len(overridden) == 0 {
+		c.Detail = "built-in"
+	} else {
+		c.Detail = "overridden: " + strings.Join(overridden, ", ")
+	}
+	return c
+}
+
+// Request sends a small test request to a provider to check that the API key
+// and model work, and reports how long it took. The latency check is nil if
+// the request failed.
+func Request(ctx context.Context, cfg *config.Config, shellInfo shell.ShellInfo) (Check, *Check) {
+	c := Check{Name: fmt.Sprintf("%s request", cfg.Provider)}
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Hint = "Run 'aiask config' to fix the provider settings"
+		return c, nil
+	}
+	defer llm.CloseProvider(provider)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.GetTimeout())
+	defer cancel()
+	start := time.Now()
+	result, err := provider.GenerateCommand(ctx, llm.GenerateRequest{Prompt: testPrompt, ShellInfo: shellInfo})
+	elapsed := time.Since(start)
+	if err != nil {
+		c.Status, c.Detail, c.Hint = Fail, err.Error(), requestHint(err, cfg)
+		return c, nil
+	}
+
+	c.Status = Pass
+	c.Detail = fmt.Sprintf("model %s answered `%s`", cfg.Model, result.Command())
+	if cfg.APIKey != "" {
+		c.Detail = "authenticated; " + c.Detail
+	}
+
+	latency := Check{Name: fmt.Sprintf("%s latency", cfg.Provider), Status: Pass, Detail: ui.FormatDuration(elapsed.Seconds())}
+	if elapsed > slowResponse {
+		latency.Status = Warn
+		latency.Hint = "Responses are slow; try a smaller model, or check the server's load"
+	}
+	return c, &latency
+}
+
+// requestHint suggests how to fix a failed test request
+func requestHint(err error, cfg *config.Config) string {
+	switch code := llm.StatusCode(err); {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return "The API key was rejected; update it with 'aiask config' or AIASK_API_KEY"
+	case code == http.StatusNotFound:
+		return fmt.Sprintf("The model %s may not exist; list the available ones with 'aiask models'", cfg.Model)
+	case code == http.StatusTooManyRequests:
+		return "The provider is rate limiting requests, or the account is out of credits"
+	case code >= 500:
+		return "The provider had a server error; try again later"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Sprintf("No answer within %s; raise it with --timeout or timeout in the config", cfg.GetTimeout())
+	}
+	return "Run with --verbose to see the request details"
+}
+
+// Writable checks that a data file can be written, or created if it doesn't
+// exist yet
+func Writable(name, path string) Check {
+	c := Check{Name: name, Status: Pass, Detail: path}
+	if f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0); err == nil {
+		f.Close()
+		return c
+	} else if !os.IsNotExist(err) {
+		c.Status = Fail
+		c.Detail = err.Error()
+		c.Hint = fmt.Sprintf("Fix the permissions of %s", path)
+		return c
+	}
+
+	// The file is created on first use, so check the closest existing directory
+	dir := filepath.Dir(path)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	f, err := os.CreateTemp(dir, ".aiask-doctor-*")
+	if err != nil {
+		c.Status = Fail
+		c.Detail = fmt.Sprintf("%s can't be created: %s", path, err)
+		c.Hint = fmt.Sprintf("Fix the permissions of %s", dir)
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	c.Detail = path + " (not created yet)"
+	return c
+}
+
+// maskSecret hides all but the ends of a secret
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + strings.Repeat("*", len(s)-8) + s[len(s)-4:]
+}
+
+// unwrapURLError returns the cause of a failed HTTP request without the
+// repeated method and URL
+func unwrapURLError(err error) error {
+	if cause := errors.Unwrap(err); cause != nil {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	env := map[string]string{
+		config.EnvModel:  "gpt-4o-mini",
+		config.EnvAPIKey: "sk-abcdefghijklmnop",
+	}
+	c := EnvOverrides(func(name string) string { return env[name] })
+	if c.Status != Pass {
+		t.Errorf("status = %s, expected pass", c.Status)
+	}
+	if !strings.Contains(c.Detail, "AIASK_MODEL=gpt-4o-mini") || !strings.Contains(c.Detail, "AIASK_API_KEY=sk-a***********mnop") {
+		t.Errorf("detail = %q", c.Detail)
+	}
+
+	if c := EnvOverrides(func(string) string { return "" }); c.Detail != "none" || c.Hint != "" {
+		t.Errorf("without overrides: detail = %q, hint = %q", c.Detail, c.Hint)
+	}
+}
+
+func TestConfiguration(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		err      error
+		expected Status
+	}{
+		{"loaded", &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o", APIKey: "sk-1"}, nil, Pass},
+		{"missing key", &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o"}, nil, Fail},
+		{"local provider", &config.Config{Provider: config.ProviderOllama, Model: "llama3"}, nil, Pass},
+		{"load error", nil, fmt.Errorf("no configuration found"), Fail},
+	}
+
+	for _, tt := range tests {
+		if c := Configuration(tt.cfg, tt.err); c.Status != tt.expected {
+			t.Errorf("%s: status = %s, expected %s (%s)", tt.name, c.Status, tt.expected, c.Detail)
+		}
+	}
+}
+
+func TestWritable(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "history.json")
+	if err := os.WriteFile(existing, []byte("[]"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := Writable("History file", existing); c.Status != Pass {
+		t.Errorf("existing file: status = %s (%s)", c.Status, c.Detail)
+	}
+	if c := Writable("History file", filepath.Join(dir, "new", "history.json")); c.Status != Pass || !strings.Contains(c.Detail, "not created yet") {
+		t.Errorf("new file: status = %s (%s)", c.Status, c.Detail)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected the check to leave no files behind, found %d entries", len(entries))
+	}
+
+	if runtime.GOOS == "windows" || os.Getuid() == 0 {
+		t.Skip("permissions are not enforced")
+	}
+	readOnly := filepath.Join(dir, "readonly")
+	if err := os.Mkdir(readOnly, 0500); err != nil {
+		t.Fatal(err)
+	}
+	if c := Writable("Templates file", filepath.Join(readOnly, "templates.yaml")); c.Status != Fail || c.Hint == "" {
+		t.Errorf("read-only directory: status = %s, hint = %q", c.Status, c.Hint)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	url := server.URL
+
+	if c := Reachable(context.Background(), "openai", url, server.Client()); c.Status != Pass || !strings.Contains(c.Detail, "HTTP 404") {
+		t.Errorf("running server: status = %s (%s)", c.Status, c.Detail)
+	}
+
+	server.Close()
+	c := Reachable(context.Background(), "ollama", url, http.DefaultClient)
+	if c.Status != Fail || !strings.Contains(c.Hint, "ollama serve") {
+		t.Errorf("stopped server: status = %s, hint = %q", c.Status, c.Hint)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected Status
+		hint     string
+	}{
+		{"success", http.StatusOK, Pass, ""},
+		{"bad key", http.StatusUnauthorized, Fail, "API key was rejected"},
+		{"unknown model", http.StatusNotFound, Fail, "aiask models"},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if tt.status != http.StatusOK {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, `{"error":{"message":"failed"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"date\"]}"}}]}`)
+		}))
+
+		cfg := &config.Config{
+			Provider: config.ProviderOpenAICompatible,
+			Model:    "local",
+			APIKey:   "sk-1",
+			BaseURL:  server.URL + "/v1/",
+			Retry:    &config.RetryConfig{MaxAttempts: 1},
+		}
+		c, latency := Request(context.Background(), cfg, shell.ShellInfo{Shell: shell.ShellBash})
+		server.Close()
+
+		if c.Status != tt.expected || !strings.Contains(c.Hint, tt.hint) {
+			t.Errorf("%s: status = %s, hint = %q (%s)", tt.name, c.Status, c.Hint, c.Detail)
+		}
+		if (latency != nil) != (tt.status == http.StatusOK) {
+			t.Errorf("%s: latency check = %v", tt.name, latency)
+		}
+	}
+}
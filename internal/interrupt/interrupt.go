@@ -0,0 +1,61 @@
+package interrupt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// ExitCode is the exit status after an interrupted request, the same a shell
+// reports for a process killed by SIGINT
+const ExitCode = 130
+
+// ErrInterrupted is the cause of a context cancelled by Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// WithTimeout returns a context that is cancelled after timeout or when the
+// user presses Ctrl-C. A second Ctrl-C before cancel is called exits the
+// process immediately. Calling cancel stops listening for Ctrl-C.
+func WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+			cancelCause(ErrInterrupted)
+		case <-done:
+			return
+		}
+		// The request may take a moment to wind down; a second Ctrl-C force-quits
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr)
+			os.Exit(ExitCode)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+			cancelTimeout()
+			cancelCause(context.Canceled)
+		})
+	}
+}
+
+// Interrupted reports whether ctx was cancelled by Ctrl-C
+func Interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrInterrupted)
+}
@@ -0,0 +1,42 @@
+package interrupt
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithTimeoutInterrupt(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot send an interrupt on this platform: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled by the interrupt")
+	}
+	if !Interrupted(ctx) {
+		t.Errorf("Interrupted() = false, cause %v", context.Cause(ctx))
+	}
+}
+
+func TestWithTimeoutNotInterrupted(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), time.Millisecond)
+	<-ctx.Done()
+	if Interrupted(ctx) {
+		t.Error("Interrupted() = true after a timeout")
+	}
+	cancel()
+	if Interrupted(ctx) {
+		t.Error("Interrupted() = true after cancel")
+	}
+}
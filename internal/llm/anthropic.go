@@ -3,12 +3,19 @@ package llm
 import (
 	"context"
 	"fmt"
+	"net/http"
 
-	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/probe"
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
+// submitCommandTool is the name of the tool Claude uses to return a structured command result
+const submitCommandTool = "submit_command"
+
+// submitReviewTool is the tool the model calls to submit a review
+const submitReviewTool = "submit_review"
+
 // Anthropic is a provider for Anthropic's Claude API
 type Anthropic struct {
 	client             anthropic.Client
@@ -17,13 +24,16 @@ type Anthropic struct {
 }
 
 // NewAnthropic creates a new Anthropic provider
-func NewAnthropic(apiKey, model, systemPromptSuffix string) (*Anthropic, error) {
+// Requests are sent through httpClient, which handles retries
+func NewAnthropic(apiKey, model, systemPromptSuffix string, httpClient *http.Client) (*Anthropic, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("API key is required for Anthropic")
 	}
 
 	client := anthropic.NewClient(
 		option.WithAPIKey(apiKey),
+		option.WithHTTPClient(httpClient),
+		option.WithMaxRetries(0),
 	)
 
 	return &Anthropic{
@@ -34,8 +44,13 @@ func NewAnthropic(apiKey, model, systemPromptSuffix string) (*Anthropic, error)
 }
 
 // GenerateCommand generates a shell command using Anthropic's Claude API
-func (a *Anthropic) GenerateCommand(ctx context.Context, prompt string, shellInfo shell.ShellInfo) (string, error) {
-	systemPrompt := BuildSmartSystemPrompt(shellInfo, a.systemPromptSuffix, prompt)
+// The model is forced to answer through a tool call whose input is the command result
+func (a *Anthropic) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	systemPrompt, err := BuildStructuredSystemPrompt(req, a.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
 
 	resp, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
 		Model:     anthropic.Model(a.model),
@@ -46,27 +61,119 @@ func (a *Anthropic) GenerateCommand(ctx context.Context, prompt string, shellInf
 				Type: "text",
 			},
 		},
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
-		},
+		Messages:   anthropicMessages(req),
+		Tools:      []anthropic.ToolUnionParam{submitCommandToolParam()},
+		ToolChoice: anthropic.ToolChoiceParamOfToolChoiceTool(submitCommandTool),
 	})
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %w", err)
+		return nil, fmt.Errorf("API request failed: %w", err)
 	}
+	reportUsage(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
 
-	// Extract text from response
+	// Prefer the tool call, falling back to any text the model returned
+	for _, block := range resp.Content {
+		if block.Type == "tool_use" && block.Name == submitCommandTool {
+			return ParseCommandResult(traceResponse(ctx, string(block.Input)))
+		}
+	}
 	for _, block := range resp.Content {
 		if block.Type == "text" {
-			return block.Text, nil
+			return ParseCommandResult(traceResponse(ctx, block.Text))
 		}
 	}
 
-	return "", fmt.Errorf("no text response from API")
+	return nil, fmt.Errorf("no text response from API")
+}
+
+// GenerateCommandWithTools generates a shell command using Anthropic's Claude
+// API, letting the model call probing tools until it submits the command. In
+// the last round only the submit tool is allowed.
+func (a *Anthropic) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	systemPrompt, err := BuildStructuredSystemPrompt(req, a.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	systemPrompt += toolRules
+	traceRequest(ctx, systemPrompt)
+	messages := anthropicMessages(req)
+
+	toolParams := []anthropic.ToolUnionParam{submitCommandToolParam()}
+	for _, tool := range tools.Tools {
+		schema := anthropic.ToolInputSchemaParam{Properties: tool.Schema()}
+		if len(tool.Required) > 0 {
+			schema.ExtraFields = map[string]interface{}{"required": tool.Required}
+		}
+		toolParams = append(toolParams, anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+			Name:        tool.Name,
+			Description: anthropic.String(tool.Description),
+			InputSchema: schema,
+		}})
+	}
+
+	for round := 0; ; round++ {
+		toolChoice := anthropic.ToolChoiceUnionParam{OfToolChoiceAny: &anthropic.ToolChoiceAnyParam{}}
+		if round >= tools.MaxRounds {
+			toolChoice = anthropic.ToolChoiceParamOfToolChoiceTool(submitCommandTool)
+		}
+
+		resp, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
+			Model:     anthropic.Model(a.model),
+			MaxTokens: 500,
+			System: []anthropic.TextBlockParam{
+				{
+					Text: systemPrompt,
+					Type: "text",
+				},
+			},
+			Messages:   messages,
+			Tools:      toolParams,
+			ToolChoice: toolChoice,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("API request failed: %w", err)
+		}
+		reportUsage(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+
+		var results []anthropic.ContentBlockParamUnion
+		for _, block := range resp.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+			if block.Name == submitCommandTool {
+				return ParseCommandResult(traceResponse(ctx, string(block.Input)))
+			}
+			call := tools.Run(ctx, block.Name, string(block.Input))
+			results = append(results, anthropic.NewToolResultBlock(block.ID, call.Result(), call.Err != nil))
+		}
+		if len(results) == 0 {
+			for _, block := range resp.Content {
+				if block.Type == "text" {
+					return ParseCommandResult(traceResponse(ctx, block.Text))
+				}
+			}
+			return nil, fmt.Errorf("no text response from API")
+		}
+
+		messages = append(messages, resp.ToParam(), anthropic.NewUserMessage(results...))
+	}
+}
+
+// submitCommandToolParam returns the tool Claude uses to return a structured command result
+func submitCommandToolParam() anthropic.ToolUnionParam {
+	return anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+		Name:        submitCommandTool,
+		Description: anthropic.String("Submit the shell command(s) that accomplish the user's request"),
+		InputSchema: anthropic.ToolInputSchemaParam{Properties: commandResultSchema},
+	}}
 }
 
 // ExplainCommand explains what a shell command does
-func (a *Anthropic) ExplainCommand(ctx context.Context, command string) (string, error) {
-	systemPrompt := BuildExplainPrompt()
+func (a *Anthropic) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
 
 	resp, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
 		Model:     anthropic.Model(a.model),
@@ -78,28 +185,74 @@ func (a *Anthropic) ExplainCommand(ctx context.Context, command string) (string,
 			},
 		},
 		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(command)),
+			anthropic.NewUserMessage(anthropic.NewTextBlock(explainMessage(req))),
 		},
 	})
 	if err != nil {
 		return "", fmt.Errorf("API request failed: %w", err)
 	}
+	reportUsage(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
 
 	// Extract text from response
 	for _, block := range resp.Content {
 		if block.Type == "text" {
-			return block.Text, nil
+			return traceResponse(ctx, block.Text), nil
 		}
 	}
 
 	return "", fmt.Errorf("no text response from API")
 }
 
+// ReviewCommand checks a command for mistakes in a second pass. The model is
+// forced to answer through a tool call whose input is the review.
+func (a *Anthropic) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	resp, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:     anthropic.Model(a.model),
+		MaxTokens: 500,
+		System: []anthropic.TextBlockParam{
+			{
+				Text: BuildReviewPrompt(req.ShellInfo),
+				Type: "text",
+			},
+		},
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(req.Command)),
+		},
+		Tools: []anthropic.ToolUnionParam{{OfTool: &anthropic.ToolParam{
+			Name:        submitReviewTool,
+			Description: anthropic.String("Submit the issues found in the command and the corrected command"),
+			InputSchema: anthropic.ToolInputSchemaParam{Properties: reviewSchema},
+		}}},
+		ToolChoice: anthropic.ToolChoiceParamOfToolChoiceTool(submitReviewTool),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	reportUsage(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+
+	for _, block := range resp.Content {
+		if block.Type == "tool_use" && block.Name == submitReviewTool {
+			return ParseReview(string(block.Input))
+		}
+	}
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			return ParseReview(block.Text)
+		}
+	}
+
+	return nil, fmt.Errorf("no text response from API")
+}
+
 // GenerateCommandStream generates a shell command with streaming output
-func (a *Anthropic) GenerateCommandStream(ctx context.Context, prompt string, shellInfo shell.ShellInfo, callback func(chunk string)) (string, error) {
-	systemPrompt := BuildSmartSystemPrompt(shellInfo, a.systemPromptSuffix, prompt)
+func (a *Anthropic) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	systemPrompt, err := BuildSmartSystemPrompt(req, a.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
 
-	stream := a.client.Messages.NewStreaming(ctx, anthropic.MessageNewParams{
+	fullContent, err := a.streamText(ctx, anthropic.MessageNewParams{
 		Model:     anthropic.Model(a.model),
 		MaxTokens: 500,
 		System: []anthropic.TextBlockParam{
@@ -108,10 +261,42 @@ func (a *Anthropic) GenerateCommandStream(ctx context.Context, prompt string, sh
 				Type: "text",
 			},
 		},
+		Messages: anthropicMessages(req),
+	}, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCommandResult(fullContent)
+}
+
+// ExplainCommandStream explains what a shell command does with streaming output
+func (a *Anthropic) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
+
+	return a.streamText(ctx, anthropic.MessageNewParams{
+		Model:     anthropic.Model(a.model),
+		MaxTokens: 1000,
+		System: []anthropic.TextBlockParam{
+			{
+				Text: systemPrompt,
+				Type: "text",
+			},
+		},
 		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
+			anthropic.NewUserMessage(anthropic.NewTextBlock(explainMessage(req))),
 		},
-	})
+	}, callback)
+}
+
+// streamText streams a message, passing each piece of text to callback, and
+// returns the full text
+func (a *Anthropic) streamText(ctx context.Context, params anthropic.MessageNewParams, callback func(chunk string)) (string, error) {
+	stream := a.client.Messages.NewStreaming(ctx, params)
 
 	var fullContent string
 	for stream.Next() {
@@ -119,6 +304,11 @@ func (a *Anthropic) GenerateCommandStream(ctx context.Context, prompt string, sh
 
 		// Check for text delta events
 		switch eventVariant := event.AsAny().(type) {
+		case anthropic.MessageStartEvent:
+			reportUsage(ctx, eventVariant.Message.Usage.InputTokens, 0)
+		case anthropic.MessageDeltaEvent:
+			// Output tokens are cumulative and reported once the message is complete
+			reportUsage(ctx, 0, eventVariant.Usage.OutputTokens)
 		case anthropic.ContentBlockDeltaEvent:
 			switch deltaVariant := eventVariant.Delta.AsAny().(type) {
 			case anthropic.TextDelta:
@@ -133,6 +323,18 @@ func (a *Anthropic) GenerateCommandStream(ctx context.Context, prompt string, sh
 	if err := stream.Err(); err != nil {
 		return "", fmt.Errorf("streaming API request failed: %w", err)
 	}
+	return traceResponse(ctx, fullContent), nil
+}
 
-	return fullContent, nil
-}
\ No newline at end of file
+// anthropicMessages builds the messages for a generate request, including any conversation history
+func anthropicMessages(req GenerateRequest) []anthropic.MessageParam {
+	var messages []anthropic.MessageParam
+	for _, msg := range BuildMessages(req.History, req.Prompt) {
+		if msg.Role == RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(msg.Content)))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)))
+		}
+	}
+	return messages
+}
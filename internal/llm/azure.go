@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openai/openai-go/option"
+)
+
+// NewAzure creates a provider for an Azure OpenAI deployment. Azure speaks the
+// OpenAI chat completions API, but routes requests by deployment name in the
+// URL, versions the API with the api-version query parameter and
+// authenticates with an api-key header instead of a bearer token.
+func NewAzure(apiKey, endpoint, deployment, apiVersion, systemPromptSuffix string, httpClient *http.Client, extra ...option.RequestOption) (*OpenAICompatible, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("base_url must be set to the Azure OpenAI endpoint")
+	}
+	if deployment == "" {
+		return nil, fmt.Errorf("deployment is required for Azure OpenAI")
+	}
+
+	baseURL := strings.TrimRight(endpoint, "/") + "/openai/deployments/" + url.PathEscape(deployment) + "/"
+	// Without an API key, NewOpenAICompatible doesn't send OPENAI_API_KEY
+	// from the environment to Azure
+	opts := []option.RequestOption{
+		option.WithQuery("api-version", apiVersion),
+	}
+	if apiKey != "" {
+		opts = append(opts, option.WithHeader("api-key", apiKey))
+	}
+
+	return NewOpenAICompatible("", baseURL, deployment, systemPromptSuffix, httpClient, append(opts, extra...)...)
+}
@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestAzureProvider(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-not-for-azure")
+
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Clone(context.Background()))
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ls -la\"}}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"ls -la\"]}"}}]}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Provider:   config.ProviderAzure,
+		APIKey:     "azure-key",
+		Model:      "gpt-4o",
+		BaseURL:    server.URL,
+		Deployment: "shell-gpt4o",
+		Retry:      &config.RetryConfig{MaxAttempts: 1},
+	}
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+
+	req := GenerateRequest{Prompt: "list files", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}
+	if result, err := provider.GenerateCommand(context.Background(), req); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	} else if result.Command() != "ls -la" {
+		t.Errorf("command = %q, expected %q", result.Command(), "ls -la")
+	}
+
+	sp, ok := provider.(StreamingProvider)
+	if !ok {
+		t.Fatal("Azure provider does not support streaming")
+	}
+	var streamed string
+	if _, err := sp.GenerateCommandStream(context.Background(), req, func(chunk string) { streamed += chunk }); err != nil {
+		t.Fatalf("GenerateCommandStream returned error: %v", err)
+	}
+	if streamed != "ls -la" {
+		t.Errorf("streamed = %q, expected %q", streamed, "ls -la")
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("server received %d requests, expected 2", len(requests))
+	}
+	for _, r := range requests {
+		if r.URL.Path != "/openai/deployments/shell-gpt4o/chat/completions" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-10-21" {
+			t.Errorf("api-version = %q, expected %q", got, "2024-10-21")
+		}
+		if got := r.Header.Get("api-key"); got != "azure-key" {
+			t.Errorf("api-key header = %q, expected %q", got, "azure-key")
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("Authorization header = %q, expected none", got)
+		}
+	}
+}
+
+func TestAzureValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{"no endpoint", &config.Config{Provider: config.ProviderAzure, APIKey: "key", Model: "gpt-4o"}},
+		{"no deployment", &config.Config{Provider: config.ProviderAzure, APIKey: "key", BaseURL: "https://example.openai.azure.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewProvider(tt.cfg); err == nil {
+				t.Error("NewProvider returned no error")
+			}
+		})
+	}
+}
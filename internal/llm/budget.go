@@ -0,0 +1,328 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+// defaultContextWindow is the context window assumed for models that aren't known
+const defaultContextWindow = 8192
+
+// ollamaContextWindow is the context Ollama gives a model when num_ctx isn't set
+const ollamaContextWindow = 4096
+
+// outputReserve is the room left in the context window for the response
+const outputReserve = 1000
+
+// contextWindows are the context windows of known models in tokens, matched
+// by the longest prefix of the model name
+var contextWindows = map[string]int{
+	"gpt-5":          400000,
+	"gpt-4.1":        1047576,
+	"gpt-4o":         128000,
+	"gpt-4-turbo":    128000,
+	"gpt-4":          8192,
+	"gpt-3.5-turbo":  16385,
+	"o1":             200000,
+	"o3":             200000,
+	"o4":             200000,
+	"claude":         200000,
+	"gemini-1.5-pro": 2097152,
+	"gemini":         1048576,
+	"grok":           131072,
+	"llama3.1":       131072,
+	"llama3.2":       131072,
+	"llama3.3":       131072,
+	"llama3":         8192,
+	"mistral":        32768,
+	"mixtral":        32768,
+	"qwen":           32768,
+	"deepseek":       65536,
+}
+
+// Context priorities. Parts with a lower priority are trimmed or dropped first.
+const (
+	PriorityRecentCommits = 10
+	PriorityDirectory     = 20
+	PriorityGitStatus     = 30
+	PriorityInput         = 40
+)
+
+// ContextWindow returns the context window of the model in the config in
+// tokens. Ollama models get num_ctx, or Ollama's default context if it isn't
+// set; unknown models get a conservative default.
+func ContextWindow(cfg *config.Config) int {
+	if cfg.Provider == config.ProviderOllama {
+		if cfg.Ollama != nil && cfg.Ollama.NumCtx > 0 {
+			return cfg.Ollama.NumCtx
+		}
+		return ollamaContextWindow
+	}
+
+	model := strings.ToLower(cfg.Model)
+	if cfg.Provider == config.ProviderAzure {
+		model = strings.ToLower(cfg.GetDeployment())
+	}
+	// Model names may carry a vendor prefix, e.g. "meta-llama/llama3.1" or "openai/gpt-4o"
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	window, matched := defaultContextWindow, 0
+	for prefix, n := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			window, matched = n, len(prefix)
+		}
+	}
+	return window
+}
+
+// ContextBudget returns the most tokens a request for the model in the config
+// may take: the context_budget setting, or less if the model's context window
+// can't hold it along with the response
+func ContextBudget(cfg *config.Config) int {
+	budget := ContextWindow(cfg) - outputReserve
+	if limit := cfg.GetContextBudget(); limit < budget {
+		budget = limit
+	}
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// EstimateTokens approximates the number of tokens a text takes. Runs of
+// ASCII letters and digits count one token per four characters; punctuation,
+// symbols and other characters count one token each, which errs on the high
+// side for code and paths.
+func EstimateTokens(text string) int {
+	tokens, run := 0, 0
+	for _, r := range text {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			run++
+		case unicode.IsSpace(r):
+			tokens += (run + 3) / 4
+			run = 0
+		default:
+			tokens += (run+3)/4 + 1
+			run = 0
+		}
+	}
+	return tokens + (run+3)/4
+}
+
+// ContextPart is a source of context competing for room in a request
+type ContextPart struct {
+	Name     string
+	Text     string
+	Priority int  // Parts with a lower priority are trimmed or dropped first
+	Required bool // Required parts count against the budget but are never trimmed
+
+	// Trim shortens the text to about the given number of tokens. Parts
+	// without one are dropped whole.
+	Trim func(text string, tokens int) string
+}
+
+// PartFit records what happened to a part when the context was fitted
+type PartFit struct {
+	Name    string
+	Tokens  int // Estimated tokens before fitting
+	Kept    int // Estimated tokens after fitting
+	Dropped bool
+}
+
+// Trimmed reports whether the part was shortened but not dropped
+func (f PartFit) Trimmed() bool {
+	return !f.Dropped && f.Kept < f.Tokens
+}
+
+// ContextPlan is the result of fitting context parts into a budget
+type ContextPlan struct {
+	Budget int // Zero means no limit
+	Parts  []ContextPart
+	Fits   []PartFit
+}
+
+// Text returns the fitted text of a part, or "" if it was dropped or isn't in the plan
+func (p *ContextPlan) Text(name string) string {
+	for _, part := range p.Parts {
+		if part.Name == name {
+			return part.Text
+		}
+	}
+	return ""
+}
+
+// Used returns the estimated tokens of the fitted parts
+func (p *ContextPlan) Used() int {
+	used := 0
+	for _, f := range p.Fits {
+		used += f.Kept
+	}
+	return used
+}
+
+// Dropped returns the names of the parts that were dropped
+func (p *ContextPlan) Dropped() []string {
+	var names []string
+	for _, f := range p.Fits {
+		if f.Dropped {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// minTrimTokens is the smallest size a part is trimmed to; parts that would
+// be left smaller are dropped instead
+const minTrimTokens = 32
+
+// FitContext fits parts into a budget in tokens, trimming or dropping the
+// parts with the lowest priority first until the estimated total fits. Parts
+// with empty text are left out of the plan.
+func FitContext(budget int, parts []ContextPart) *ContextPlan {
+	plan := &ContextPlan{Budget: budget}
+	excess := -budget
+	for _, part := range parts {
+		if part.Text == "" {
+			continue
+		}
+		tokens := EstimateTokens(part.Text)
+		plan.Parts = append(plan.Parts, part)
+		plan.Fits = append(plan.Fits, PartFit{Name: part.Name, Tokens: tokens, Kept: tokens})
+		excess += tokens
+	}
+	if budget <= 0 {
+		return plan
+	}
+
+	order := make([]int, 0, len(plan.Parts))
+	for i, part := range plan.Parts {
+		if !part.Required {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return plan.Parts[order[a]].Priority < plan.Parts[order[b]].Priority
+	})
+
+	for _, i := range order {
+		if excess <= 0 {
+			break
+		}
+		part, fit := &plan.Parts[i], &plan.Fits[i]
+		// The input is what the request is about, so it is trimmed as far as
+		// needed but never dropped
+		keep := part.Priority >= PriorityInput && part.Trim != nil
+		if target := fit.Kept - excess; part.Trim != nil && (target >= minTrimTokens || keep) {
+			part.Text = part.Trim(part.Text, max(target, minTrimTokens))
+			kept := EstimateTokens(part.Text)
+			excess -= fit.Kept - kept
+			fit.Kept = kept
+			if excess <= 0 {
+				break
+			}
+			if keep {
+				continue
+			}
+		}
+		// Trimming wasn't possible or enough, so the part goes
+		excess -= fit.Kept
+		part.Text = ""
+		fit.Kept = 0
+		fit.Dropped = true
+	}
+	return plan
+}
+
+// TrimLines keeps the first lines of a text that fit in about the given
+// number of tokens, and notes how many lines were left out
+func TrimLines(text string, tokens int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	kept := fitLines(lines, tokens-8)
+	if kept == len(lines) {
+		return text
+	}
+	return strings.Join(lines[:kept], "\n") + fmt.Sprintf("\n... (%d more lines not shown)", len(lines)-kept)
+}
+
+// TrimMiddle keeps the beginning and the end of a text that fit in about the
+// given number of tokens, favoring the end, where logs and command output
+// usually have the errors. Very long lines are cut.
+func TrimMiddle(text string, tokens int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	tokens -= 12 // Room for the marker
+	headBudget := tokens / 3
+
+	head := fitLines(lines, headBudget)
+	reversed := make([]string, len(lines)-head)
+	for i := range reversed {
+		reversed[i] = lines[len(lines)-1-i]
+	}
+	tail := fitLines(reversed, tokens-EstimateTokens(strings.Join(lines[:head], "\n")))
+	if head+tail >= len(lines) {
+		return text
+	}
+	if head+tail == 0 {
+		// A single line too long to keep, so cut it by characters
+		return fitRunes(text, tokens) + "\n... (trimmed)"
+	}
+
+	var sb strings.Builder
+	for _, line := range lines[:head] {
+		sb.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&sb, "... (%d lines trimmed) ...", len(lines)-head-tail)
+	for _, line := range lines[len(lines)-tail:] {
+		sb.WriteString("\n" + line)
+	}
+	return sb.String()
+}
+
+// fitLines returns how many of the lines, from the first, fit in the given
+// number of tokens
+func fitLines(lines []string, tokens int) int {
+	used := 0
+	for i, line := range lines {
+		used += EstimateTokens(line) + 1
+		if used > tokens {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// fitRunes returns the longest beginning of a text that fits in the given
+// number of tokens. How many characters make a token depends on the text,
+// e.g. minified JSON has about one per token, so the cut is searched for.
+func fitRunes(text string, tokens int) string {
+	lo, hi := 0, utf8.RuneCountInString(text)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if EstimateTokens(truncateRunes(text, mid)) <= tokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return truncateRunes(text, lo)
+}
+
+// truncateRunes returns the first n runes of a text
+func truncateRunes(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	for i := range text {
+		if n == 0 {
+			return text[:i]
+		}
+		n--
+	}
+	return text
+}
@@ -0,0 +1,220 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"", 0},
+		{"list", 1},
+		{"list files", 3},
+		{"ls -la", 3},
+		{"find . -name '*.go'", 9},
+		{"héllo", 3},
+	}
+
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.expected {
+			t.Errorf("EstimateTokens(%q) = %d, expected %d", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		window   int
+		expected int
+	}{
+		{"known model", config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o-mini"}, 128000, 16000},
+		{"longest prefix", config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4"}, 8192, 7192},
+		{"vendor prefix", config.Config{Provider: config.ProviderOpenAICompatible, Model: "meta-llama/Llama3.1-8B"}, 131072, 16000},
+		{"unknown model", config.Config{Provider: config.ProviderOpenAICompatible, Model: "local"}, 8192, 7192},
+		{"ollama default", config.Config{Provider: config.ProviderOllama, Model: "llama3.2"}, 4096, 3096},
+		{"ollama num_ctx", config.Config{Provider: config.ProviderOllama, Model: "llama3.2", Ollama: &config.OllamaConfig{NumCtx: 32768}}, 32768, 16000},
+		{"azure deployment", config.Config{Provider: config.ProviderAzure, Model: "x", Deployment: "gpt-4o"}, 128000, 16000},
+		{"configured budget", config.Config{Provider: config.ProviderAnthropic, Model: "claude-sonnet-4", ContextBudget: 50000}, 200000, 50000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContextWindow(&tt.cfg); got != tt.window {
+				t.Errorf("ContextWindow = %d, expected %d", got, tt.window)
+			}
+			if got := ContextBudget(&tt.cfg); got != tt.expected {
+				t.Errorf("ContextBudget = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+// lines returns n numbered lines of text
+func lines(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "line %d of the output\n", i)
+	}
+	return sb.String()
+}
+
+func TestFitContext(t *testing.T) {
+	prompt := ContextPart{Name: "prompt", Text: lines(10), Required: true}
+	low := ContextPart{Name: "low", Text: lines(10), Priority: 1}
+	high := ContextPart{Name: "high", Text: lines(100), Priority: 2, Trim: TrimLines}
+	size := EstimateTokens(lines(10))
+
+	tests := []struct {
+		name    string
+		budget  int
+		kept    []string
+		dropped []string
+		trimmed bool
+	}{
+		{"no limit", 0, []string{"prompt", "low", "high"}, nil, false},
+		{"everything fits", 100000, []string{"prompt", "low", "high"}, nil, false},
+		{"low priority dropped first", size*10 + size/2, []string{"prompt", "high"}, []string{"low"}, true},
+		{"required parts are kept", size / 2, []string{"prompt"}, []string{"low", "high"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := FitContext(tt.budget, []ContextPart{prompt, low, high, {Name: "empty", Priority: 3}})
+			var kept []string
+			for _, part := range plan.Parts {
+				if part.Text != "" {
+					kept = append(kept, part.Name)
+				}
+			}
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("kept %q, expected %q", kept, tt.kept)
+			}
+			if !reflect.DeepEqual(plan.Dropped(), tt.dropped) {
+				t.Errorf("dropped %q, expected %q", plan.Dropped(), tt.dropped)
+			}
+			if trimmed := plan.Fits[2].Trimmed(); trimmed != tt.trimmed {
+				t.Errorf("high priority part trimmed = %v, expected %v", trimmed, tt.trimmed)
+			}
+			if tt.budget > 0 && len(tt.kept) > 1 && plan.Used() > tt.budget {
+				t.Errorf("used %d tokens of %d", plan.Used(), tt.budget)
+			}
+		})
+	}
+}
+
+func TestFitContextKeepsInput(t *testing.T) {
+	// Minified JSON is a single line of mostly punctuation, about one token
+	// per character
+	input := "[" + strings.Repeat(`{"id":1,"ok":true},`, 8000) + "]"
+	if tokens := EstimateTokens(input); tokens < 100000 {
+		t.Fatalf("input has only %d tokens", tokens)
+	}
+
+	plan := FitContext(16000, []ContextPart{
+		{Name: "prompt", Text: lines(10), Required: true},
+		{Name: PartDirectory, Text: lines(100), Priority: PriorityDirectory, Trim: TrimLines},
+		{Name: PartInput, Text: input, Priority: PriorityInput, Trim: TrimMiddle},
+	})
+	if plan.Used() > 16000 {
+		t.Errorf("used %d tokens of 16000", plan.Used())
+	}
+	kept := plan.Text(PartInput)
+	if kept == "" || !strings.HasPrefix(kept, `[{"id":1,"ok":true}`) || !strings.HasSuffix(kept, "... (trimmed)") {
+		t.Fatalf("input wasn't trimmed to fit:\n%.200s", kept)
+	}
+	if tokens := EstimateTokens(kept); tokens < 8000 {
+		t.Errorf("input was trimmed to %d tokens, more than needed", tokens)
+	}
+	if dropped := plan.Dropped(); !reflect.DeepEqual(dropped, []string{PartDirectory}) {
+		t.Errorf("dropped %q", dropped)
+	}
+}
+
+func TestTrimMiddle(t *testing.T) {
+	text := lines(200)
+	trimmed := TrimMiddle(text, 300)
+	if tokens := EstimateTokens(trimmed); tokens > 300 {
+		t.Errorf("trimmed text has %d tokens", tokens)
+	}
+	if !strings.HasPrefix(trimmed, "line 1 of") || !strings.HasSuffix(trimmed, "line 200 of the output") {
+		t.Errorf("trimmed text doesn't keep the beginning and end:\n%s", trimmed)
+	}
+	if !strings.Contains(trimmed, "lines trimmed) ...") {
+		t.Errorf("trimmed text doesn't say lines were trimmed:\n%s", trimmed)
+	}
+	if got := TrimMiddle("short", 300); got != "short" {
+		t.Errorf("TrimMiddle of a short text = %q", got)
+	}
+	if got := TrimMiddle(strings.Repeat("x ", 1000), 100); EstimateTokens(got) > 100 {
+		t.Errorf("TrimMiddle of a long line kept %d tokens", EstimateTokens(got))
+	}
+	if got := TrimMiddle(strings.Repeat(`{"a":[1,2]},`, 1000), 100); EstimateTokens(got) > 100 || EstimateTokens(got) < 80 {
+		t.Errorf("TrimMiddle of a long line of punctuation kept %d tokens", EstimateTokens(got))
+	}
+}
+
+func TestSystemPromptBudget(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	for i := 0; i < 40; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("report-%02d.csv", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	req := GenerateRequest{Prompt: "delete the old csv files", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}
+	full, err := BuildStructuredSystemPrompt(req, "")
+	if err != nil {
+		t.Fatalf("BuildStructuredSystemPrompt returned error: %v", err)
+	}
+	if !strings.Contains(full, "report-39.csv") {
+		t.Fatalf("prompt without a budget doesn't list the directory:\n%s", full)
+	}
+
+	// A budget a little smaller than the full prompt trims the listing
+	req.Budget = EstimateTokens(full) + EstimateTokens(req.Prompt) - 100
+	trimmed, err := BuildStructuredSystemPrompt(req, "")
+	if err != nil {
+		t.Fatalf("BuildStructuredSystemPrompt returned error: %v", err)
+	}
+	if !strings.Contains(trimmed, "report-00.csv") || strings.Contains(trimmed, "report-39.csv") || !strings.Contains(trimmed, "more lines not shown") {
+		t.Errorf("directory listing wasn't trimmed:\n%s", trimmed)
+	}
+	plan, err := PlanContext(req, "")
+	if err != nil {
+		t.Fatalf("PlanContext returned error: %v", err)
+	}
+	if plan.Used() > req.Budget {
+		t.Errorf("plan uses %d tokens of %d", plan.Used(), req.Budget)
+	}
+
+	// Without room for it, the listing is dropped
+	req.Budget = plan.Used() - plan.Fits[len(plan.Fits)-1].Kept + minTrimTokens/2
+	dropped, err := BuildStructuredSystemPrompt(req, "")
+	if err != nil {
+		t.Fatalf("BuildStructuredSystemPrompt returned error: %v", err)
+	}
+	if strings.Contains(dropped, "report-00.csv") {
+		t.Errorf("directory listing wasn't dropped:\n%s", dropped)
+	}
+}
@@ -0,0 +1,209 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/Hermithic/aiask/internal/cache"
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/probe"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+// CachingProvider serves repeated generate and explain requests from an
+// on-disk cache. Entries are keyed by the prompt, the system prompt (which
+// carries the shell, OS and directory context), the model and the shell.
+type CachingProvider struct {
+	provider Provider
+	cache    *cache.Cache
+	cfg      *config.Config
+	refresh  bool
+
+	hit      bool
+	answered *cache.Entry
+}
+
+// NewCachingProvider wraps a provider with a response cache. With refresh set,
+// cached entries are ignored but new responses are still stored.
+func NewCachingProvider(provider Provider, c *cache.Cache, cfg *config.Config, refresh bool) *CachingProvider {
+	return &CachingProvider{provider: provider, cache: c, cfg: cfg, refresh: refresh}
+}
+
+// Close releases resources held by the wrapped provider
+func (p *CachingProvider) Close() error {
+	return CloseProvider(p.provider)
+}
+
+// Unwrap returns the wrapped provider
+func (p *CachingProvider) Unwrap() Provider {
+	return p.provider
+}
+
+// CacheHit reports whether the last request was served from the cache
+func (p *CachingProvider) CacheHit() bool {
+	return p.hit
+}
+
+// AnsweredBy returns the provider and model that answered the last request,
+// including requests served from the cache
+func (p *CachingProvider) AnsweredBy() (config.Provider, string) {
+	if p.hit && p.answered != nil {
+		return config.Provider(p.answered.Provider), p.answered.Model
+	}
+	return AnsweredBy(p.provider, p.cfg)
+}
+
+// generateKey returns the cache key of a generate request. The base URL is
+// part of the key since openai-compatible servers may serve different models
+// under the same name.
+func (p *CachingProvider) generateKey(req GenerateRequest) (string, error) {
+	systemPrompt, err := BuildStructuredSystemPrompt(req, p.cfg.SystemPromptSuffix)
+	if err != nil {
+		return "", err
+	}
+	history, _ := json.Marshal(BuildMessages(req.History, req.Prompt))
+	return cache.Key(cache.KindGenerate, string(p.cfg.Provider), p.cfg.GetBaseURL(), p.cfg.Model, string(req.ShellInfo.Shell), shell.GetOSName(), systemPrompt, string(history)), nil
+}
+
+// explainKey returns the cache key of an explain request. The reference is
+// part of the key since the installed programs may change.
+func (p *CachingProvider) explainKey(req ExplainRequest) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	return cache.Key(cache.KindExplain, string(p.cfg.Provider), p.cfg.GetBaseURL(), p.cfg.Model, systemPrompt, strings.TrimSpace(req.Command), req.Reference), nil
+}
+
+// reviewKey returns the cache key of a review request
+func (p *CachingProvider) reviewKey(req ReviewRequest) string {
+	return cache.Key(cache.KindReview, string(p.cfg.Provider), p.cfg.GetBaseURL(), p.cfg.Model, BuildReviewPrompt(req.ShellInfo), strings.TrimSpace(req.Command))
+}
+
+// lookup loads a cached value into v, reporting whether there was a usable entry
+func (p *CachingProvider) lookup(key string, v interface{}) bool {
+	p.hit, p.answered = false, nil
+	if p.refresh {
+		return false
+	}
+	entry, err := p.cache.Get(key)
+	if err != nil || entry == nil || json.Unmarshal(entry.Value, v) != nil {
+		return false
+	}
+	p.hit, p.answered = true, entry
+	return true
+}
+
+// store saves a value in the cache; failures are ignored since the cache is best effort
+func (p *CachingProvider) store(key, kind string, v interface{}) {
+	name, model := AnsweredBy(p.provider, p.cfg)
+	_ = p.cache.Put(key, kind, string(name), model, v)
+}
+
+// GenerateCommand returns a cached command or generates a new one
+func (p *CachingProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	key, err := p.generateKey(req)
+	if err != nil {
+		return nil, err
+	}
+	result := &CommandResult{}
+	if p.lookup(key, result) {
+		return result, nil
+	}
+
+	result, err = p.provider.GenerateCommand(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	p.store(key, cache.KindGenerate, result)
+	return result, nil
+}
+
+// GenerateCommandStream returns a cached command as a single chunk, or streams
+// a new one if the wrapped provider supports streaming
+func (p *CachingProvider) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	key, err := p.generateKey(req)
+	if err != nil {
+		return nil, err
+	}
+	result := &CommandResult{}
+	if p.lookup(key, result) {
+		callback(result.Command())
+		return result, nil
+	}
+
+	if sp, ok := p.provider.(StreamingProvider); ok {
+		result, err = sp.GenerateCommandStream(ctx, req, callback)
+	} else if result, err = p.provider.GenerateCommand(ctx, req); err == nil {
+		callback(result.Command())
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.store(key, cache.KindGenerate, result)
+	return result, nil
+}
+
+// GenerateCommandWithTools always asks the provider, since the answer depends
+// on what the tools find on the system at the time
+func (p *CachingProvider) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	p.hit = false
+	return generateWithTools(ctx, p.provider, req, tools)
+}
+
+// ExplainCommand returns a cached explanation or asks the provider for one
+func (p *CachingProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	key, err := p.explainKey(req)
+	if err != nil {
+		return "", err
+	}
+	var explanation string
+	if p.lookup(key, &explanation) {
+		return explanation, nil
+	}
+
+	explanation, err = p.provider.ExplainCommand(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	p.store(key, cache.KindExplain, explanation)
+	return explanation, nil
+}
+
+// ExplainCommandStream returns a cached explanation as a single chunk, or
+// streams a new one if the wrapped provider supports streaming
+func (p *CachingProvider) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	key, err := p.explainKey(req)
+	if err != nil {
+		return "", err
+	}
+	var explanation string
+	if p.lookup(key, &explanation) {
+		callback(explanation)
+		return explanation, nil
+	}
+
+	explanation, err = explainStream(ctx, p.provider, req, callback)
+	if err != nil {
+		return "", err
+	}
+	p.store(key, cache.KindExplain, explanation)
+	return explanation, nil
+}
+
+// ReviewCommand returns a cached review or asks the provider for one
+func (p *CachingProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	key := p.reviewKey(req)
+	review := &Review{}
+	if p.lookup(key, review) {
+		return review, nil
+	}
+
+	review, err := reviewCommand(ctx, p.provider, req)
+	if err != nil {
+		return nil, err
+	}
+	p.store(key, cache.KindReview, review)
+	return review, nil
+}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/cache"
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestCachingProvider(t *testing.T) {
+	cfg := &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o"}
+	inner := &fakeProvider{command: "ls -la"}
+	c := cache.New(t.TempDir(), time.Hour)
+	req := GenerateRequest{Prompt: "list files", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}
+
+	p := NewCachingProvider(inner, c, cfg, false)
+	for i := 0; i < 2; i++ {
+		result, err := p.GenerateCommand(context.Background(), req)
+		if err != nil {
+			t.Fatalf("GenerateCommand returned error: %v", err)
+		}
+		if result.Command() != "ls -la" {
+			t.Errorf("command = %q, expected %q", result.Command(), "ls -la")
+		}
+		if p.CacheHit() != (i == 1) {
+			t.Errorf("call %d: CacheHit() = %v", i, p.CacheHit())
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("provider called %d times, expected 1", inner.calls)
+	}
+
+	// A different shell is a different request
+	req.ShellInfo.Shell = shell.ShellZsh
+	if _, err := p.GenerateCommand(context.Background(), req); err != nil || p.CacheHit() {
+		t.Errorf("expected a cache miss for a different shell")
+	}
+
+	// Explanations are cached separately, and refresh bypasses the cache
+	if _, err := p.ExplainCommand(context.Background(), ExplainRequest{Command: "ls"}); err != nil {
+		t.Fatal(err)
+	}
+	// Different reference documentation is a different request
+	if _, err := p.ExplainCommand(context.Background(), ExplainRequest{Command: "ls", Reference: "-l  use a long listing format"}); err != nil || p.CacheHit() {
+		t.Errorf("expected a cache miss for a different reference")
+	}
+	refreshing := NewCachingProvider(inner, c, cfg, true)
+	before := inner.calls
+	if _, err := refreshing.ExplainCommand(context.Background(), ExplainRequest{Command: "ls"}); err != nil || refreshing.CacheHit() {
+		t.Errorf("expected refresh to skip the cache")
+	}
+	if inner.calls != before+1 {
+		t.Errorf("expected refresh to call the provider")
+	}
+}
+
+func TestCachingProviderExplainStream(t *testing.T) {
+	cfg := &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o"}
+	inner := &fakeProvider{}
+	p := NewCachingProvider(inner, cache.New(t.TempDir(), time.Hour), cfg, false)
+
+	// Providers without streaming deliver the explanation as one chunk, and
+	// a cached explanation is replayed the same way
+	for i := 0; i < 2; i++ {
+		var chunks []string
+		explanation, err := p.ExplainCommandStream(context.Background(), ExplainRequest{Command: "ls"}, func(c string) { chunks = append(chunks, c) })
+		if err != nil {
+			t.Fatalf("ExplainCommandStream returned error: %v", err)
+		}
+		if len(chunks) != 1 || chunks[0] != explanation {
+			t.Errorf("call %d: chunks = %q, explanation = %q", i, chunks, explanation)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("provider called %d times, expected 1", inner.calls)
+	}
+}
@@ -0,0 +1,194 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+// ConsensusAnswer is one provider's answer to a consensus request
+type ConsensusAnswer struct {
+	Provider config.Provider
+	Model    string
+	Result   *CommandResult // nil if the request failed
+	Err      error
+	Latency  time.Duration
+	Usage    *Usage
+}
+
+// Consensus holds the answers of all providers to the same request
+type Consensus struct {
+	Answers []ConsensusAnswer
+}
+
+// Succeeded returns the answers that have a result
+func (c *Consensus) Succeeded() []ConsensusAnswer {
+	var answers []ConsensusAnswer
+	for _, a := range c.Answers {
+		if a.Result != nil {
+			answers = append(answers, a)
+		}
+	}
+	return answers
+}
+
+// Groups returns the successful answers grouped by command, in the order the
+// commands first appear. Commands are compared after normalizing whitespace
+// and trailing semicolons.
+func (c *Consensus) Groups() [][]ConsensusAnswer {
+	var groups [][]ConsensusAnswer
+	index := map[string]int{}
+	for _, a := range c.Succeeded() {
+		key := normalizeCommand(a.Result.Command())
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], a)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []ConsensusAnswer{a})
+	}
+	return groups
+}
+
+// Distinct returns the first answer of each group of identical commands
+func (c *Consensus) Distinct() []ConsensusAnswer {
+	var answers []ConsensusAnswer
+	for _, group := range c.Groups() {
+		answers = append(answers, group[0])
+	}
+	return answers
+}
+
+// Agreed reports whether at least two providers answered and all of them
+// gave the same command
+func (c *Consensus) Agreed() bool {
+	return len(c.Succeeded()) >= 2 && len(c.Distinct()) == 1
+}
+
+// ConsensusProvider sends each request to several providers at once, so
+// their commands can be compared
+type ConsensusProvider struct {
+	members []fallbackMember
+
+	mu   sync.Mutex
+	last *Consensus
+}
+
+// NewConsensusProvider creates a provider that asks the main provider and
+// each fallback provider
+func NewConsensusProvider(cfg *config.Config) (*ConsensusProvider, error) {
+	if len(cfg.Fallbacks) == 0 {
+		return nil, fmt.Errorf("consensus mode needs at least two providers; add one under fallbacks in the config file")
+	}
+
+	main := *cfg
+	main.Fallbacks = nil
+	configs := []*config.Config{&main}
+	for _, fb := range cfg.Fallbacks {
+		configs = append(configs, cfg.WithProvider(fb))
+	}
+
+	c := &ConsensusProvider{}
+	for _, mc := range configs {
+		provider, err := newSingleProvider(mc)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("%s: %w", mc.Provider, err)
+		}
+		c.members = append(c.members, fallbackMember{name: mc.Provider, model: mc.Model, provider: provider})
+	}
+	return c, nil
+}
+
+// Close releases resources held by all providers
+func (c *ConsensusProvider) Close() error {
+	var firstErr error
+	for _, m := range c.members {
+		if err := CloseProvider(m.provider); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Last returns the answers to the last GenerateCommand call
+func (c *ConsensusProvider) Last() *Consensus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// AnsweredBy returns the first provider that answered the last request
+func (c *ConsensusProvider) AnsweredBy() (config.Provider, string) {
+	if last := c.Last(); last != nil {
+		if answers := last.Succeeded(); len(answers) > 0 {
+			return answers[0].Provider, answers[0].Model
+		}
+	}
+	return "", ""
+}
+
+// GenerateCommand asks all providers concurrently. The result is the first
+// successful answer, with the differing commands of the other providers as
+// alternatives; Last returns the individual answers. Alternatives are not
+// requested from the providers themselves.
+func (c *ConsensusProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	req.Alternatives = 0
+	consensus := &Consensus{Answers: make([]ConsensusAnswer, len(c.members))}
+
+	var wg sync.WaitGroup
+	for i, m := range c.members {
+		wg.Add(1)
+		go func(i int, m fallbackMember) {
+			defer wg.Done()
+			memberCtx, usage := WithUsage(ctx)
+			start := time.Now()
+			result, err := m.provider.GenerateCommand(memberCtx, req)
+			consensus.Answers[i] = ConsensusAnswer{
+				Provider: m.name,
+				Model:    m.model,
+				Result:   result,
+				Err:      err,
+				Latency:  time.Since(start),
+				Usage:    usage,
+			}
+			input, output := usage.Tokens()
+			reportUsage(ctx, input, output)
+		}(i, m)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	c.last = consensus
+	c.mu.Unlock()
+
+	distinct := consensus.Distinct()
+	if len(distinct) == 0 {
+		var errs []string
+		for _, a := range consensus.Answers {
+			errs = append(errs, fmt.Sprintf("%s: %s", a.Provider, a.Err))
+		}
+		return nil, fmt.Errorf("all providers failed: %s", strings.Join(errs, "; "))
+	}
+
+	result := *distinct[0].Result
+	result.Alternatives = nil
+	for _, a := range distinct[1:] {
+		result.Alternatives = append(result.Alternatives, *a.Result)
+	}
+	return &result, nil
+}
+
+// ExplainCommand explains a command with the main provider
+func (c *ConsensusProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	return c.members[0].provider.ExplainCommand(ctx, req)
+}
+
+// ReviewCommand reviews a command with the main provider
+func (c *ConsensusProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	return reviewCommand(ctx, c.members[0].provider, req)
+}
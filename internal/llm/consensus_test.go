@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+func newTestConsensus(providers ...*fakeProvider) *ConsensusProvider {
+	c := &ConsensusProvider{}
+	for i, p := range providers {
+		c.members = append(c.members, fallbackMember{name: config.Provider(fmt.Sprintf("p%d", i)), model: "m", provider: p})
+	}
+	return c
+}
+
+func TestConsensusProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []*fakeProvider
+		agreed    bool
+		distinct  int
+		err       bool
+	}{
+		{"agree", []*fakeProvider{{command: "ls -la"}, {command: "ls  -la;"}}, true, 1, false},
+		{"disagree", []*fakeProvider{{command: "ls -la"}, {command: "ls -lah"}, {command: "ls -la"}}, false, 2, false},
+		{"one answer", []*fakeProvider{{command: "ls -la"}, {err: errors.New("down")}}, false, 1, false},
+		{"all failed", []*fakeProvider{{err: errors.New("down")}, {err: errors.New("timeout")}}, false, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConsensus(tt.providers...)
+			result, err := c.GenerateCommand(context.Background(), GenerateRequest{Prompt: "list files", Alternatives: 3})
+			if (err != nil) != tt.err {
+				t.Fatalf("GenerateCommand error = %v, expected error: %v", err, tt.err)
+			}
+
+			last := c.Last()
+			if len(last.Answers) != len(tt.providers) {
+				t.Fatalf("%d answers, expected %d", len(last.Answers), len(tt.providers))
+			}
+			if last.Agreed() != tt.agreed {
+				t.Errorf("Agreed() = %v, expected %v", last.Agreed(), tt.agreed)
+			}
+			if len(last.Distinct()) != tt.distinct {
+				t.Errorf("%d distinct answers, expected %d", len(last.Distinct()), tt.distinct)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "p0: down") || !strings.Contains(err.Error(), "p1: timeout") {
+					t.Errorf("error = %q, expected both providers' errors", err)
+				}
+				return
+			}
+			if len(result.Candidates()) != tt.distinct {
+				t.Errorf("%d candidates, expected one per distinct answer", len(result.Candidates()))
+			}
+		})
+	}
+}
+
+func TestNewConsensusProviderNeedsTwoProviders(t *testing.T) {
+	cfg := &config.Config{Provider: config.ProviderOllama, Model: "llama3.2"}
+	if _, err := NewConsensusProvider(cfg); err == nil {
+		t.Error("expected an error without fallback providers")
+	}
+
+	cfg.Fallbacks = []config.ProviderConfig{{Provider: config.ProviderOllama, Model: "qwen2.5-coder"}}
+	c, err := NewConsensusProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewConsensusProvider returned error: %v", err)
+	}
+	defer c.Close()
+	if len(c.members) != 2 || c.members[1].model != "qwen2.5-coder" {
+		t.Errorf("members = %+v", c.members)
+	}
+}
@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxTurns is the number of conversation turns kept when no cap is configured
+const DefaultMaxTurns = 10
+
+// Message roles used when building provider-agnostic conversations
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Turn represents a single exchange in a conversation with the model
+type Turn struct {
+	Prompt   string `json:"prompt"`             // The user's natural language request
+	Command  string `json:"command"`            // The command that was generated (or edited by the user)
+	Executed bool   `json:"executed,omitempty"` // Whether the command was executed
+	Outcome  string `json:"outcome,omitempty"`  // What happened to the command (e.g. "succeeded", "failed: exit status 1")
+}
+
+// Message is a provider-agnostic chat message
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Conversation holds the prior turns of an interactive session
+type Conversation struct {
+	turns    []Turn
+	maxTurns int
+}
+
+// NewConversation creates a new conversation that keeps at most maxTurns turns
+func NewConversation(maxTurns int) *Conversation {
+	if maxTurns <= 0 {
+		maxTurns = DefaultMaxTurns
+	}
+	return &Conversation{
+		turns:    []Turn{},
+		maxTurns: maxTurns,
+	}
+}
+
+// Add appends a turn, dropping the oldest turns beyond the cap
+func (c *Conversation) Add(turn Turn) {
+	c.turns = append(c.turns, turn)
+	if len(c.turns) > c.maxTurns {
+		c.turns = c.turns[len(c.turns)-c.maxTurns:]
+	}
+}
+
+// Turns returns a copy of the turns in the conversation, oldest first
+func (c *Conversation) Turns() []Turn {
+	turns := make([]Turn, len(c.turns))
+	copy(turns, c.turns)
+	return turns
+}
+
+// Len returns the number of turns in the conversation
+func (c *Conversation) Len() int {
+	return len(c.turns)
+}
+
+// Reset clears all turns from the conversation
+func (c *Conversation) Reset() {
+	c.turns = []Turn{}
+}
+
+// BuildMessages converts prior turns and the current prompt into alternating
+// user/assistant messages. The outcome of each turn is attached to the
+// following user message so roles always alternate.
+func BuildMessages(history []Turn, prompt string) []Message {
+	messages := make([]Message, 0, len(history)*2+1)
+
+	previousOutcome := ""
+	for _, turn := range history {
+		messages = append(messages, Message{Role: RoleUser, Content: withOutcome(previousOutcome, turn.Prompt)})
+		messages = append(messages, Message{Role: RoleAssistant, Content: turn.Command})
+		previousOutcome = describeOutcome(turn)
+	}
+
+	messages = append(messages, Message{Role: RoleUser, Content: withOutcome(previousOutcome, prompt)})
+	return messages
+}
+
+// describeOutcome returns a short note describing what happened to a turn's command
+func describeOutcome(turn Turn) string {
+	outcome := turn.Outcome
+	if outcome == "" {
+		if turn.Executed {
+			outcome = "executed"
+		} else {
+			outcome = "not executed"
+		}
+	}
+	return fmt.Sprintf("(Previous command: %s)", outcome)
+}
+
+// withOutcome prefixes a prompt with the outcome of the previous turn, if any
+func withOutcome(outcome, prompt string) string {
+	if outcome == "" {
+		return prompt
+	}
+	return outcome + "\n\n" + prompt
+}
+
+// relevanceText returns the text used to decide which context to include in the
+// system prompt. Prior prompts are included so follow-ups like "make it recursive"
+// keep the context of the original request.
+func relevanceText(req GenerateRequest) string {
+	if len(req.History) == 0 {
+		return req.Prompt
+	}
+	parts := make([]string, 0, len(req.History)+1)
+	for _, turn := range req.History {
+		parts = append(parts, turn.Prompt)
+	}
+	parts = append(parts, req.Prompt)
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConversationCap(t *testing.T) {
+	conv := NewConversation(2)
+	conv.Add(Turn{Prompt: "one"})
+	conv.Add(Turn{Prompt: "two"})
+	conv.Add(Turn{Prompt: "three"})
+
+	turns := conv.Turns()
+	if len(turns) != 2 {
+		t.Fatalf("expected 2 turns, got %d", len(turns))
+	}
+	if turns[0].Prompt != "two" || turns[1].Prompt != "three" {
+		t.Errorf("expected oldest turn to be dropped, got %q, %q", turns[0].Prompt, turns[1].Prompt)
+	}
+
+	conv.Reset()
+	if conv.Len() != 0 {
+		t.Errorf("expected empty conversation after reset, got %d turns", conv.Len())
+	}
+}
+
+func TestBuildMessages(t *testing.T) {
+	tests := []struct {
+		name          string
+		history       []Turn
+		prompt        string
+		expectedRoles []string
+		lastContains  string
+	}{
+		{"no history", nil, "list files", []string{RoleUser}, "list files"},
+		{
+			"one executed turn",
+			[]Turn{{Prompt: "find py files", Command: "find . -name '*.py'", Executed: true, Outcome: "executed successfully"}},
+			"now js files",
+			[]string{RoleUser, RoleAssistant, RoleUser},
+			"executed successfully",
+		},
+		{
+			"outcome defaults",
+			[]Turn{{Prompt: "list files", Command: "ls"}},
+			"make it recursive",
+			[]string{RoleUser, RoleAssistant, RoleUser},
+			"not executed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := BuildMessages(tt.history, tt.prompt)
+
+			if len(messages) != len(tt.expectedRoles) {
+				t.Fatalf("BuildMessages() returned %d messages, expected %d", len(messages), len(tt.expectedRoles))
+			}
+			for i, msg := range messages {
+				if msg.Role != tt.expectedRoles[i] {
+					t.Errorf("message %d role = %q, expected %q", i, msg.Role, tt.expectedRoles[i])
+				}
+			}
+
+			last := messages[len(messages)-1].Content
+			if !strings.Contains(last, tt.lastContains) || !strings.HasSuffix(last, tt.prompt) {
+				t.Errorf("last message = %q, expected it to contain %q and end with %q", last, tt.lastContains, tt.prompt)
+			}
+		})
+	}
+}
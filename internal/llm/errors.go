@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/Hermithic/aiask/internal/ollama"
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+// StatusCode returns the HTTP status code of a provider API error, or 0 if
+// the error did not come from an HTTP response
+func StatusCode(err error) int {
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return openaiErr.StatusCode
+	}
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode
+	}
+	var clientErr genai.ClientError
+	if errors.As(err, &clientErr) {
+		return clientErr.Code
+	}
+	var serverErr genai.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.Code
+	}
+	var ollamaErr *ollama.StatusError
+	if errors.As(err, &ollamaErr) {
+		return ollamaErr.StatusCode
+	}
+	return 0
+}
+
+// isUnavailable reports whether an error means the provider could not be
+// reached or did not answer: timeouts, refused or failed connections, server
+// errors and rejected credentials. Other providers may still succeed.
+func isUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	switch code := StatusCode(err); {
+	case code >= 500:
+		return true
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return true
+	}
+	return false
+}
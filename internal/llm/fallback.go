@@ -0,0 +1,262 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/probe"
+)
+
+// ReportingProvider is an optional interface for providers that can tell
+// which underlying provider answered the last request
+type ReportingProvider interface {
+	Provider
+	// AnsweredBy returns the provider and model that answered the last request
+	AnsweredBy() (config.Provider, string)
+}
+
+// AnsweredBy returns the provider and model that answered the last request,
+// falling back to the configured ones
+func AnsweredBy(p Provider, cfg *config.Config) (config.Provider, string) {
+	if reporter, ok := p.(ReportingProvider); ok {
+		if name, model := reporter.AnsweredBy(); name != "" {
+			return name, model
+		}
+	}
+	return cfg.Provider, cfg.Model
+}
+
+// fallbackMember is one provider in a fallback chain
+type fallbackMember struct {
+	name     config.Provider
+	model    string
+	provider Provider
+}
+
+// FallbackProvider tries a list of providers in order, moving on to the next
+// one when a provider is unavailable (timeouts, connection errors, 5xx
+// responses or rejected credentials)
+type FallbackProvider struct {
+	members []fallbackMember
+
+	// OnFailover, if set, is called when a provider fails and the next one is tried
+	OnFailover func(name config.Provider, model string, err error)
+
+	// attemptTimeout is how long a provider other than the last has to start
+	// answering; zero gives it half the time left
+	attemptTimeout time.Duration
+
+	mu       sync.Mutex
+	answered fallbackMember
+}
+
+// NewFallbackProvider creates a provider for the main config followed by its fallbacks
+func NewFallbackProvider(cfg *config.Config) (*FallbackProvider, error) {
+	main := *cfg
+	main.Fallbacks = nil
+	configs := []*config.Config{&main}
+	for _, fb := range cfg.Fallbacks {
+		configs = append(configs, cfg.WithProvider(fb))
+	}
+
+	f := &FallbackProvider{attemptTimeout: cfg.GetFallbackAfter()}
+	for i, c := range configs {
+		provider, err := newSingleProvider(c)
+		if err != nil {
+			f.Close()
+			if i == 0 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("fallback %d (%s): %w", i, c.Provider, err)
+		}
+		f.members = append(f.members, fallbackMember{name: c.Provider, model: c.Model, provider: provider})
+	}
+	return f, nil
+}
+
+// Close releases resources held by all providers in the chain
+func (f *FallbackProvider) Close() error {
+	var firstErr error
+	for _, m := range f.members {
+		if err := CloseProvider(m.provider); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// AnsweredBy returns the provider and model that answered the last request
+func (f *FallbackProvider) AnsweredBy() (config.Provider, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.answered.name, f.answered.model
+}
+
+// Chain returns a description of the providers in order, e.g. "ollama (llama3.2) → anthropic (claude-…)"
+func (f *FallbackProvider) Chain() string {
+	names := make([]string, len(f.members))
+	for i, m := range f.members {
+		names[i] = fmt.Sprintf("%s (%s)", m.name, m.model)
+	}
+	return strings.Join(names, " → ")
+}
+
+// GenerateCommand generates a command with the first available provider
+func (f *FallbackProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	var result *CommandResult
+	err := f.try(ctx, func(ctx context.Context, p Provider, answering func()) error {
+		var err error
+		result, err = p.GenerateCommand(ctx, req)
+		return err
+	})
+	return result, err
+}
+
+// GenerateCommandStream streams a command from the first available provider.
+// Providers without streaming support deliver the whole command as one chunk.
+// Once output has been streamed, errors are returned instead of failing over.
+func (f *FallbackProvider) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	var result *CommandResult
+	streamed := false
+	err := f.try(ctx, func(ctx context.Context, p Provider, answering func()) error {
+		var err error
+		if sp, ok := p.(StreamingProvider); ok {
+			result, err = sp.GenerateCommandStream(ctx, req, func(chunk string) {
+				streamed = true
+				answering()
+				callback(chunk)
+			})
+		} else if result, err = p.GenerateCommand(ctx, req); err == nil {
+			callback(result.Command())
+		}
+		if err != nil && streamed {
+			return permanent{err}
+		}
+		return err
+	})
+	return result, err
+}
+
+// GenerateCommandWithTools generates a command with the first available
+// provider, letting it call probing tools if it supports them
+func (f *FallbackProvider) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	var result *CommandResult
+	err := f.try(ctx, func(ctx context.Context, p Provider, answering func()) error {
+		var err error
+		result, err = generateWithTools(ctx, p, req, tools)
+		return err
+	})
+	return result, err
+}
+
+// ExplainCommand explains a command with the first available provider
+func (f *FallbackProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	var explanation string
+	err := f.try(ctx, func(ctx context.Context, p Provider, answering func()) error {
+		var err error
+		explanation, err = p.ExplainCommand(ctx, req)
+		return err
+	})
+	return explanation, err
+}
+
+// ExplainCommandStream streams an explanation from the first available
+// provider. Once output has been streamed, errors are returned instead of
+// failing over.
+func (f *FallbackProvider) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	var explanation string
+	streamed := false
+	err := f.try(ctx, func(ctx context.Context, p Provider, answering func()) error {
+		var err error
+		explanation, err = explainStream(ctx, p, req, func(chunk string) {
+			streamed = true
+			answering()
+			callback(chunk)
+		})
+		if err != nil && streamed {
+			return permanent{err}
+		}
+		return err
+	})
+	return explanation, err
+}
+
+// ReviewCommand reviews a command with the first available provider
+func (f *FallbackProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	var review *Review
+	err := f.try(ctx, func(ctx context.Context, p Provider, answering func()) error {
+		var err error
+		review, err = reviewCommand(ctx, p, req)
+		return err
+	})
+	return review, err
+}
+
+// permanent marks an error that must not trigger a failover
+type permanent struct{ error }
+
+func (p permanent) Unwrap() error { return p.error }
+
+// errAttemptTimeout ends the attempt of a provider that didn't start
+// answering in time
+var errAttemptTimeout = errors.New("no answer in time")
+
+// try calls fn with each provider in turn until one succeeds or fails with an
+// error other than unavailability. A provider other than the last has until
+// the attempt timeout (by default half the time left) to start answering, so
+// a hanging provider leaves time for the next one. fn calls answering when
+// output starts streaming, after which the provider may use the whole
+// timeout.
+func (f *FallbackProvider) try(ctx context.Context, fn func(ctx context.Context, p Provider, answering func()) error) error {
+	var errs []string
+	for i, m := range f.members {
+		last := i == len(f.members)-1
+		attemptCtx, cancel := context.WithCancelCause(ctx)
+		answering := func() {}
+		timeout := f.attemptTimeout
+		if !last {
+			if deadline, ok := ctx.Deadline(); ok && timeout == 0 {
+				timeout = time.Until(deadline) / 2
+			}
+			if timeout > 0 {
+				timer := time.AfterFunc(timeout, func() { cancel(errAttemptTimeout) })
+				answering = func() { timer.Stop() }
+			}
+		}
+		err := fn(attemptCtx, m.provider, answering)
+		answering()
+		expired := errors.Is(context.Cause(attemptCtx), errAttemptTimeout)
+		cancel(nil)
+
+		if err == nil {
+			f.mu.Lock()
+			f.answered = m
+			f.mu.Unlock()
+			return nil
+		}
+		if p, ok := err.(permanent); ok {
+			return p.error
+		}
+		if expired {
+			err = fmt.Errorf("no answer within %v: %w", timeout.Round(time.Millisecond), context.DeadlineExceeded)
+		}
+
+		if last || ctx.Err() != nil || !(expired || isUnavailable(err)) {
+			if len(errs) == 0 {
+				return err
+			}
+			return fmt.Errorf("%s; %s: %w", strings.Join(errs, "; "), m.name, err)
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %v", m.name, err))
+		if f.OnFailover != nil {
+			f.OnFailover(m.name, m.model, err)
+		}
+	}
+	return fmt.Errorf("no providers configured")
+}
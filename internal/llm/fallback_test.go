@@ -0,0 +1,189 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/openai/openai-go"
+)
+
+// fakeProvider returns a fixed command or error
+type fakeProvider struct {
+	command  string
+	err      error
+	calls    int
+	deadline time.Time
+}
+
+func (p *fakeProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	p.calls++
+	p.deadline, _ = ctx.Deadline()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &CommandResult{Commands: []string{p.command}}, nil
+}
+
+func (p *fakeProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	p.calls++
+	if p.err != nil {
+		return "", p.err
+	}
+	return "explains " + req.Command, nil
+}
+
+func newTestChain(providers ...*fakeProvider) *FallbackProvider {
+	f := &FallbackProvider{}
+	for i, p := range providers {
+		f.members = append(f.members, fallbackMember{name: config.Provider(fmt.Sprintf("p%d", i)), model: "m", provider: p})
+	}
+	return f
+}
+
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"deadline", fmt.Errorf("API request failed: %w", context.DeadlineExceeded), true},
+		{"canceled", context.Canceled, false},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"server error", &openai.Error{StatusCode: 503}, true},
+		{"unauthorized", fmt.Errorf("wrapped: %w", &openai.Error{StatusCode: 401}), true},
+		{"bad request", &openai.Error{StatusCode: 400}, false},
+		{"parse error", errors.New("no command found in response"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnavailable(tt.err); got != tt.expected {
+				t.Errorf("isUnavailable(%v) = %v, expected %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFallbackProviderFailsOver(t *testing.T) {
+	down := &fakeProvider{err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}
+	up := &fakeProvider{command: "ls"}
+	chain := newTestChain(down, up)
+
+	var failedOver []config.Provider
+	chain.OnFailover = func(name config.Provider, model string, err error) {
+		failedOver = append(failedOver, name)
+	}
+
+	result, err := chain.GenerateCommand(context.Background(), GenerateRequest{Prompt: "list"})
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if result.Command() != "ls" {
+		t.Errorf("command = %q, expected %q", result.Command(), "ls")
+	}
+	if name, _ := chain.AnsweredBy(); name != "p1" {
+		t.Errorf("AnsweredBy = %q, expected p1", name)
+	}
+	if len(failedOver) != 1 || failedOver[0] != "p0" {
+		t.Errorf("OnFailover called for %v, expected [p0]", failedOver)
+	}
+}
+
+func TestFallbackProviderStopsOnOtherErrors(t *testing.T) {
+	bad := &fakeProvider{err: &openai.Error{StatusCode: 400}}
+	next := &fakeProvider{command: "ls"}
+	chain := newTestChain(bad, next)
+
+	if _, err := chain.ExplainCommand(context.Background(), ExplainRequest{Command: "ls"}); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if next.calls != 0 {
+		t.Errorf("next provider called %d times, expected 0", next.calls)
+	}
+}
+
+// slowProvider takes its time to answer. With streaming, it starts with a
+// chunk right away.
+type slowProvider struct {
+	delay time.Duration
+}
+
+func (p *slowProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	select {
+	case <-time.After(p.delay):
+		return &CommandResult{Commands: []string{"slow"}}, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("API request failed: %w", ctx.Err())
+	}
+}
+
+func (p *slowProvider) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	callback("slow")
+	return p.GenerateCommand(ctx, req)
+}
+
+func (p *slowProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func TestFallbackProviderAttemptTimeout(t *testing.T) {
+	hanging := &slowProvider{delay: time.Hour}
+	up := &fakeProvider{command: "ls"}
+	chain := &FallbackProvider{members: []fallbackMember{{name: "hanging", provider: hanging}, {name: "up", provider: up}}}
+	var failoverErr error
+	chain.OnFailover = func(name config.Provider, model string, err error) {
+		failoverErr = err
+	}
+
+	// A hanging provider has half the timeout before the next one is tried
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := chain.GenerateCommand(ctx, GenerateRequest{Prompt: "list"})
+	if err != nil || result.Command() != "ls" {
+		t.Fatalf("GenerateCommand = %v, %v", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("failover took %v", elapsed)
+	}
+	if !errors.Is(failoverErr, context.DeadlineExceeded) {
+		t.Errorf("failover error = %v", failoverErr)
+	}
+	if deadline, _ := ctx.Deadline(); !up.deadline.Equal(deadline) {
+		t.Errorf("last provider got deadline %v, expected the rest of %v", up.deadline, deadline)
+	}
+
+	// fallback_after sets the time instead, and once a provider streams
+	// output it may use the whole timeout
+	slow := &slowProvider{delay: 100 * time.Millisecond}
+	chain = &FallbackProvider{members: []fallbackMember{{name: "slow", provider: slow}, {name: "up", provider: up}}, attemptTimeout: 20 * time.Millisecond}
+	if result, err := chain.GenerateCommand(context.Background(), GenerateRequest{Prompt: "list"}); err != nil || result.Command() != "ls" {
+		t.Errorf("GenerateCommand = %v, %v", result, err)
+	}
+	result, err = chain.GenerateCommandStream(context.Background(), GenerateRequest{Prompt: "list"}, func(string) {})
+	if err != nil || result.Command() != "slow" {
+		t.Errorf("GenerateCommandStream = %v, %v", result, err)
+	}
+}
+
+func TestFallbackProviderAllUnavailable(t *testing.T) {
+	chain := newTestChain(
+		&fakeProvider{err: context.DeadlineExceeded},
+		&fakeProvider{err: &openai.Error{StatusCode: 502}},
+	)
+
+	_, err := chain.GenerateCommand(context.Background(), GenerateRequest{Prompt: "list"})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		t.Errorf("expected the last provider's error to be wrapped, got %v", err)
+	}
+}
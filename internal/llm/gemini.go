@@ -4,16 +4,59 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 
-	"github.com/Hermithic/aiask/internal/shell"
 	"google.golang.org/genai"
 )
 
+// geminiCandidateSchema is the response schema of a single candidate solution
+var geminiCandidateSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"commands":     {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"explanation":  {Type: genai.TypeString},
+		"assumptions":  {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"placeholders": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"risk":         {Type: genai.TypeString, Enum: []string{RiskLow, RiskMedium, RiskHigh}},
+	},
+	Required: []string{"commands"},
+}
+
+// geminiCommandResultSchema is the response schema of a CommandResult for Gemini's JSON mode
+var geminiCommandResultSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"commands":     geminiCandidateSchema.Properties["commands"],
+		"explanation":  geminiCandidateSchema.Properties["explanation"],
+		"assumptions":  geminiCandidateSchema.Properties["assumptions"],
+		"placeholders": geminiCandidateSchema.Properties["placeholders"],
+		"risk":         geminiCandidateSchema.Properties["risk"],
+		"alternatives": {Type: genai.TypeArray, Items: geminiCandidateSchema},
+	},
+	Required: []string{"commands"},
+}
+
+// geminiReviewSchema is the response schema of a Review
+var geminiReviewSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"issues":      {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"commands":    {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		"explanation": geminiCandidateSchema.Properties["explanation"],
+		"risk":        geminiCandidateSchema.Properties["risk"],
+	},
+	Required: []string{"issues", "commands"},
+}
+
 // Gemini is a provider for Google's Gemini API
 type Gemini struct {
 	client             *genai.Client
 	model              string
 	systemPromptSuffix string
+
+	// The genai client has no model listing, so ListModels calls the REST API
+	apiKey     string
+	httpClient *http.Client
 }
 
 // Close releases resources associated with the Gemini client
@@ -23,15 +66,17 @@ func (g *Gemini) Close() error {
 }
 
 // NewGemini creates a new Gemini provider
-func NewGemini(apiKey, model, systemPromptSuffix string) (*Gemini, error) {
+// Requests are sent through httpClient, which handles retries
+func NewGemini(apiKey, model, systemPromptSuffix string, httpClient *http.Client) (*Gemini, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("API key is required for Gemini")
 	}
 
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
+		APIKey:     apiKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: httpClient,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
@@ -41,48 +86,64 @@ func NewGemini(apiKey, model, systemPromptSuffix string) (*Gemini, error) {
 		client:             client,
 		model:              model,
 		systemPromptSuffix: systemPromptSuffix,
+		apiKey:             apiKey,
+		httpClient:         httpClient,
 	}, nil
 }
 
 // GenerateCommand generates a shell command using Google's Gemini API
-func (g *Gemini) GenerateCommand(ctx context.Context, prompt string, shellInfo shell.ShellInfo) (string, error) {
-	systemPrompt := BuildSmartSystemPrompt(shellInfo, g.systemPromptSuffix, prompt)
-	fullPrompt := systemPrompt + "\n\nUser request: " + prompt
+// The model is asked for JSON matching the command result schema
+func (g *Gemini) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	systemPrompt, err := BuildStructuredSystemPrompt(req, g.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
 
-	resp, err := g.client.Models.GenerateContent(ctx, g.model, genai.Text(fullPrompt), nil)
+	config := geminiConfig(systemPrompt)
+	config.ResponseMIMEType = "application/json"
+	config.ResponseSchema = geminiCommandResultSchema
+
+	resp, err := g.client.Models.GenerateContent(ctx, g.model, geminiContents(req), config)
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %w", err)
+		return nil, fmt.Errorf("API request failed: %w", err)
 	}
+	reportGeminiUsage(ctx, resp.UsageMetadata)
 
 	// Extract text from response
 	if len(resp.Candidates) == 0 {
-		return "", fmt.Errorf("no response from API")
+		return nil, fmt.Errorf("no response from API")
 	}
 
 	candidate := resp.Candidates[0]
 	if candidate.Content == nil || len(candidate.Content.Parts) == 0 {
-		return "", fmt.Errorf("empty response from API")
+		return nil, fmt.Errorf("empty response from API")
 	}
 
 	// Get the text from the first part
 	for _, part := range candidate.Content.Parts {
 		if part.Text != "" {
-			return part.Text, nil
+			return ParseCommandResult(traceResponse(ctx, part.Text))
 		}
 	}
 
-	return "", fmt.Errorf("no text response from API")
+	return nil, fmt.Errorf("no text response from API")
 }
 
 // ExplainCommand explains what a shell command does
-func (g *Gemini) ExplainCommand(ctx context.Context, command string) (string, error) {
-	systemPrompt := BuildExplainPrompt()
-	fullPrompt := systemPrompt + "\n\nCommand to explain: " + command
+func (g *Gemini) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
+	fullPrompt := systemPrompt + "\n\nCommand to explain: " + explainMessage(req)
 
 	resp, err := g.client.Models.GenerateContent(ctx, g.model, genai.Text(fullPrompt), nil)
 	if err != nil {
 		return "", fmt.Errorf("API request failed: %w", err)
 	}
+	reportGeminiUsage(ctx, resp.UsageMetadata)
 
 	// Extract text from response
 	if len(resp.Candidates) == 0 {
@@ -97,21 +158,78 @@ func (g *Gemini) ExplainCommand(ctx context.Context, command string) (string, er
 	// Get the text from the first part
 	for _, part := range candidate.Content.Parts {
 		if part.Text != "" {
-			return part.Text, nil
+			return traceResponse(ctx, part.Text), nil
 		}
 	}
 
 	return "", fmt.Errorf("no text response from API")
 }
 
+// ReviewCommand checks a command for mistakes in a second pass, asking for
+// JSON matching the review schema
+func (g *Gemini) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	config := geminiConfig(BuildReviewPrompt(req.ShellInfo))
+	config.ResponseMIMEType = "application/json"
+	config.ResponseSchema = geminiReviewSchema
+
+	resp, err := g.client.Models.GenerateContent(ctx, g.model, genai.Text(req.Command), config)
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	reportGeminiUsage(ctx, resp.UsageMetadata)
+
+	if len(resp.Candidates) == 0 {
+		return nil, fmt.Errorf("no response from API")
+	}
+
+	candidate := resp.Candidates[0]
+	if candidate.Content == nil || len(candidate.Content.Parts) == 0 {
+		return nil, fmt.Errorf("empty response from API")
+	}
+
+	for _, part := range candidate.Content.Parts {
+		if part.Text != "" {
+			return ParseReview(part.Text)
+		}
+	}
+
+	return nil, fmt.Errorf("no text response from API")
+}
+
 // GenerateCommandStream generates a shell command with streaming output
-func (g *Gemini) GenerateCommandStream(ctx context.Context, prompt string, shellInfo shell.ShellInfo, callback func(chunk string)) (string, error) {
-	systemPrompt := BuildSmartSystemPrompt(shellInfo, g.systemPromptSuffix, prompt)
-	fullPrompt := systemPrompt + "\n\nUser request: " + prompt
+func (g *Gemini) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	systemPrompt, err := BuildSmartSystemPrompt(req, g.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
 
-	stream := g.client.Models.GenerateContentStream(ctx, g.model, genai.Text(fullPrompt), nil)
+	fullContent, err := g.streamText(ctx, geminiContents(req), geminiConfig(systemPrompt), callback)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCommandResult(fullContent)
+}
+
+// ExplainCommandStream explains what a shell command does with streaming output
+func (g *Gemini) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
+	fullPrompt := systemPrompt + "\n\nCommand to explain: " + explainMessage(req)
+	return g.streamText(ctx, genai.Text(fullPrompt), nil, callback)
+}
+
+// streamText streams generated content, passing each piece of text to
+// callback, and returns the full text
+func (g *Gemini) streamText(ctx context.Context, contents []*genai.Content, config *genai.GenerateContentConfig, callback func(chunk string)) (string, error) {
+	stream := g.client.Models.GenerateContentStream(ctx, g.model, contents, config)
 
 	var fullContent string
+	var usage *genai.GenerateContentResponseUsageMetadata
 	for chunk, err := range stream {
 		if err == io.EOF {
 			break
@@ -119,6 +237,10 @@ func (g *Gemini) GenerateCommandStream(ctx context.Context, prompt string, shell
 		if err != nil {
 			return "", fmt.Errorf("streaming API request failed: %w", err)
 		}
+		// Each chunk carries the usage so far; the last one is the total
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
 
 		// Extract text from the chunk
 		text, textErr := chunk.Text()
@@ -132,6 +254,47 @@ func (g *Gemini) GenerateCommandStream(ctx context.Context, prompt string, shell
 			}
 		}
 	}
+	reportGeminiUsage(ctx, usage)
+
+	return traceResponse(ctx, fullContent), nil
+}
+
+// reportGeminiUsage reports the token counts of a Gemini response, if present
+func reportGeminiUsage(ctx context.Context, usage *genai.GenerateContentResponseUsageMetadata) {
+	if usage == nil {
+		return
+	}
+	var input, output int64
+	if usage.PromptTokenCount != nil {
+		input = *usage.PromptTokenCount
+	}
+	if usage.CandidatesTokenCount != nil {
+		output = *usage.CandidatesTokenCount
+	}
+	reportUsage(ctx, input, output)
+}
+
+// geminiContents builds the contents for a generate request, including any conversation history
+func geminiContents(req GenerateRequest) []*genai.Content {
+	var contents []*genai.Content
+	for _, msg := range BuildMessages(req.History, req.Prompt) {
+		role := "user"
+		if msg.Role == RoleAssistant {
+			role = "model"
+		}
+		contents = append(contents, &genai.Content{
+			Role:  role,
+			Parts: []*genai.Part{{Text: msg.Content}},
+		})
+	}
+	return contents
+}
 
-	return fullContent, nil
+// geminiConfig builds a generation config carrying the system prompt as a system instruction
+func geminiConfig(systemPrompt string) *genai.GenerateContentConfig {
+	return &genai.GenerateContentConfig{
+		SystemInstruction: &genai.Content{
+			Parts: []*genai.Part{{Text: systemPrompt}},
+		},
+	}
 }
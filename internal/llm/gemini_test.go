@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestGeminiGenerateCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":%q}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":6,"totalTokenCount":46}}`, `{"commands":["ls -la"],"risk":"low"}`)
+	}))
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	provider, err := NewGemini("key", "gemini-2.0-flash", "", &http.Client{Transport: rewriteTransport{target}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := provider.GenerateCommand(context.Background(), GenerateRequest{Prompt: "list files", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}})
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if result.Command() != "ls -la" || result.Risk != RiskLow {
+		t.Errorf("result = %+v", result)
+	}
+	config, _ := body["generationConfig"].(map[string]interface{})
+	if config["responseMimeType"] != "application/json" || config["responseSchema"] == nil {
+		t.Errorf("generation config = %v", config)
+	}
+}
+
+func TestGeminiReviewCommand(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":%q}]},"finishReason":"STOP"}]}`, `{"issues":["-r is needed for directories"],"commands":["rm -r build"],"explanation":"Removes the build directory","risk":"high"}`)
+	}))
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	provider, err := NewGemini("key", "gemini-2.0-flash", "", &http.Client{Transport: rewriteTransport{target}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := provider.ReviewCommand(context.Background(), ReviewRequest{Command: "rm build", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}})
+	if err != nil {
+		t.Fatalf("ReviewCommand returned error: %v", err)
+	}
+	if review.Command() != "rm -r build" || review.Explanation != "Removes the build directory" || review.Risk != RiskHigh {
+		t.Errorf("review = %+v", review)
+	}
+	config, _ := body["generationConfig"].(map[string]interface{})
+	schema, _ := config["responseSchema"].(map[string]interface{})
+	properties, _ := schema["properties"].(map[string]interface{})
+	if properties["explanation"] == nil || properties["risk"] == nil {
+		t.Errorf("review schema = %v", schema)
+	}
+}
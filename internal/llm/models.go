@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// geminiModelsURL is the REST endpoint listing Gemini models
+const geminiModelsURL = "https://generativelanguage.googleapis.com/v1beta/models"
+
+// ModelInfo describes a model offered by a provider
+type ModelInfo struct {
+	ID            string    `json:"id"`                       // Name to use in the model setting
+	DisplayName   string    `json:"display_name,omitempty"`   // Human-readable name, if the provider has one
+	ContextWindow int       `json:"context_window,omitempty"` // Input tokens the model accepts, if known
+	MaxOutput     int       `json:"max_output,omitempty"`     // Output tokens the model can generate, if known
+	Details       string    `json:"details,omitempty"`        // Provider-specific details such as the owner or quantization
+	Size          int64     `json:"size,omitempty"`           // Bytes on disk, for local models
+	Created       time.Time `json:"created,omitempty"`
+}
+
+// ModelLister is an optional interface for providers that can list the models they offer
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// ListModels lists the models offered by the provider in the config, sorted
+// by ID. Fallback providers are not included.
+func ListModels(ctx context.Context, cfg *config.Config) ([]ModelInfo, error) {
+	if cfg.Provider == config.ProviderAzure {
+		return nil, fmt.Errorf("azure routes requests by deployment name; deployments are listed in the Azure portal")
+	}
+
+	// The model may not be chosen yet, but some providers require one
+	single := *cfg
+	if single.Model == "" {
+		single.Model = "unset"
+	}
+	provider, err := newClient(&single)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseProvider(provider)
+
+	lister, ok := provider.(ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("the %s provider cannot list models", cfg.Provider)
+	}
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// HasModel reports whether name is among the models. A name without a tag
+// also matches its ":latest" tag, as in Ollama.
+func HasModel(models []ModelInfo, name string) bool {
+	for _, m := range models {
+		if m.ID == name || m.ID == name+":latest" {
+			return true
+		}
+	}
+	return false
+}
+
+// ListModels lists the models of an OpenAI-compatible server. Context sizes
+// are read from the fields some servers add, such as context_length
+// (OpenRouter, LM Studio) and max_model_len (vLLM).
+func (o *OpenAICompatible) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	pager := o.client.Models.ListAutoPaging(ctx)
+	for pager.Next() {
+		m := pager.Current()
+		info := ModelInfo{ID: m.ID, Details: m.OwnedBy}
+		if m.Created > 0 {
+			info.Created = time.Unix(m.Created, 0)
+		}
+
+		var extra struct {
+			ContextLength    int `json:"context_length"`
+			MaxContextLength int `json:"max_context_length"`
+			MaxModelLen      int `json:"max_model_len"`
+			ContextWindow    int `json:"context_window"`
+		}
+		if json.Unmarshal([]byte(m.RawJSON()), &extra) == nil {
+			for _, n := range []int{extra.ContextLength, extra.MaxContextLength, extra.MaxModelLen, extra.ContextWindow} {
+				if n > 0 {
+					info.ContextWindow = n
+					break
+				}
+			}
+		}
+		models = append(models, info)
+	}
+	if err := pager.Err(); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// ListModels lists the Claude models available to the API key
+func (a *Anthropic) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	pager := a.client.Models.ListAutoPaging(ctx, anthropic.ModelListParams{})
+	for pager.Next() {
+		m := pager.Current()
+		models = append(models, ModelInfo{ID: m.ID, DisplayName: m.DisplayName, Created: m.CreatedAt})
+	}
+	if err := pager.Err(); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// ListModels lists the Gemini models that can generate content, with their
+// token limits
+func (g *Gemini) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	pageToken := ""
+	for {
+		query := url.Values{"pageSize": {"1000"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, geminiModelsURL+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		// The key goes in a header, so errors that quote the URL don't show it
+		req.Header.Set("x-goog-api-key", g.apiKey)
+		resp, err := g.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Models []struct {
+				Name                       string   `json:"name"`
+				DisplayName                string   `json:"displayName"`
+				InputTokenLimit            int      `json:"inputTokenLimit"`
+				OutputTokenLimit           int      `json:"outputTokenLimit"`
+				SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+			} `json:"models"`
+			NextPageToken string `json:"nextPageToken"`
+			Error         *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse model list: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			if page.Error != nil {
+				return nil, fmt.Errorf("%s (status %d)", page.Error.Message, resp.StatusCode)
+			}
+			return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+
+		for _, m := range page.Models {
+			// Skip embedding and other models that can't answer prompts
+			generates := false
+			for _, method := range m.SupportedGenerationMethods {
+				generates = generates || method == "generateContent"
+			}
+			if !generates {
+				continue
+			}
+			models = append(models, ModelInfo{
+				ID:            strings.TrimPrefix(m.Name, "models/"),
+				DisplayName:   m.DisplayName,
+				ContextWindow: m.InputTokenLimit,
+				MaxOutput:     m.OutputTokenLimit,
+			})
+		}
+		if page.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// ListModels lists the models installed on the Ollama server, with their
+// context length when the server reports it
+func (o *Ollama) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	installed, err := o.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(installed))
+	for _, m := range installed {
+		info := ModelInfo{ID: m.Name, Created: m.ModifiedAt, Size: m.Size}
+		if m.Details.ParameterSize != "" {
+			info.Details = strings.TrimSpace(m.Details.ParameterSize + " " + m.Details.QuantizationLevel)
+		}
+		// Older servers don't report model details, so a failure is not an error
+		if show, err := o.client.Show(ctx, m.Name); err == nil {
+			info.ContextWindow = show.ContextLength()
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+func TestListModelsOpenAICompatible(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"qwen2.5-coder","object":"model","created":1700000000,"owned_by":"vllm","max_model_len":32768},{"id":"llama-3.1-8b","object":"model","created":0,"owned_by":"library"}]}`)
+	}))
+	defer server.Close()
+
+	// The model isn't required to list models
+	models, err := ListModels(context.Background(), &config.Config{
+		Provider: config.ProviderOpenAICompatible,
+		BaseURL:  server.URL + "/v1",
+		Retry:    &config.RetryConfig{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("ListModels returned error: %v", err)
+	}
+	if len(models) != 2 || models[0].ID != "llama-3.1-8b" || models[1].ContextWindow != 32768 || models[1].Details != "vllm" {
+		t.Errorf("ListModels returned %+v", models)
+	}
+	if !models[0].Created.IsZero() {
+		t.Errorf("created = %v, expected zero", models[0].Created)
+	}
+}
+
+func TestListModelsGemini(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.Query().Get("pageToken"))
+		if r.Header.Get("x-goog-api-key") != "key" || r.URL.Query().Has("key") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"API key not valid"}}`)
+			return
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprint(w, `{"models":[{"name":"models/gemini-2.0-flash","displayName":"Gemini 2.0 Flash","inputTokenLimit":1048576,"outputTokenLimit":8192,"supportedGenerationMethods":["generateContent","countTokens"]}],"nextPageToken":"p2"}`)
+			return
+		}
+		fmt.Fprint(w, `{"models":[{"name":"models/text-embedding-004","supportedGenerationMethods":["embedContent"]}]}`)
+	}))
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	client := &http.Client{Transport: rewriteTransport{target}}
+	provider, err := NewGemini("key", "gemini-2.0-flash", "", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels returned error: %v", err)
+	}
+	if len(pages) != 2 || pages[1] != "p2" {
+		t.Errorf("requested pages %q", pages)
+	}
+	// Embedding models are left out
+	if len(models) != 1 || models[0].ID != "gemini-2.0-flash" || models[0].ContextWindow != 1048576 || models[0].MaxOutput != 8192 {
+		t.Errorf("ListModels returned %+v", models)
+	}
+
+	provider, _ = NewGemini("wrong", "gemini-2.0-flash", "", client)
+	if _, err := provider.ListModels(context.Background()); err == nil || err.Error() != "API key not valid (status 400)" {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestListModelsOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"llama3.2:latest","size":2019393189,"details":{"parameter_size":"3.2B","quantization_level":"Q4_K_M"}}]}`)
+		case "/api/show":
+			fmt.Fprint(w, `{"model_info":{"llama.context_length":131072}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	models, err := ListModels(context.Background(), &config.Config{Provider: config.ProviderOllama, OllamaURL: server.URL, Retry: &config.RetryConfig{MaxAttempts: 1}})
+	if err != nil {
+		t.Fatalf("ListModels returned error: %v", err)
+	}
+	if len(models) != 1 || models[0].ContextWindow != 131072 || models[0].Details != "3.2B Q4_K_M" || models[0].Size != 2019393189 {
+		t.Errorf("ListModels returned %+v", models)
+	}
+	if !HasModel(models, "llama3.2") || HasModel(models, "llama3") {
+		t.Error("HasModel did not match the tag rules")
+	}
+}
+
+func TestListModelsUnsupported(t *testing.T) {
+	for _, cfg := range []*config.Config{
+		{Provider: config.ProviderAzure, BaseURL: "https://example.openai.azure.com", Model: "gpt-4o"},
+		{Provider: config.ProviderReplay, Cassette: "testdata/missing.json"},
+	} {
+		if _, err := ListModels(context.Background(), cfg); err == nil {
+			t.Errorf("ListModels(%s) returned no error", cfg.Provider)
+		}
+	}
+}
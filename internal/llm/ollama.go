@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/ollama"
+)
+
+// Ollama is a provider for the native Ollama API
+type Ollama struct {
+	client             *ollama.Client
+	model              string
+	systemPromptSuffix string
+	options            *ollama.Options
+	keepAlive          interface{}
+}
+
+// NewOllama creates a new Ollama provider for the server at baseURL
+// Requests are sent through httpClient, which handles retries
+func NewOllama(baseURL, model, systemPromptSuffix string, opts *config.OllamaConfig, httpClient *http.Client) (*Ollama, error) {
+	o := &Ollama{
+		client:             ollama.New(baseURL, httpClient),
+		model:              model,
+		systemPromptSuffix: systemPromptSuffix,
+	}
+	if opts != nil {
+		if opts.NumCtx > 0 {
+			o.options = &ollama.Options{NumCtx: opts.NumCtx}
+		}
+		o.keepAlive = ollama.KeepAlive(opts.KeepAlive)
+	}
+	return o, nil
+}
+
+// chatRequest builds a chat request with the configured model options
+func (o *Ollama) chatRequest(messages []ollama.Message, format string) ollama.ChatRequest {
+	return ollama.ChatRequest{
+		Model:     o.model,
+		Messages:  messages,
+		Format:    format,
+		Options:   o.options,
+		KeepAlive: o.keepAlive,
+	}
+}
+
+// GenerateCommand generates a shell command using Ollama
+// The model is asked for a JSON object using Ollama's JSON format
+func (o *Ollama) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	systemPrompt, err := BuildStructuredSystemPrompt(req, o.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
+
+	resp, err := o.client.Chat(ctx, o.chatRequest(ollamaMessages(systemPrompt, req), "json"))
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	reportUsage(ctx, resp.PromptEvalCount, resp.EvalCount)
+
+	return ParseCommandResult(traceResponse(ctx, resp.Message.Content))
+}
+
+// ExplainCommand explains what a shell command does
+func (o *Ollama) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
+	messages := []ollama.Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: RoleUser, Content: explainMessage(req)},
+	}
+
+	resp, err := o.client.Chat(ctx, o.chatRequest(messages, ""))
+	if err != nil {
+		return "", fmt.Errorf("API request failed: %w", err)
+	}
+	reportUsage(ctx, resp.PromptEvalCount, resp.EvalCount)
+
+	if resp.Message.Content == "" {
+		return "", fmt.Errorf("no response from API")
+	}
+	return traceResponse(ctx, resp.Message.Content), nil
+}
+
+// ReviewCommand checks a command for mistakes in a second pass, using
+// Ollama's JSON format
+func (o *Ollama) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	messages := []ollama.Message{
+		{Role: "system", Content: BuildReviewPrompt(req.ShellInfo)},
+		{Role: RoleUser, Content: req.Command},
+	}
+
+	resp, err := o.client.Chat(ctx, o.chatRequest(messages, "json"))
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	reportUsage(ctx, resp.PromptEvalCount, resp.EvalCount)
+
+	return ParseReview(resp.Message.Content)
+}
+
+// GenerateCommandStream generates a shell command with streaming output
+func (o *Ollama) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	systemPrompt, err := BuildSmartSystemPrompt(req, o.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
+
+	fullContent, err := o.streamText(ctx, ollamaMessages(systemPrompt, req), callback)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCommandResult(fullContent)
+}
+
+// ExplainCommandStream explains what a shell command does with streaming output
+func (o *Ollama) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
+	return o.streamText(ctx, []ollama.Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: RoleUser, Content: explainMessage(req)},
+	}, callback)
+}
+
+// streamText streams a chat response, passing each piece of text to
+// callback, and returns the full text
+func (o *Ollama) streamText(ctx context.Context, messages []ollama.Message, callback func(chunk string)) (string, error) {
+	var fullContent string
+	final, err := o.client.ChatStream(ctx, o.chatRequest(messages, ""), func(chunk ollama.ChatResponse) {
+		if chunk.Message.Content == "" {
+			return
+		}
+		fullContent += chunk.Message.Content
+		if callback != nil {
+			callback(chunk.Message.Content)
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("streaming API request failed: %w", err)
+	}
+	reportUsage(ctx, final.PromptEvalCount, final.EvalCount)
+
+	return traceResponse(ctx, fullContent), nil
+}
+
+// ollamaMessages builds the chat messages for a generate request, including any conversation history
+func ollamaMessages(systemPrompt string, req GenerateRequest) []ollama.Message {
+	messages := []ollama.Message{{Role: "system", Content: systemPrompt}}
+	for _, msg := range BuildMessages(req.History, req.Prompt) {
+		messages = append(messages, ollama.Message{Role: msg.Role, Content: msg.Content})
+	}
+	return messages
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/ollama"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestOllamaProvider(t *testing.T) {
+	var got ollama.ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"{\"commands\":[\"df -h\"]}"},"done":true,"prompt_eval_count":40,"eval_count":9}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Provider:  config.ProviderOllama,
+		Model:     "llama3.2",
+		OllamaURL: server.URL,
+		Ollama:    &config.OllamaConfig{NumCtx: 4096, KeepAlive: "10m"},
+		Retry:     &config.RetryConfig{MaxAttempts: 1},
+	}
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+
+	ctx, usage := WithUsage(context.Background())
+	result, err := provider.GenerateCommand(ctx, GenerateRequest{Prompt: "disk space", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}})
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if result.Command() != "df -h" {
+		t.Errorf("command = %q, expected %q", result.Command(), "df -h")
+	}
+
+	if got.Model != "llama3.2" || got.Format != "json" || got.Stream {
+		t.Errorf("request = %+v", got)
+	}
+	if got.Options == nil || got.Options.NumCtx != 4096 || got.KeepAlive != "10m" {
+		t.Errorf("options = %+v, keep_alive = %v", got.Options, got.KeepAlive)
+	}
+	if in, out := usage.Tokens(); in != 40 || out != 9 {
+		t.Errorf("usage = %d/%d, expected 40/9", in, out)
+	}
+}
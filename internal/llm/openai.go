@@ -3,32 +3,54 @@ package llm
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync/atomic"
 
-	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/probe"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
 )
 
-// OpenAICompatible is a provider for OpenAI-compatible APIs (OpenAI, Grok, Ollama)
+// OpenAICompatible is a provider for OpenAI-compatible APIs (OpenAI, Grok, Azure, self-hosted servers)
 type OpenAICompatible struct {
 	client             openai.Client
 	model              string
 	systemPromptSuffix string
+
+	// noJSONMode and noStreamUsage are set once the server rejected JSON
+	// mode or stream_options
+	noJSONMode    atomic.Bool
+	noStreamUsage atomic.Bool
 }
 
 // NewOpenAICompatible creates a new OpenAI-compatible provider
-func NewOpenAICompatible(apiKey, baseURL, model, systemPromptSuffix string) (*OpenAICompatible, error) {
-	opts := []option.RequestOption{}
+// Requests are sent through httpClient, which handles retries; extra options
+// such as headers are applied last
+func NewOpenAICompatible(apiKey, baseURL, model, systemPromptSuffix string, httpClient *http.Client, extra ...option.RequestOption) (*OpenAICompatible, error) {
+	opts := []option.RequestOption{
+		option.WithHTTPClient(httpClient),
+		option.WithMaxRetries(0),
+	}
 
 	if apiKey != "" {
 		opts = append(opts, option.WithAPIKey(apiKey))
+	} else {
+		// Don't send OPENAI_API_KEY, OPENAI_ORG_ID and OPENAI_PROJECT_ID from
+		// the environment to another server; configured ones are set by extra
+		opts = append(opts,
+			option.WithHeaderDel("authorization"),
+			option.WithHeaderDel("OpenAI-Organization"),
+			option.WithHeaderDel("OpenAI-Project"),
+		)
 	}
 
 	if baseURL != "" {
 		opts = append(opts, option.WithBaseURL(baseURL))
 	}
 
-	client := openai.NewClient(opts...)
+	client := openai.NewClient(append(opts, extra...)...)
 
 	return &OpenAICompatible{
 		client:             client,
@@ -37,68 +59,244 @@ func NewOpenAICompatible(apiKey, baseURL, model, systemPromptSuffix string) (*Op
 	}, nil
 }
 
+// openAIOptions returns the request options for the organization, project and
+// extra headers in the config
+func openAIOptions(cfg *config.Config) []option.RequestOption {
+	var opts []option.RequestOption
+	if cfg.Organization != "" {
+		opts = append(opts, option.WithOrganization(cfg.Organization))
+	}
+	if cfg.Project != "" {
+		opts = append(opts, option.WithProject(cfg.Project))
+	}
+	for name, value := range cfg.Headers {
+		opts = append(opts, option.WithHeader(name, value))
+	}
+	return opts
+}
+
 // GenerateCommand generates a shell command using an OpenAI-compatible API
-func (o *OpenAICompatible) GenerateCommand(ctx context.Context, prompt string, shellInfo shell.ShellInfo) (string, error) {
-	systemPrompt := BuildSmartSystemPrompt(shellInfo, o.systemPromptSuffix, prompt)
+// The model is asked for a JSON object using JSON mode
+func (o *OpenAICompatible) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	systemPrompt, err := BuildStructuredSystemPrompt(req, o.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
 
-	resp, err := o.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:     openai.ChatModel(o.model),
-		MaxTokens: openai.Int(500),
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(systemPrompt),
-			openai.UserMessage(prompt),
-		},
+	resp, err := o.complete(ctx, openai.ChatCompletionNewParams{
+		Model:          openai.ChatModel(o.model),
+		MaxTokens:      openai.Int(500),
+		Messages:       openAIMessages(systemPrompt, req),
+		ResponseFormat: jsonMode,
 	})
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %w", err)
+		return nil, fmt.Errorf("API request failed: %w", err)
 	}
+	reportUsage(ctx, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 
 	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from API")
+		return nil, fmt.Errorf("no response from API")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return ParseCommandResult(traceResponse(ctx, resp.Choices[0].Message.Content))
+}
+
+// GenerateCommandWithTools generates a shell command using an OpenAI-compatible
+// API, letting the model call probing tools first. The tools are left out of
+// the last round, so the model has to answer.
+func (o *OpenAICompatible) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	systemPrompt, err := BuildStructuredSystemPrompt(req, o.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	systemPrompt += toolRules
+	traceRequest(ctx, systemPrompt)
+	messages := openAIMessages(systemPrompt, req)
+
+	for round := 0; ; round++ {
+		params := openai.ChatCompletionNewParams{
+			Model:          openai.ChatModel(o.model),
+			MaxTokens:      openai.Int(500),
+			Messages:       messages,
+			ResponseFormat: jsonMode,
+		}
+		if round < tools.MaxRounds {
+			params.Tools = openAITools(tools)
+		}
+
+		resp, err := o.complete(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("API request failed: %w", err)
+		}
+		reportUsage(ctx, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("no response from API")
+		}
+		message := resp.Choices[0].Message
+		if len(message.ToolCalls) == 0 {
+			return ParseCommandResult(traceResponse(ctx, message.Content))
+		}
+
+		messages = append(messages, message.ToParam())
+		for _, toolCall := range message.ToolCalls {
+			call := tools.Run(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
+			messages = append(messages, openai.ToolMessage(call.Result(), toolCall.ID))
+		}
+	}
+}
+
+// openAITools returns the function definitions of the tools in a toolbox
+func openAITools(tools *probe.Toolbox) []openai.ChatCompletionToolParam {
+	params := make([]openai.ChatCompletionToolParam, len(tools.Tools))
+	for i, tool := range tools.Tools {
+		params[i] = openai.ChatCompletionToolParam{
+			Function: shared.FunctionDefinitionParam{
+				Name:        tool.Name,
+				Description: openai.String(tool.Description),
+				Parameters: shared.FunctionParameters{
+					"type":       "object",
+					"properties": tool.Schema(),
+					"required":   append([]string{}, tool.Required...),
+				},
+			},
+		}
+	}
+	return params
 }
 
 // ExplainCommand explains what a shell command does
-func (o *OpenAICompatible) ExplainCommand(ctx context.Context, command string) (string, error) {
-	systemPrompt := BuildExplainPrompt()
+func (o *OpenAICompatible) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
 
-	resp, err := o.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+	resp, err := o.complete(ctx, openai.ChatCompletionNewParams{
 		Model:     openai.ChatModel(o.model),
 		MaxTokens: openai.Int(1000),
 		Messages: []openai.ChatCompletionMessageParamUnion{
 			openai.SystemMessage(systemPrompt),
-			openai.UserMessage(command),
+			openai.UserMessage(explainMessage(req)),
 		},
 	})
 	if err != nil {
 		return "", fmt.Errorf("API request failed: %w", err)
 	}
+	reportUsage(ctx, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response from API")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return traceResponse(ctx, resp.Choices[0].Message.Content), nil
+}
+
+// ReviewCommand checks a command for mistakes in a second pass, using JSON mode
+func (o *OpenAICompatible) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	resp, err := o.complete(ctx, openai.ChatCompletionNewParams{
+		Model:     openai.ChatModel(o.model),
+		MaxTokens: openai.Int(500),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(BuildReviewPrompt(req.ShellInfo)),
+			openai.UserMessage(req.Command),
+		},
+		ResponseFormat: jsonMode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	reportUsage(ctx, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from API")
+	}
+
+	return ParseReview(resp.Choices[0].Message.Content)
 }
 
 // GenerateCommandStream generates a shell command with streaming output
-func (o *OpenAICompatible) GenerateCommandStream(ctx context.Context, prompt string, shellInfo shell.ShellInfo, callback func(chunk string)) (string, error) {
-	systemPrompt := BuildSmartSystemPrompt(shellInfo, o.systemPromptSuffix, prompt)
+func (o *OpenAICompatible) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	systemPrompt, err := BuildSmartSystemPrompt(req, o.systemPromptSuffix)
+	if err != nil {
+		return nil, err
+	}
+	traceRequest(ctx, systemPrompt)
 
-	stream := o.client.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
+	fullContent, err := o.streamText(ctx, openai.ChatCompletionNewParams{
 		Model:     openai.ChatModel(o.model),
 		MaxTokens: openai.Int(500),
+		Messages:  openAIMessages(systemPrompt, req),
+	}, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCommandResult(fullContent)
+}
+
+// ExplainCommandStream explains what a shell command does with streaming output
+func (o *OpenAICompatible) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	systemPrompt, err := BuildExplainPrompt(req.ShellInfo)
+	if err != nil {
+		return "", err
+	}
+	traceRequest(ctx, systemPrompt)
+	return o.streamText(ctx, openai.ChatCompletionNewParams{
+		Model:     openai.ChatModel(o.model),
+		MaxTokens: openai.Int(1000),
 		Messages: []openai.ChatCompletionMessageParamUnion{
 			openai.SystemMessage(systemPrompt),
-			openai.UserMessage(prompt),
+			openai.UserMessage(explainMessage(req)),
 		},
+	}, callback)
+}
+
+// streamText streams a chat completion, passing each piece of text to
+// callback, and returns the full text. The usage of the request is asked for
+// with stream_options; servers that reject it with a 400 are asked again
+// without it, and later requests leave it out.
+func (o *OpenAICompatible) streamText(ctx context.Context, params openai.ChatCompletionNewParams, callback func(chunk string)) (string, error) {
+	if o.noStreamUsage.Load() {
+		return o.stream(ctx, params, callback)
+	}
+
+	withUsage := params
+	withUsage.StreamOptions = openai.ChatCompletionStreamOptionsParam{
+		IncludeUsage: openai.Bool(true),
+	}
+	streamed := false
+	fullContent, err := o.stream(ctx, withUsage, func(chunk string) {
+		streamed = true
+		if callback != nil {
+			callback(chunk)
+		}
 	})
+	if err == nil || streamed || StatusCode(err) != http.StatusBadRequest {
+		return fullContent, err
+	}
+
+	if retried, retryErr := o.stream(ctx, params, callback); retryErr == nil {
+		o.noStreamUsage.Store(true)
+		return retried, nil
+	}
+	return fullContent, err
+}
+
+// stream sends a streaming chat completion request, passing each piece of
+// text to callback, and returns the full text
+func (o *OpenAICompatible) stream(ctx context.Context, params openai.ChatCompletionNewParams, callback func(chunk string)) (string, error) {
+	stream := o.client.Chat.Completions.NewStreaming(ctx, params)
 
 	var fullContent string
 	for stream.Next() {
 		chunk := stream.Current()
+		// The final chunk carries the usage of the whole request
+		if chunk.Usage.PromptTokens > 0 || chunk.Usage.CompletionTokens > 0 {
+			reportUsage(ctx, chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens)
+		}
 		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
 			content := chunk.Choices[0].Delta.Content
 			fullContent += content
@@ -111,6 +309,46 @@ func (o *OpenAICompatible) GenerateCommandStream(ctx context.Context, prompt str
 	if err := stream.Err(); err != nil {
 		return "", fmt.Errorf("streaming API request failed: %w", err)
 	}
+	return traceResponse(ctx, fullContent), nil
+}
 
-	return fullContent, nil
+// jsonMode asks the model for a JSON object
+var jsonMode = openai.ChatCompletionNewParamsResponseFormatUnion{
+	OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+}
+
+// complete sends a chat completion request. Some OpenAI-compatible servers,
+// such as LM Studio, reject JSON mode with a 400; the request is then sent
+// once more without it, and later requests leave it out. The answer is still
+// parsed as JSON, which models follow from the system prompt alone.
+func (o *OpenAICompatible) complete(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	if o.noJSONMode.Load() {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{}
+	}
+	resp, err := o.client.Chat.Completions.New(ctx, params)
+	if err == nil || StatusCode(err) != http.StatusBadRequest || params.ResponseFormat.OfJSONObject == nil {
+		return resp, err
+	}
+
+	params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{}
+	if retried, retryErr := o.client.Chat.Completions.New(ctx, params); retryErr == nil {
+		o.noJSONMode.Store(true)
+		return retried, nil
+	}
+	return resp, err
+}
+
+// openAIMessages builds the chat messages for a generate request, including any conversation history
+func openAIMessages(systemPrompt string, req GenerateRequest) []openai.ChatCompletionMessageParamUnion {
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(systemPrompt),
+	}
+	for _, msg := range BuildMessages(req.History, req.Prompt) {
+		if msg.Role == RoleAssistant {
+			messages = append(messages, openai.AssistantMessage(msg.Content))
+		} else {
+			messages = append(messages, openai.UserMessage(msg.Content))
+		}
+	}
+	return messages
 }
@@ -0,0 +1,279 @@
+package llm
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	var got http.Header
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, path = r.Header.Clone(), r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"pwd\"]}"}}]}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Provider:     config.ProviderOpenAICompatible,
+		Model:        "local",
+		BaseURL:      server.URL + "/v1/",
+		Headers:      map[string]string{"X-Gateway-Team": "shell"},
+		Organization: "org-1",
+		Project:      "proj-1",
+		Retry:        &config.RetryConfig{MaxAttempts: 1},
+	}
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+
+	result, err := provider.GenerateCommand(context.Background(), GenerateRequest{Prompt: "where am i", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}})
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if result.Command() != "pwd" {
+		t.Errorf("command = %q, expected %q", result.Command(), "pwd")
+	}
+	if path != "/v1/chat/completions" {
+		t.Errorf("path = %q, expected %q", path, "/v1/chat/completions")
+	}
+
+	headers := map[string]string{
+		"X-Gateway-Team":      "shell",
+		"Openai-Organization": "org-1",
+		"Openai-Project":      "proj-1",
+	}
+	for name, expected := range headers {
+		if got.Get(name) != expected {
+			t.Errorf("header %s = %q, expected %q", name, got.Get(name), expected)
+		}
+	}
+}
+
+func TestOpenAICompatibleWithoutAPIKey(t *testing.T) {
+	// The user's OpenAI credentials must not reach another server
+	t.Setenv("OPENAI_API_KEY", "sk-not-for-the-gateway")
+	t.Setenv("OPENAI_ORG_ID", "org-env")
+	t.Setenv("OPENAI_PROJECT_ID", "proj-env")
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"pwd\"]}"}}]}`)
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(&config.Config{
+		Provider: config.ProviderOpenAICompatible,
+		Model:    "local",
+		BaseURL:  server.URL,
+		Retry:    &config.RetryConfig{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+	if _, err := provider.GenerateCommand(context.Background(), GenerateRequest{Prompt: "where am i", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	for _, name := range []string{"Authorization", "OpenAI-Organization", "OpenAI-Project"} {
+		if value := got.Get(name); value != "" {
+			t.Errorf("header %s = %q, expected none", name, value)
+		}
+	}
+}
+
+func TestOpenAICompatibleWithoutJSONMode(t *testing.T) {
+	requests, rejected := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(string(body), "response_format") {
+			rejected++
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"'response_format.type' must be 'json_schema' or 'text'"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"pwd\"]}"}}]}`)
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(&config.Config{
+		Provider: config.ProviderOpenAICompatible,
+		Model:    "local",
+		BaseURL:  server.URL,
+		Retry:    &config.RetryConfig{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+
+	req := GenerateRequest{Prompt: "where am i", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}
+	for i := 0; i < 2; i++ {
+		result, err := provider.GenerateCommand(context.Background(), req)
+		if err != nil {
+			t.Fatalf("GenerateCommand returned error: %v", err)
+		}
+		if result.Command() != "pwd" {
+			t.Errorf("command = %q, expected %q", result.Command(), "pwd")
+		}
+	}
+	if requests != 3 || rejected != 1 {
+		t.Errorf("got %d requests with %d rejected, expected JSON mode to be tried once", requests, rejected)
+	}
+}
+
+func TestOpenAICompatibleStreamWithoutUsage(t *testing.T) {
+	requests, rejected := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "stream_options") {
+			rejected++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"unknown field stream_options"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"local\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"pwd\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAICompatible("", server.URL, "local", "", NewRetryClient(fastPolicy, nil))
+	if err != nil {
+		t.Fatalf("NewOpenAICompatible returned error: %v", err)
+	}
+
+	req := GenerateRequest{Prompt: "where am i", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}
+	for i := 0; i < 2; i++ {
+		var streamed string
+		result, err := provider.GenerateCommandStream(context.Background(), req, func(chunk string) { streamed += chunk })
+		if err != nil {
+			t.Fatalf("GenerateCommandStream returned error: %v", err)
+		}
+		if result.Command() != "pwd" || streamed != "pwd" {
+			t.Errorf("command = %q after streaming %q", result.Command(), streamed)
+		}
+	}
+	if requests != 3 || rejected != 1 {
+		t.Errorf("got %d requests with %d rejected, expected stream_options to be tried once", requests, rejected)
+	}
+}
+
+func TestOpenAICompatibleValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{"no base url", &config.Config{Provider: config.ProviderOpenAICompatible, Model: "local"}},
+		{"no model", &config.Config{Provider: config.ProviderOpenAICompatible, BaseURL: "http://localhost:1234/v1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewProvider(tt.cfg); err == nil {
+				t.Error("NewProvider returned no error")
+			}
+		})
+	}
+}
+
+func TestOpenAICompatibleNetworkSettings(t *testing.T) {
+	// A gateway with a certificate from a private CA, as behind a TLS-intercepting proxy
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"pwd\"]}"}}]}`)
+	}))
+	defer server.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		network *config.NetworkConfig
+		ok      bool
+	}{
+		{"untrusted", nil, false},
+		{"ca_cert", &config.NetworkConfig{CACert: caPath}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Provider: config.ProviderOpenAICompatible,
+				Model:    "local",
+				BaseURL:  server.URL + "/v1",
+				Retry:    &config.RetryConfig{MaxAttempts: 1},
+				Network:  tt.network,
+			}
+			provider, err := NewProvider(cfg)
+			if err != nil {
+				t.Fatalf("NewProvider returned error: %v", err)
+			}
+			_, err = provider.GenerateCommand(context.Background(), GenerateRequest{Prompt: "where am i", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}})
+			if (err == nil) != tt.ok {
+				t.Errorf("GenerateCommand error = %v", err)
+			}
+		})
+	}
+
+	if _, err := NewProvider(&config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o", Network: &config.NetworkConfig{CACert: "missing.pem"}}); err == nil {
+		t.Error("NewProvider with a missing ca_cert returned no error")
+	}
+}
+
+func TestOpenAICompatibleExplainStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, text := range []string{"Lists ", "files"} {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"local\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", text)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"local\",\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":3,\"total_tokens\":15}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(&config.Config{
+		Provider: config.ProviderOpenAICompatible,
+		Model:    "local",
+		BaseURL:  server.URL,
+		Retry:    &config.RetryConfig{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+	sp, ok := provider.(ExplainStreamingProvider)
+	if !ok {
+		t.Fatal("provider does not support streaming explanations")
+	}
+
+	ctx, usage := WithUsage(context.Background())
+	var chunks []string
+	explanation, err := sp.ExplainCommandStream(ctx, ExplainRequest{Command: "ls"}, func(c string) { chunks = append(chunks, c) })
+	if err != nil {
+		t.Fatalf("ExplainCommandStream returned error: %v", err)
+	}
+	if explanation != "Lists files" || len(chunks) != 2 {
+		t.Errorf("explanation = %q in %d chunks", explanation, len(chunks))
+	}
+	if in, out := usage.Tokens(); in != 12 || out != 3 {
+		t.Errorf("usage = %d/%d, expected 12/3", in, out)
+	}
+}
@@ -7,15 +7,69 @@ import (
 
 	"github.com/Hermithic/aiask/internal/config"
 	appcontext "github.com/Hermithic/aiask/internal/context"
+	"github.com/Hermithic/aiask/internal/prompts"
 	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/transport"
 )
 
+// GenerateRequest describes a request to generate a shell command
+type GenerateRequest struct {
+	Prompt    string          // The natural language request
+	ShellInfo shell.ShellInfo // The shell and OS the command is for
+	History   []Turn          // Prior turns of the conversation, oldest first
+
+	// Failed is set when the request asks to fix a command that failed; the
+	// system prompt then comes from the recovery template
+	Failed *FailedCommand
+
+	// Alternatives is the number of candidate commands to ask for; values of
+	// one or less request a single command
+	Alternatives int
+
+	// Budget is the most tokens the system prompt, conversation and prompt
+	// may take together (see ContextBudget); context such as the directory
+	// listing is trimmed to fit. Zero means no limit.
+	Budget int
+
+	// scrub, if set, masks secrets in the context gathered for the system
+	// prompt; source names the part the text is from
+	scrub func(source, text string) string
+
+	// planned, if set, is called with how the context fit the budget when
+	// the system prompt is built
+	planned func(plan *ContextPlan)
+}
+
+// scrubText masks secrets in text gathered for a request, if it is scrubbed
+func (req GenerateRequest) scrubText(source, text string) string {
+	if req.scrub == nil {
+		return text
+	}
+	return req.scrub(source, text)
+}
+
+// FailedCommand describes a command that failed when it was run
+type FailedCommand struct {
+	Command string
+	Error   string
+}
+
+// ExplainRequest describes a request to explain a shell command
+type ExplainRequest struct {
+	Command   string          // The command to explain
+	ShellInfo shell.ShellInfo // The shell the command is run in, if known
+
+	// Reference is documentation of the command's programs and flags from
+	// local man pages or --help output, if any was found
+	Reference string
+}
+
 // Provider is the interface for LLM providers
 type Provider interface {
 	// GenerateCommand generates a shell command from a natural language prompt
-	GenerateCommand(ctx context.Context, prompt string, shellInfo shell.ShellInfo) (string, error)
+	GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error)
 	// ExplainCommand explains what a shell command does
-	ExplainCommand(ctx context.Context, command string) (string, error)
+	ExplainCommand(ctx context.Context, req ExplainRequest) (string, error)
 }
 
 // Closeable is an optional interface for providers that hold resources
@@ -35,128 +89,304 @@ func CloseProvider(p Provider) error {
 type StreamingProvider interface {
 	Provider
 	// GenerateCommandStream generates a shell command with streaming output
-	GenerateCommandStream(ctx context.Context, prompt string, shellInfo shell.ShellInfo, callback func(chunk string)) (string, error)
+	GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error)
 }
 
 // SupportsStreaming checks if a provider supports streaming
 func SupportsStreaming(p Provider) bool {
-	_, ok := p.(StreamingProvider)
-	return ok
+	return supports(p, func(p Provider) bool {
+		_, ok := p.(StreamingProvider)
+		return ok
+	})
+}
+
+// wrapper is implemented by providers that pass calls on to another
+// provider, such as the cache. Wrappers implement every optional interface
+// but can only use the ones the wrapped provider has.
+type wrapper interface {
+	Unwrap() Provider
+}
+
+// supports reports whether a provider has an optional interface, looking
+// through wrappers to the provider that answers
+func supports(p Provider, has func(p Provider) bool) bool {
+	for has(p) {
+		w, ok := p.(wrapper)
+		if !ok {
+			return true
+		}
+		p = w.Unwrap()
+	}
+	return false
 }
 
-// NewProvider creates a new LLM provider based on the configuration
+// ExplainStreamingProvider is an optional interface for providers that can stream explanations
+type ExplainStreamingProvider interface {
+	Provider
+	// ExplainCommandStream explains a shell command with streaming output
+	ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error)
+}
+
+// SupportsExplainStreaming checks if a provider can stream explanations
+func SupportsExplainStreaming(p Provider) bool {
+	return supports(p, func(p Provider) bool {
+		_, ok := p.(ExplainStreamingProvider)
+		return ok
+	})
+}
+
+// explainStream streams an explanation if the provider supports it, or
+// delivers the whole explanation as one chunk
+func explainStream(ctx context.Context, p Provider, req ExplainRequest, callback func(chunk string)) (string, error) {
+	if sp, ok := p.(ExplainStreamingProvider); ok {
+		return sp.ExplainCommandStream(ctx, req, callback)
+	}
+	explanation, err := p.ExplainCommand(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	callback(explanation)
+	return explanation, nil
+}
+
+// NewProvider creates a new LLM provider based on the configuration. When
+// fallback providers are configured, it returns a FallbackProvider that tries
+// them in order.
 func NewProvider(cfg *config.Config) (Provider, error) {
+	if len(cfg.Fallbacks) > 0 {
+		return NewFallbackProvider(cfg)
+	}
+	return newSingleProvider(cfg)
+}
+
+// newSingleProvider creates the provider selected by cfg.Provider, traced
+// to cfg.Trace if it is set and masking secrets unless scrubbing is disabled
+func newSingleProvider(cfg *config.Config) (Provider, error) {
+	provider, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Trace != "" {
+		provider = NewTracingProvider(provider, cfg)
+	}
+	// Replayed answers never leave the machine, and are matched by the
+	// unmasked prompt
+	if cfg.ScrubSecrets() && cfg.Provider != config.ProviderReplay {
+		return NewScrubbingProvider(provider, cfg)
+	}
+	return provider, nil
+}
+
+// newClient creates the client of the provider selected by cfg.Provider
+func newClient(cfg *config.Config) (Provider, error) {
+	base, err := transport.Shared(cfg.Network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network settings: %w", err)
+	}
+	httpClient := NewRetryClient(NewRetryPolicy(cfg), base)
+
 	switch cfg.Provider {
-	case config.ProviderGrok:
-		return NewOpenAICompatible(cfg.APIKey, config.GetProviderURL(cfg.Provider, ""), cfg.Model, cfg.SystemPromptSuffix)
-	case config.ProviderOpenAI:
-		return NewOpenAICompatible(cfg.APIKey, config.GetProviderURL(cfg.Provider, ""), cfg.Model, cfg.SystemPromptSuffix)
+	case config.ProviderGrok, config.ProviderOpenAI:
+		return NewOpenAICompatible(cfg.APIKey, cfg.GetBaseURL(), cfg.Model, cfg.SystemPromptSuffix, httpClient, openAIOptions(cfg)...)
 	case config.ProviderOllama:
-		return NewOpenAICompatible("", config.GetProviderURL(cfg.Provider, cfg.OllamaURL), cfg.Model, cfg.SystemPromptSuffix)
+		return NewOllama(cfg.GetOllamaURL(), cfg.Model, cfg.SystemPromptSuffix, cfg.Ollama, httpClient)
+	case config.ProviderOpenAICompatible:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("base_url is required for the %s provider", cfg.Provider)
+		}
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("model is required for the %s provider", cfg.Provider)
+		}
+		return NewOpenAICompatible(cfg.APIKey, cfg.GetBaseURL(), cfg.Model, cfg.SystemPromptSuffix, httpClient, openAIOptions(cfg)...)
+	case config.ProviderAzure:
+		return NewAzure(cfg.APIKey, cfg.GetBaseURL(), cfg.GetDeployment(), cfg.GetAPIVersion(), cfg.SystemPromptSuffix, httpClient, openAIOptions(cfg)...)
 	case config.ProviderAnthropic:
-		return NewAnthropic(cfg.APIKey, cfg.Model, cfg.SystemPromptSuffix)
+		return NewAnthropic(cfg.APIKey, cfg.Model, cfg.SystemPromptSuffix, httpClient)
 	case config.ProviderGemini:
-		return NewGemini(cfg.APIKey, cfg.Model, cfg.SystemPromptSuffix)
+		return NewGemini(cfg.APIKey, cfg.Model, cfg.SystemPromptSuffix, httpClient)
+	case config.ProviderReplay:
+		return NewReplayProvider(cfg.Cassette)
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", cfg.Provider)
 	}
 }
 
 // BuildSystemPrompt builds the system prompt for the LLM
-func BuildSystemPrompt(shellInfo shell.ShellInfo, suffix string) string {
-	prompt := fmt.Sprintf(`You are a shell command assistant. Given a natural language request, return ONLY the shell command(s) needed to accomplish the task.
-
-Rules:
-- Return ONLY the command(s), no explanations, no markdown, no code blocks
-- If multiple commands are needed, put each on a new line
-- Use the appropriate syntax for the current shell
-- For dangerous operations, include appropriate safety flags when possible
-
-Current shell: %s
-Operating system: %s
-Current directory: %s`, shell.GetShellName(shellInfo.Shell), shell.GetOSName(), appcontext.GetCWD())
+func BuildSystemPrompt(shellInfo shell.ShellInfo, suffix string) (string, error) {
+	return prompts.Render(prompts.TaskGenerate, promptData(shellInfo, suffix, plainFormatRules))
+}
 
-	// Add git context if in a git repository
+// promptData returns the template data of a generate prompt with the given
+// response format rules
+func promptData(shellInfo shell.ShellInfo, suffix string, formatRules string) prompts.Data {
 	gitCtx := appcontext.GetGitContext()
-	if gitCtx.IsRepo {
-		prompt += fmt.Sprintf("\nGit branch: %s", gitCtx.Branch)
-		if gitCtx.IsDirty {
-			prompt += " (has uncommitted changes)"
-		}
+	return prompts.Data{
+		Shell:   shell.GetShellName(shellInfo.Shell),
+		OS:      shell.GetOSName(),
+		CWD:     appcontext.GetCWD(),
+		Git:     prompts.Git{IsRepo: gitCtx.IsRepo, Branch: gitCtx.Branch, Dirty: gitCtx.IsDirty},
+		Project: appcontext.GetProjectTypes(),
+		Rules:   formatRules,
+		Suffix:  suffix,
 	}
-
-	if suffix != "" {
-		prompt += "\n\nAdditional instructions:\n" + suffix
-	}
-
-	return prompt
 }
 
 // BuildSystemPromptWithDirContext builds the system prompt with directory listing
-func BuildSystemPromptWithDirContext(shellInfo shell.ShellInfo, suffix string) string {
-	prompt := BuildSystemPrompt(shellInfo, suffix)
-	dirContext := appcontext.GetDirectoryContext()
-	if dirContext != "" {
-		prompt += "\n\n" + dirContext
-	}
-	return prompt
+func BuildSystemPromptWithDirContext(shellInfo shell.ShellInfo, suffix string) (string, error) {
+	data := promptData(shellInfo, suffix, plainFormatRules)
+	data.Directory = strings.TrimSpace(appcontext.GetDirectoryContext())
+	return prompts.Render(prompts.TaskGenerate, data)
 }
 
 // BuildSmartSystemPrompt builds the system prompt with context tailored to the user's request
 // It includes directory or git context only when relevant to the prompt
-func BuildSmartSystemPrompt(shellInfo shell.ShellInfo, suffix string, userPrompt string) string {
-	prompt := BuildSystemPrompt(shellInfo, suffix)
+func BuildSmartSystemPrompt(req GenerateRequest, suffix string) (string, error) {
+	return buildSmartSystemPrompt(req, suffix, plainFormatRules)
+}
 
-	// Add directory context if the prompt is file-related
-	if appcontext.IsFileRelatedPrompt(userPrompt) {
-		dirContext := appcontext.GetDirectoryContext()
-		if dirContext != "" {
-			prompt += "\n\n" + dirContext
-		}
-	}
+// BuildStructuredSystemPrompt builds a smart system prompt that asks for a JSON command result
+// with the requested number of candidate solutions
+func BuildStructuredSystemPrompt(req GenerateRequest, suffix string) (string, error) {
+	return buildSmartSystemPrompt(req, suffix, structuredRules(req.Alternatives))
+}
 
-	// Add extended git context if the prompt is git-related
-	if appcontext.IsGitRelatedPrompt(userPrompt) {
-		gitStatus := appcontext.GetGitStatus()
-		if gitStatus != "" {
-			prompt += "\n\n" + gitStatus
-		}
-		// Add recent commits for context
-		recentCommits := appcontext.GetRecentCommits(5)
-		if recentCommits != "" {
-			prompt += "\nRecent commits:\n" + recentCommits
-		}
+// Names of the parts of a generate request's context
+const (
+	PartSystemPrompt  = "system prompt"
+	PartConversation  = "conversation"
+	PartPrompt        = "prompt"
+	PartInput         = "piped input"
+	PartGitStatus     = "git status"
+	PartDirectory     = "directory"
+	PartRecentCommits = "recent commits"
+)
+
+// buildSmartSystemPrompt builds a context-aware system prompt with the given response format
+// rules. Requests to fix a failed command use the recovery template.
+func buildSmartSystemPrompt(req GenerateRequest, suffix string, formatRules string) (string, error) {
+	plan, task, data, err := planSystemPrompt(req, suffix, formatRules)
+	if err != nil {
+		return "", err
+	}
+	if req.planned != nil {
+		req.planned(plan)
+	}
+	data.Directory = plan.Text(PartDirectory)
+	data.Git.Status = plan.Text(PartGitStatus)
+	data.Git.RecentCommits = plan.Text(PartRecentCommits)
+	systemPrompt, err := prompts.Render(task, data)
+	if err != nil {
+		return "", err
 	}
+	// The context parts were masked already; this covers the rest, such as
+	// the working directory
+	return req.scrubText(PartSystemPrompt, systemPrompt), nil
+}
 
-	return prompt
+// PlanContext fits the context of a generate request into its budget the way
+// the system prompt is built, to show what was kept and what was dropped
+func PlanContext(req GenerateRequest, suffix string) (*ContextPlan, error) {
+	plan, _, _, err := planSystemPrompt(req, suffix, structuredRules(req.Alternatives))
+	return plan, err
 }
 
-// BuildExplainPrompt builds the system prompt for explaining commands
-func BuildExplainPrompt() string {
-	return `You are a shell command explainer. Given a shell command, explain what it does in plain English.
+// planSystemPrompt gathers the context relevant to a request and fits it into
+// the request's budget. It returns the plan with the template and data of the
+// system prompt, whose optional context is still unset.
+func planSystemPrompt(req GenerateRequest, suffix string, formatRules string) (*ContextPlan, string, prompts.Data, error) {
+	task, data, base, err := baseSystemPrompt(req, suffix, formatRules)
+	if err != nil {
+		return nil, "", data, err
+	}
+	return FitContext(req.Budget, append(requestParts(req, base), contextParts(req)...)), task, data, nil
+}
+
+// baseSystemPrompt renders the system prompt of a request without optional
+// context, which always has to fit. It also returns the template and data it
+// was rendered from.
+func baseSystemPrompt(req GenerateRequest, suffix string, formatRules string) (string, prompts.Data, string, error) {
+	data := promptData(req.ShellInfo, suffix, formatRules)
+	task := prompts.TaskGenerate
+	if req.Failed != nil {
+		task = prompts.TaskRecovery
+		data.Failure = prompts.Failure{Command: req.Failed.Command, Error: req.Failed.Error}
+	}
+	base, err := prompts.Render(task, data)
+	return task, data, base, err
+}
 
-Rules:
-- Break down each part of the command
-- Explain flags and options
-- Mention any potential risks or side effects
-- Keep explanations clear and concise`
+// requestParts returns the parts of a request that are always sent: the
+// system prompt, the conversation so far and the prompt
+func requestParts(req GenerateRequest, systemPrompt string) []ContextPart {
+	messages := BuildMessages(req.History, req.Prompt)
+	conversation := make([]string, 0, len(messages)-1)
+	for _, msg := range messages[:len(messages)-1] {
+		conversation = append(conversation, msg.Content)
+	}
+	return []ContextPart{
+		{Name: PartSystemPrompt, Text: systemPrompt, Required: true},
+		{Name: PartConversation, Text: strings.Join(conversation, "\n"), Required: true},
+		{Name: PartPrompt, Text: messages[len(messages)-1].Content, Required: true},
+	}
 }
 
-// CleanCommand removes markdown code blocks and extra whitespace from the command
-func CleanCommand(command string) string {
-	// Remove markdown code blocks
-	command = strings.TrimPrefix(command, "```bash\n")
-	command = strings.TrimPrefix(command, "```powershell\n")
-	command = strings.TrimPrefix(command, "```cmd\n")
-	command = strings.TrimPrefix(command, "```shell\n")
-	command = strings.TrimPrefix(command, "```sh\n")
-	command = strings.TrimPrefix(command, "```\n")
-	command = strings.TrimSuffix(command, "\n```")
-	command = strings.TrimSuffix(command, "```")
+// contextParts returns the optional context relevant to a request. Directory
+// context is included for file-related prompts, and the git status and recent
+// commits for git-related ones.
+func contextParts(req GenerateRequest) []ContextPart {
+	userPrompt := relevanceText(req)
+
+	var parts []ContextPart
+	if appcontext.IsGitRelatedPrompt(userPrompt) {
+		parts = append(parts,
+			ContextPart{Name: PartGitStatus, Text: strings.TrimSpace(appcontext.GetGitStatus()), Priority: PriorityGitStatus},
+			ContextPart{Name: PartRecentCommits, Text: appcontext.GetRecentCommits(5), Priority: PriorityRecentCommits, Trim: TrimLines},
+		)
+	}
+	if appcontext.IsFileRelatedPrompt(userPrompt) {
+		parts = append(parts, ContextPart{Name: PartDirectory, Text: strings.TrimSpace(appcontext.GetDirectoryContext()), Priority: PriorityDirectory, Trim: TrimLines})
+	}
+	for i := range parts {
+		parts[i].Text = req.scrubText(parts[i].Name, parts[i].Text)
+	}
+	return parts
+}
 
-	// Trim whitespace
-	command = strings.TrimSpace(command)
+// FitInput trims text piped to aiask so that it fits the request's budget
+// along with the system prompt and the prompt it is sent with. Optional
+// context such as the directory listing has a lower priority than the input,
+// so it isn't counted here; it is trimmed to fit when the system prompt is
+// built.
+func FitInput(req GenerateRequest, suffix, input string) (string, *ContextPlan, error) {
+	_, _, base, err := baseSystemPrompt(req, suffix, structuredRules(req.Alternatives))
+	if err != nil {
+		return "", nil, err
+	}
+	parts := append(requestParts(req, base), ContextPart{Name: PartInput, Text: input, Priority: PriorityInput, Trim: TrimMiddle})
+	plan := FitContext(req.Budget, parts)
+	return plan.Text(PartInput), plan, nil
+}
 
-	return command
+// BuildExplainPrompt builds the system prompt for explaining commands run in
+// the given shell
+func BuildExplainPrompt(shellInfo shell.ShellInfo) (string, error) {
+	var shellName string
+	if shellInfo.Shell != "" {
+		shellName = shell.GetShellName(shellInfo.Shell)
+	}
+	return prompts.Render(prompts.TaskExplain, prompts.Data{
+		Shell:   shellName,
+		OS:      shell.GetOSName(),
+		CWD:     appcontext.GetCWD(),
+		Project: appcontext.GetProjectTypes(),
+	})
 }
 
+// explainMessage builds the user message of an explain request, with any
+// reference documentation after the command
+func explainMessage(req ExplainRequest) string {
+	if req.Reference == "" {
+		return req.Command
+	}
+	return req.Command + "\n\nReference documentation from this system:\n\n" + req.Reference
+}
@@ -0,0 +1,366 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Hermithic/aiask/internal/cache"
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/fileutil"
+	"github.com/Hermithic/aiask/internal/probe"
+)
+
+// Interaction is a recorded request and the provider's response
+type Interaction struct {
+	Kind string `json:"kind"` // cache.KindGenerate, cache.KindExplain or cache.KindReview
+
+	// Generate requests
+	Prompt       string         `json:"prompt,omitempty"`
+	Shell        string         `json:"shell,omitempty"`
+	History      []Turn         `json:"history,omitempty"`
+	Alternatives int            `json:"alternatives,omitempty"`
+	Result       *CommandResult `json:"result,omitempty"`
+	Chunks       []string       `json:"chunks,omitempty"` // Streamed output, if the request was streamed
+
+	// Explain and review requests
+	Command     string  `json:"command,omitempty"`
+	Explanation string  `json:"explanation,omitempty"`
+	Review      *Review `json:"review,omitempty"`
+
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// key identifies the request of an interaction. Only the request itself is
+// used, not the system prompt, so cassettes replay the same way on machines
+// with a different directory or OS.
+func (i *Interaction) key() string {
+	switch i.Kind {
+	case cache.KindExplain:
+		return cache.Key(i.Kind, strings.TrimSpace(i.Command))
+	case cache.KindReview:
+		return cache.Key(i.Kind, strings.TrimSpace(i.Command), i.Shell)
+	}
+	history, _ := json.Marshal(i.History)
+	return cache.Key(i.Kind, i.Prompt, i.Shell, string(history), fmt.Sprint(i.Alternatives))
+}
+
+// looseKey identifies an interaction by kind and prompt only, so hand-written
+// cassettes can leave out the shell and history, and cassettes recorded in
+// one shell replay in another
+func (i *Interaction) looseKey() string {
+	if i.Kind == cache.KindExplain || i.Kind == cache.KindReview {
+		return cache.Key(i.Kind, strings.TrimSpace(i.Command))
+	}
+	return cache.Key(i.Kind, i.Prompt)
+}
+
+// generateInteraction returns the interaction describing a generate request
+func generateInteraction(req GenerateRequest) *Interaction {
+	alternatives := req.Alternatives
+	if alternatives <= 1 {
+		alternatives = 0
+	}
+	return &Interaction{
+		Kind:         cache.KindGenerate,
+		Prompt:       req.Prompt,
+		Shell:        string(req.ShellInfo.Shell),
+		History:      req.History,
+		Alternatives: alternatives,
+	}
+}
+
+// reviewInteraction returns the interaction describing a review request
+func reviewInteraction(req ReviewRequest) *Interaction {
+	return &Interaction{
+		Kind:    cache.KindReview,
+		Command: strings.TrimSpace(req.Command),
+		Shell:   string(req.ShellInfo.Shell),
+	}
+}
+
+// Cassette is a file of recorded interactions, stored as JSON
+type Cassette struct {
+	path string
+
+	mu           sync.Mutex
+	Interactions []Interaction  `json:"interactions"`
+	served       map[string]int // Times each request has been replayed
+}
+
+// LoadCassette reads a cassette file. A missing file is an empty cassette.
+func LoadCassette(path string) (*Cassette, error) {
+	c := &Cassette{path: path, served: map[string]int{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Add appends an interaction and saves the cassette
+func (c *Cassette) Add(i Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = append(c.Interactions, i)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if err := fileutil.AtomicWriteFile(c.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Find returns the recorded response to a request. Interactions recorded
+// for the same request are replayed in order, repeating the last one.
+func (c *Cassette) Find(req *Interaction) (*Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Match the exact request first, then any request with the same prompt
+	for _, keyOf := range []func(*Interaction) string{(*Interaction).key, (*Interaction).looseKey} {
+		key := keyOf(req)
+		var matches []int
+		for i := range c.Interactions {
+			if keyOf(&c.Interactions[i]) == key {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		n := c.served[key]
+		c.served[key]++
+		if n >= len(matches) {
+			n = len(matches) - 1
+		}
+		return &c.Interactions[matches[n]], true
+	}
+	return nil, false
+}
+
+// ReplayProvider answers requests from a cassette without contacting any LLM
+type ReplayProvider struct {
+	cassette *Cassette
+}
+
+// NewReplayProvider creates a provider that replays the cassette at path
+func NewReplayProvider(path string) (*ReplayProvider, error) {
+	if path == "" {
+		return nil, fmt.Errorf("cassette is required for the replay provider")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("cassette not found: %w", err)
+	}
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayProvider{cassette: c}, nil
+}
+
+// GenerateCommand returns the recorded result of a generate request
+func (p *ReplayProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	recorded, ok := p.cassette.Find(generateInteraction(req))
+	if !ok || recorded.Result == nil {
+		return nil, fmt.Errorf("no recorded response for %q in %s", req.Prompt, p.cassette.path)
+	}
+	result := *recorded.Result
+	return &result, nil
+}
+
+// GenerateCommandStream replays the recorded chunks of a generate request, or
+// the whole command as one chunk if it was not streamed
+func (p *ReplayProvider) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	recorded, ok := p.cassette.Find(generateInteraction(req))
+	if !ok || recorded.Result == nil {
+		return nil, fmt.Errorf("no recorded response for %q in %s", req.Prompt, p.cassette.path)
+	}
+	chunks := recorded.Chunks
+	if len(chunks) == 0 {
+		chunks = []string{recorded.Result.Command()}
+	}
+	for _, chunk := range chunks {
+		callback(chunk)
+	}
+	result := *recorded.Result
+	return &result, nil
+}
+
+// GenerateCommandWithTools returns the recorded result of a generate request.
+// The tool calls made while recording are not replayed.
+func (p *ReplayProvider) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	return p.GenerateCommand(ctx, req)
+}
+
+// ExplainCommand returns the recorded explanation of a command
+func (p *ReplayProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	recorded, ok := p.cassette.Find(&Interaction{Kind: cache.KindExplain, Command: req.Command})
+	if !ok {
+		return "", fmt.Errorf("no recorded explanation for %q in %s", req.Command, p.cassette.path)
+	}
+	return recorded.Explanation, nil
+}
+
+// ExplainCommandStream replays the recorded explanation of a command as one chunk
+func (p *ReplayProvider) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	explanation, err := p.ExplainCommand(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	callback(explanation)
+	return explanation, nil
+}
+
+// ReviewCommand returns the recorded review of a command
+func (p *ReplayProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	recorded, ok := p.cassette.Find(reviewInteraction(req))
+	if !ok || recorded.Review == nil {
+		return nil, fmt.Errorf("no recorded review for %q in %s", req.Command, p.cassette.path)
+	}
+	review := *recorded.Review
+	return &review, nil
+}
+
+// RecordingProvider wraps a provider and saves each request and response to
+// a cassette, which the replay provider can serve later
+type RecordingProvider struct {
+	provider Provider
+	cassette *Cassette
+	cfg      *config.Config
+
+	// OnError, if set, is called when an interaction cannot be saved
+	OnError func(err error)
+}
+
+// NewRecordingProvider wraps a provider, appending its interactions to the cassette at path
+func NewRecordingProvider(provider Provider, path string, cfg *config.Config) (*RecordingProvider, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingProvider{provider: provider, cassette: c, cfg: cfg}, nil
+}
+
+// Close releases resources held by the wrapped provider
+func (p *RecordingProvider) Close() error {
+	return CloseProvider(p.provider)
+}
+
+// Unwrap returns the wrapped provider
+func (p *RecordingProvider) Unwrap() Provider {
+	return p.provider
+}
+
+// AnsweredBy returns the provider and model that answered the last request
+func (p *RecordingProvider) AnsweredBy() (config.Provider, string) {
+	return AnsweredBy(p.provider, p.cfg)
+}
+
+// record saves an interaction, tagged with the provider that answered it
+func (p *RecordingProvider) record(i *Interaction) {
+	name, model := AnsweredBy(p.provider, p.cfg)
+	i.Provider, i.Model = string(name), model
+	if err := p.cassette.Add(*i); err != nil && p.OnError != nil {
+		p.OnError(err)
+	}
+}
+
+// GenerateCommand generates a command and records the result
+func (p *RecordingProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	result, err := p.provider.GenerateCommand(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	i := generateInteraction(req)
+	i.Result = result
+	p.record(i)
+	return result, nil
+}
+
+// GenerateCommandStream streams a command if the wrapped provider supports
+// streaming, and records the result along with the streamed chunks
+func (p *RecordingProvider) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	var chunks []string
+	record := func(chunk string) {
+		chunks = append(chunks, chunk)
+		callback(chunk)
+	}
+
+	var result *CommandResult
+	var err error
+	if sp, ok := p.provider.(StreamingProvider); ok {
+		result, err = sp.GenerateCommandStream(ctx, req, record)
+	} else if result, err = p.provider.GenerateCommand(ctx, req); err == nil {
+		record(result.Command())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	i := generateInteraction(req)
+	i.Result, i.Chunks = result, chunks
+	p.record(i)
+	return result, nil
+}
+
+// GenerateCommandWithTools generates a command with probing tools if the
+// wrapped provider supports them, and records the result
+func (p *RecordingProvider) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	result, err := generateWithTools(ctx, p.provider, req, tools)
+	if err != nil {
+		return nil, err
+	}
+	i := generateInteraction(req)
+	i.Result = result
+	p.record(i)
+	return result, nil
+}
+
+// ExplainCommand explains a command and records the explanation
+func (p *RecordingProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	explanation, err := p.provider.ExplainCommand(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	p.record(&Interaction{Kind: cache.KindExplain, Command: strings.TrimSpace(req.Command), Explanation: explanation})
+	return explanation, nil
+}
+
+// ExplainCommandStream streams an explanation if the wrapped provider supports
+// streaming, and records the explanation
+func (p *RecordingProvider) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	explanation, err := explainStream(ctx, p.provider, req, callback)
+	if err != nil {
+		return "", err
+	}
+	p.record(&Interaction{Kind: cache.KindExplain, Command: strings.TrimSpace(req.Command), Explanation: explanation})
+	return explanation, nil
+}
+
+// ReviewCommand reviews a command if the wrapped provider supports reviews,
+// and records the review
+func (p *RecordingProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	review, err := reviewCommand(ctx, p.provider, req)
+	if err != nil {
+		return nil, err
+	}
+	i := reviewInteraction(req)
+	i.Review = review
+	p.record(i)
+	return review, nil
+}
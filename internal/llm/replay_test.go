@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	cfg := &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o"}
+	bash := shell.ShellInfo{Shell: shell.ShellBash}
+	ctx := context.Background()
+
+	fake := &fakeProvider{command: "ls -la"}
+	recorder, err := NewRecordingProvider(fake, path, cfg)
+	if err != nil {
+		t.Fatalf("NewRecordingProvider returned error: %v", err)
+	}
+	if _, err := recorder.GenerateCommand(ctx, GenerateRequest{Prompt: "list files", ShellInfo: bash}); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	fake.command = "ls -laR"
+	if _, err := recorder.GenerateCommand(ctx, GenerateRequest{Prompt: "list files", ShellInfo: bash}); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	var streamed []string
+	if _, err := recorder.GenerateCommandStream(ctx, GenerateRequest{Prompt: "disk usage", ShellInfo: bash}, func(c string) { streamed = append(streamed, c) }); err != nil {
+		t.Fatalf("GenerateCommandStream returned error: %v", err)
+	}
+	if _, err := recorder.ExplainCommand(ctx, ExplainRequest{Command: "ls -la"}); err != nil {
+		t.Fatalf("ExplainCommand returned error: %v", err)
+	}
+
+	replay, err := NewReplayProvider(path)
+	if err != nil {
+		t.Fatalf("NewReplayProvider returned error: %v", err)
+	}
+
+	// Repeated requests replay in recorded order, then repeat the last response
+	for _, expected := range []string{"ls -la", "ls -laR", "ls -laR"} {
+		result, err := replay.GenerateCommand(ctx, GenerateRequest{Prompt: "list files", ShellInfo: bash})
+		if err != nil {
+			t.Fatalf("GenerateCommand returned error: %v", err)
+		}
+		if result.Command() != expected {
+			t.Errorf("command = %q, expected %q", result.Command(), expected)
+		}
+	}
+
+	// A request recorded in another shell still matches by prompt
+	var chunks []string
+	result, err := replay.GenerateCommandStream(ctx, GenerateRequest{Prompt: "disk usage", ShellInfo: shell.ShellInfo{Shell: shell.ShellZsh}}, func(c string) { chunks = append(chunks, c) })
+	if err != nil {
+		t.Fatalf("GenerateCommandStream returned error: %v", err)
+	}
+	if result.Command() != "ls -laR" || len(chunks) != len(streamed) {
+		t.Errorf("stream replayed %q in %d chunks, expected %d", result.Command(), len(chunks), len(streamed))
+	}
+
+	// Explanations match by command, whatever local documentation was found
+	explanation, err := replay.ExplainCommand(ctx, ExplainRequest{Command: "  ls -la ", Reference: "-a  do not ignore entries starting with ."})
+	if err != nil || explanation != "explains ls -la" {
+		t.Errorf("ExplainCommand = %q, %v", explanation, err)
+	}
+
+	if _, err := replay.GenerateCommand(ctx, GenerateRequest{Prompt: "never recorded", ShellInfo: bash}); err == nil {
+		t.Error("GenerateCommand of an unrecorded prompt returned no error")
+	}
+	if fake.calls != 4 {
+		t.Errorf("wrapped provider called %d times, expected 4", fake.calls)
+	}
+}
+
+func TestReplayHandWrittenCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette := `{"interactions": [
+  {"kind": "generate", "prompt": "show the date", "result": {"commands": ["date"], "risk": "low"}}
+]}`
+	if err := os.WriteFile(path, []byte(cassette), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewProvider(&config.Config{Provider: config.ProviderReplay, Cassette: path})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+	result, err := provider.GenerateCommand(context.Background(), GenerateRequest{
+		Prompt:    "show the date",
+		ShellInfo: shell.ShellInfo{Shell: shell.ShellFish},
+		History:   []Turn{{Prompt: "hello", Command: "echo hello"}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if result.Command() != "date" || result.Risk != RiskLow {
+		t.Errorf("result = %+v", result)
+	}
+
+	if _, err := NewProvider(&config.Config{Provider: config.ProviderReplay, Cassette: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("NewProvider with a missing cassette returned no error")
+	}
+}
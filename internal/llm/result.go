@@ -0,0 +1,350 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Risk levels the model can report for a generated command
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// CommandResult is the structured result of a command generation request
+type CommandResult struct {
+	Commands     []string `json:"commands"`               // Commands to run, in order
+	Explanation  string   `json:"explanation,omitempty"`  // Short explanation of what the commands do
+	Assumptions  []string `json:"assumptions,omitempty"`  // Assumptions the model made about the request
+	Placeholders []string `json:"placeholders,omitempty"` // Placeholders the user must fill in (e.g. <username>)
+	Risk         string   `json:"risk,omitempty"`         // Self-reported risk: low, medium or high
+
+	Alternatives []CommandResult `json:"alternatives,omitempty"` // Other candidate solutions, if requested
+}
+
+// Command returns the commands joined into a single runnable script
+func (r *CommandResult) Command() string {
+	return strings.Join(r.Commands, "\n")
+}
+
+// Candidates returns the result followed by its alternatives, with duplicate
+// commands removed
+func (r *CommandResult) Candidates() []CommandResult {
+	primary := *r
+	primary.Alternatives = nil
+
+	candidates := []CommandResult{primary}
+	seen := map[string]bool{normalizeCommand(primary.Command()): true}
+	for _, alt := range r.Alternatives {
+		key := normalizeCommand(alt.Command())
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		alt.Alternatives = nil
+		candidates = append(candidates, alt)
+	}
+	return candidates
+}
+
+// normalizeCommand reduces a command to a canonical form for comparison
+func normalizeCommand(command string) string {
+	var lines []string
+	for _, line := range strings.Split(command, "\n") {
+		line = strings.TrimSuffix(strings.Join(strings.Fields(line), " "), ";")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commandResultSchema is the JSON schema of a CommandResult, used for tool calling
+var commandResultSchema = withAlternatives(candidateSchema)
+
+// candidateSchema is the JSON schema of a single candidate solution
+var candidateSchema = map[string]interface{}{
+	"commands": map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "Shell commands to run, in order. One command per item.",
+	},
+	"explanation": map[string]interface{}{
+		"type":        "string",
+		"description": "One or two sentences explaining what the commands do.",
+	},
+	"assumptions": map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "Assumptions made about the request, if any.",
+	},
+	"placeholders": map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "Placeholders in the commands the user must replace, e.g. <username>.",
+	},
+	"risk": map[string]interface{}{
+		"type":        "string",
+		"enum":        []string{RiskLow, RiskMedium, RiskHigh},
+		"description": "How risky the commands are to run.",
+	},
+}
+
+// withAlternatives extends a candidate schema with an array of alternative candidates
+func withAlternatives(properties map[string]interface{}) map[string]interface{} {
+	schema := make(map[string]interface{}, len(properties)+1)
+	for k, v := range properties {
+		schema[k] = v
+	}
+	schema["alternatives"] = map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   []string{"commands"},
+		},
+		"description": "Other solutions using different tools or approaches, only when requested.",
+	}
+	return schema
+}
+
+// structuredFormatRules describes the JSON response format to the model
+const structuredFormatRules = `- Respond with a single JSON object and nothing else, with these fields:
+  "commands": array of shell commands to run in order, one command per item
+  "explanation": one or two sentences explaining what the commands do
+  "assumptions": array of assumptions you made about the request (may be empty)
+  "placeholders": array of placeholders in the commands the user must replace, e.g. "<username>" (may be empty)
+  "risk": "low", "medium" or "high" depending on how destructive the commands are
+- Do not wrap the JSON in markdown or code blocks`
+
+// structuredRules returns the JSON response format rules, asking for the given
+// number of candidate solutions when more than one is wanted
+func structuredRules(candidates int) string {
+	if candidates <= 1 {
+		return structuredFormatRules
+	}
+	return structuredFormatRules + fmt.Sprintf(`
+- Provide %d different solutions, each using a different tool, flag set or approach where possible
+- Put the best solution in the fields above and the other %d in "alternatives": an array of objects with the same fields`, candidates, candidates-1)
+}
+
+// plainFormatRules describes the plain text response format to the model
+const plainFormatRules = `- Return ONLY the command(s), no explanations, no markdown, no code blocks
+- If multiple commands are needed, put each on a new line`
+
+var (
+	// codeBlockRegex matches fenced code blocks with any (or no) language tag
+	codeBlockRegex = regexp.MustCompile("(?s)```[^\\n`]*\\n(.*?)(?:```|$)")
+	// inlineFenceRegex matches a fenced block written on a single line
+	inlineFenceRegex = regexp.MustCompile("^```(?:(?:bash|sh|shell|zsh|fish|powershell|pwsh|ps1|cmd|bat|console)\\s+)?(.+?)```$")
+	// proseLeadRegex matches lead-in sentences like "Here is the command:"
+	proseLeadRegex = regexp.MustCompile(`^[A-Z][\w',()-]*( [\w',()-]+)+:$`)
+)
+
+// rawCommandResult accepts the field variations models produce
+type rawCommandResult struct {
+	Commands     flexibleStrings `json:"commands"`
+	Command      flexibleStrings `json:"command"`
+	Explanation  string          `json:"explanation"`
+	Assumptions  flexibleStrings `json:"assumptions"`
+	Placeholders flexibleStrings `json:"placeholders"`
+	Risk         string          `json:"risk"`
+
+	Alternatives []rawCommandResult `json:"alternatives"`
+	Candidates   []rawCommandResult `json:"candidates"`
+}
+
+// flexibleStrings unmarshals from either a JSON string or an array of strings
+type flexibleStrings []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *flexibleStrings) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*f = flexibleStrings{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*f = list
+	return nil
+}
+
+// ParseCommandResult parses a model response into a CommandResult. It accepts
+// JSON objects (bare or fenced), markdown code blocks in any language, and
+// plain text commands, in that order of preference.
+func ParseCommandResult(raw string) (*CommandResult, error) {
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return nil, fmt.Errorf("empty response from model")
+	}
+
+	if result, ok := parseJSONResult(text); ok {
+		return result, nil
+	}
+
+	if matches := codeBlockRegex.FindAllStringSubmatchIndex(text, -1); len(matches) > 0 {
+		result := &CommandResult{}
+		var prose strings.Builder
+		last := 0
+		for _, m := range matches {
+			prose.WriteString(text[last:m[0]])
+			last = m[1]
+
+			block := text[m[2]:m[3]]
+			if jsonResult, ok := parseJSONResult(strings.TrimSpace(block)); ok {
+				return jsonResult, nil
+			}
+			result.Commands = append(result.Commands, commandLines(block)...)
+		}
+		prose.WriteString(text[last:])
+
+		if len(result.Commands) > 0 {
+			result.Explanation = collapseProse(prose.String())
+			return result, nil
+		}
+	}
+
+	if m := inlineFenceRegex.FindStringSubmatch(text); m != nil {
+		text = m[1]
+	}
+
+	var lines []string
+	for _, line := range commandLines(text) {
+		if !strings.HasPrefix(line, "```") {
+			lines = append(lines, line)
+		}
+	}
+	for len(lines) > 1 && proseLeadRegex.MatchString(lines[0]) {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no command found in response")
+	}
+
+	return &CommandResult{Commands: lines}, nil
+}
+
+// parseJSONResult tries to parse text as a JSON command result
+func parseJSONResult(text string) (*CommandResult, bool) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start != 0 || end < start {
+		return nil, false
+	}
+
+	var raw rawCommandResult
+	if err := json.Unmarshal([]byte(text[start:end+1]), &raw); err != nil {
+		return nil, false
+	}
+
+	result := raw.toResult()
+	alternatives := append(raw.Alternatives, raw.Candidates...)
+	// Some models put every solution in the array and leave the top level empty
+	if len(result.Commands) == 0 && len(alternatives) > 0 {
+		result = alternatives[0].toResult()
+		alternatives = alternatives[1:]
+	}
+	if len(result.Commands) == 0 {
+		return nil, false
+	}
+
+	for _, alt := range alternatives {
+		if altResult := alt.toResult(); len(altResult.Commands) > 0 {
+			result.Alternatives = append(result.Alternatives, *altResult)
+		}
+	}
+
+	return result, true
+}
+
+// toResult converts a raw result to a CommandResult, ignoring any alternatives
+func (raw rawCommandResult) toResult() *CommandResult {
+	commands := raw.Commands
+	if len(commands) == 0 {
+		commands = raw.Command
+	}
+
+	result := &CommandResult{
+		Explanation:  strings.TrimSpace(raw.Explanation),
+		Assumptions:  raw.Assumptions,
+		Placeholders: raw.Placeholders,
+		Risk:         normalizeRisk(raw.Risk),
+	}
+	for _, cmd := range commands {
+		result.Commands = append(result.Commands, commandLines(cmd)...)
+	}
+	return result
+}
+
+// commandLines splits a block of text into commands, dropping blank lines and
+// shell prompt prefixes, removing common indentation and joining backslash
+// line continuations
+func commandLines(block string) []string {
+	rawLines := strings.Split(block, "\n")
+	indent := -1
+	for _, line := range rawLines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	var lines []string
+	var pending string
+	for _, line := range rawLines {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		line = line[indent:]
+
+		if pending == "" {
+			line = strings.TrimPrefix(line, "$ ")
+			if len(line) > 2 && strings.HasPrefix(line, "`") && strings.HasSuffix(line, "`") && !strings.HasPrefix(line, "```") {
+				line = line[1 : len(line)-1]
+			}
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			pending += line + "\n"
+			continue
+		}
+		lines = append(lines, pending+line)
+		pending = ""
+	}
+	if pending != "" {
+		lines = append(lines, strings.TrimRight(pending, "\n"))
+	}
+
+	return lines
+}
+
+// collapseProse turns the text around code blocks into a single-line explanation
+func collapseProse(prose string) string {
+	return strings.TrimSuffix(strings.Join(strings.Fields(prose), " "), ":")
+}
+
+// normalizeRisk maps a self-reported risk to one of the known risk levels
+func normalizeRisk(risk string) string {
+	switch strings.ToLower(strings.TrimSpace(risk)) {
+	case RiskLow:
+		return RiskLow
+	case RiskMedium, "moderate":
+		return RiskMedium
+	case RiskHigh, "critical", "dangerous":
+		return RiskHigh
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommandResult(t *testing.T) {
+	tests := []struct {
+		name             string
+		raw              string
+		expectedCommands []string
+		expectedRisk     string
+	}{
+		// Plain text
+		{"plain command", "ls -la", []string{"ls -la"}, ""},
+		{"plain multi-line", "cd src\nls", []string{"cd src", "ls"}, ""},
+		{"shell prompt prefix", "$ ls -la", []string{"ls -la"}, ""},
+		{"inline backticks", "`ls -la`", []string{"ls -la"}, ""},
+		{"single-line fence", "```ls -la```", []string{"ls -la"}, ""},
+		{"prose lead-in", "Here is the command:\nls -la", []string{"ls -la"}, ""},
+		{"awk braces are not json", "awk '{print $1}' file.txt", []string{"awk '{print $1}' file.txt"}, ""},
+
+		// Code blocks
+		{"bash fence", "```bash\nls -la\n```", []string{"ls -la"}, ""},
+		{"unknown fence language", "```zsh\nls -la\n```", []string{"ls -la"}, ""},
+		{"fence with prose", "Use this:\n```sh\nfind . -name '*.go'\n```\nIt finds Go files.", []string{"find . -name '*.go'"}, ""},
+		{"two code blocks", "```bash\ncd src\n```\nthen\n```bash\nls\n```", []string{"cd src", "ls"}, ""},
+		{"unterminated fence", "```bash\nls -la", []string{"ls -la"}, ""},
+		{"line continuation", "```bash\ntar -czf out.tgz \\\n  src\n```", []string{"tar -czf out.tgz \\\n  src"}, ""},
+
+		// JSON
+		{"json object", `{"commands": ["ls -la"], "risk": "low"}`, []string{"ls -la"}, RiskLow},
+		{"json single command", `{"command": "ls -la", "risk": "HIGH"}`, []string{"ls -la"}, RiskHigh},
+		{"fenced json", "```json\n{\"commands\": [\"du -sh *\"]}\n```", []string{"du -sh *"}, ""},
+		{"json with unknown risk", `{"commands": ["pwd"], "risk": "whatever"}`, []string{"pwd"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseCommandResult(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseCommandResult(%q) returned error: %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(result.Commands, tt.expectedCommands) {
+				t.Errorf("ParseCommandResult(%q).Commands = %q, expected %q", tt.raw, result.Commands, tt.expectedCommands)
+			}
+			if result.Risk != tt.expectedRisk {
+				t.Errorf("ParseCommandResult(%q).Risk = %q, expected %q", tt.raw, result.Risk, tt.expectedRisk)
+			}
+		})
+	}
+}
+
+func TestParseCommandResultFields(t *testing.T) {
+	raw := `{"commands": ["useradd <username>"], "explanation": "Adds a user.", "assumptions": ["Linux"], "placeholders": ["<username>"], "risk": "medium"}`
+
+	result, err := ParseCommandResult(raw)
+	if err != nil {
+		t.Fatalf("ParseCommandResult returned error: %v", err)
+	}
+	if result.Explanation != "Adds a user." {
+		t.Errorf("Explanation = %q", result.Explanation)
+	}
+	if !reflect.DeepEqual(result.Assumptions, []string{"Linux"}) {
+		t.Errorf("Assumptions = %q", result.Assumptions)
+	}
+	if !reflect.DeepEqual(result.Placeholders, []string{"<username>"}) {
+		t.Errorf("Placeholders = %q", result.Placeholders)
+	}
+	if result.Risk != RiskMedium {
+		t.Errorf("Risk = %q", result.Risk)
+	}
+}
+
+func TestParseCommandResultEmpty(t *testing.T) {
+	for _, raw := range []string{"", "   \n ", "```bash\n```"} {
+		if _, err := ParseCommandResult(raw); err == nil {
+			t.Errorf("ParseCommandResult(%q) expected error, got nil", raw)
+		}
+	}
+}
+
+func TestParseCommandResultAlternatives(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          string
+		expectedLen  int
+		expectedLast string
+	}{
+		{"no alternatives", `{"commands": ["ls"]}`, 1, "ls"},
+		{"alternatives array", `{"commands": ["ls -la"], "alternatives": [{"commands": ["exa -la"]}, {"command": "tree -L 1"}]}`, 3, "tree -L 1"},
+		{"candidates only", `{"candidates": [{"commands": ["du -sh *"]}, {"commands": ["ncdu"]}]}`, 2, "ncdu"},
+		{"empty alternative dropped", `{"commands": ["pwd"], "alternatives": [{"commands": []}]}`, 1, "pwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseCommandResult(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseCommandResult(%q) returned error: %v", tt.raw, err)
+			}
+			candidates := result.Candidates()
+			if len(candidates) != tt.expectedLen {
+				t.Fatalf("Candidates() returned %d, expected %d", len(candidates), tt.expectedLen)
+			}
+			if last := candidates[len(candidates)-1].Command(); last != tt.expectedLast {
+				t.Errorf("last candidate = %q, expected %q", last, tt.expectedLast)
+			}
+		})
+	}
+}
+
+func TestCandidatesDeduplicate(t *testing.T) {
+	result := &CommandResult{
+		Commands: []string{"find . -name '*.go'"},
+		Alternatives: []CommandResult{
+			{Commands: []string{"find .  -name '*.go';"}},
+			{Commands: []string{"fd -e go"}},
+			{Commands: []string{"fd -e go"}},
+		},
+	}
+
+	candidates := result.Candidates()
+	if len(candidates) != 2 {
+		t.Fatalf("Candidates() returned %d, expected 2: %v", len(candidates), candidates)
+	}
+	if candidates[1].Command() != "fd -e go" {
+		t.Errorf("second candidate = %q, expected %q", candidates[1].Command(), "fd -e go")
+	}
+	if len(candidates[0].Alternatives) != 0 {
+		t.Errorf("candidates should not carry nested alternatives")
+	}
+}
@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+// RetryPolicy controls how failed HTTP requests to a provider are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // Total attempts per request, including the first
+	InitialBackoff time.Duration // Delay before the first retry
+	MaxBackoff     time.Duration // Upper bound for the exponential delay
+}
+
+// NewRetryPolicy creates a retry policy from the config
+func NewRetryPolicy(cfg *config.Config) RetryPolicy {
+	retry := cfg.GetRetry()
+	return RetryPolicy{
+		MaxAttempts:    retry.MaxAttempts,
+		InitialBackoff: time.Duration(retry.InitialBackoffMs) * time.Millisecond,
+		MaxBackoff:     time.Duration(retry.MaxBackoffMs) * time.Millisecond,
+	}
+}
+
+// backoff returns the jittered exponential delay before the given retry (1-based)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	// Equal jitter: between half and all of the delay
+	half := delay / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// NewRetryClient returns an HTTP client that retries requests according to the policy
+func NewRetryClient(policy RetryPolicy, base http.RoundTripper) *http.Client {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &http.Client{Transport: &retryTransport{policy: policy, base: base}}
+}
+
+// retryTransport is an http.RoundTripper that retries rate-limited, overloaded
+// and failed requests with exponential backoff. Server hints such as
+// Retry-After take precedence over the computed delay, and no retry is made
+// when the wait would run past the request's deadline.
+type retryTransport struct {
+	policy RetryPolicy
+	base   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.policy.MaxAttempts <= 1 {
+		return t.base.RoundTrip(req)
+	}
+
+	// Buffer the body so it can be replayed on each attempt
+	getBody := req.GetBody
+	if req.Body != nil && req.Body != http.NoBody && getBody == nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.Clone(ctx)
+		if getBody != nil {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= t.policy.MaxAttempts || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := retryAfter(resp)
+		if delay <= 0 {
+			delay = t.policy.backoff(attempt)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry reports whether a response or transport error is worth retrying.
+// Refused connections are not retried so fallback providers can take over quickly.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		529: // Anthropic: overloaded
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the server through Retry-After or
+// provider rate-limit headers, or 0 if there is none
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	h := resp.Header
+
+	// OpenAI and Azure send a millisecond precision hint
+	if ms, err := strconv.Atoi(h.Get("retry-after-ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+
+	if value := h.Get("Retry-After"); value != "" {
+		if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return time.Until(at)
+		}
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+
+	// OpenAI-style durations, e.g. "1s" or "6m0s"
+	for _, name := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		if d, err := time.ParseDuration(h.Get(name)); err == nil && d > 0 {
+			return d
+		}
+	}
+
+	// Anthropic-style RFC 3339 timestamps
+	for _, name := range []string{"anthropic-ratelimit-requests-reset", "anthropic-ratelimit-tokens-reset"} {
+		if at, err := time.Parse(time.RFC3339, h.Get(name)); err == nil {
+			if d := time.Until(at); d > 0 {
+				return d
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+// fastPolicy retries quickly so tests stay fast
+var fastPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+// flakyServer fails with the given statuses before answering 200 with body
+func flakyServer(t *testing.T, statuses []int, header http.Header, body string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if reqBody, _ := io.ReadAll(r.Body); r.Method == http.MethodPost && len(reqBody) == 0 {
+			t.Errorf("attempt %d: request body was not replayed", n)
+		}
+		if n <= len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name           string
+		statuses       []int
+		header         http.Header
+		expectedStatus int
+		expectedCalls  int32
+	}{
+		{"success", nil, nil, http.StatusOK, 1},
+		{"transient 503", []int{503, 502}, nil, http.StatusOK, 3},
+		{"rate limited with hint", []int{429}, http.Header{"Retry-After-Ms": {"5"}}, http.StatusOK, 2},
+		{"bad request not retried", []int{400}, nil, http.StatusBadRequest, 1},
+		{"gives up after max attempts", []int{503, 503, 503, 503}, nil, http.StatusServiceUnavailable, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := flakyServer(t, tt.statuses, tt.header, `{}`)
+			client := NewRetryClient(fastPolicy, nil)
+
+			resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{"prompt":"ls"}`))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", resp.StatusCode, tt.expectedStatus)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.expectedCalls {
+				t.Errorf("server called %d times, expected %d", got, tt.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRespectsDeadline(t *testing.T) {
+	server, calls := flakyServer(t, []int{429}, http.Header{"Retry-After": {"30"}}, `{}`)
+	client := NewRetryClient(fastPolicy, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, expected 429", resp.StatusCode)
+	}
+	if atomic.LoadInt32(calls) != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected a single attempt without waiting past the deadline")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		header   http.Header
+		expected time.Duration
+	}{
+		{"none", 429, http.Header{}, 0},
+		{"seconds", 503, http.Header{"Retry-After": {"2"}}, 2 * time.Second},
+		{"milliseconds", 429, http.Header{"Retry-After-Ms": {"250"}}, 250 * time.Millisecond},
+		{"openai reset", 429, http.Header{"X-Ratelimit-Reset-Requests": {"1.5s"}}, 1500 * time.Millisecond},
+		{"reset ignored without 429", 500, http.Header{"X-Ratelimit-Reset-Requests": {"1s"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retryAfter(&http.Response{StatusCode: tt.status, Header: tt.header})
+			if got != tt.expected {
+				t.Errorf("retryAfter() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatibleRetries(t *testing.T) {
+	completion := `{"id":"1","object":"chat.completion","model":"test","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"ls -la\"]}"}}]}`
+	server, calls := flakyServer(t, []int{503}, nil, completion)
+
+	provider, err := NewOpenAICompatible("key", server.URL, "test", "", NewRetryClient(fastPolicy, nil))
+	if err != nil {
+		t.Fatalf("NewOpenAICompatible returned error: %v", err)
+	}
+
+	result, err := provider.GenerateCommand(context.Background(), GenerateRequest{Prompt: "list files", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}})
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if result.Command() != "ls -la" {
+		t.Errorf("command = %q, expected %q", result.Command(), "ls -la")
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("server called %d times, expected 2", got)
+	}
+}
@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+// ReviewRequest describes a generated command to check for mistakes
+type ReviewRequest struct {
+	Command   string
+	ShellInfo shell.ShellInfo
+}
+
+// Review is the result of reviewing a command
+type Review struct {
+	Issues      []string `json:"issues,omitempty"`      // Problems found, e.g. a GNU-only flag on macOS
+	Commands    []string `json:"commands,omitempty"`    // The corrected command(s), or the original if nothing is wrong
+	Explanation string   `json:"explanation,omitempty"` // What the corrected command does
+	Risk        string   `json:"risk,omitempty"`        // Risk of the corrected command: low, medium or high
+}
+
+// Command returns the corrected commands joined into a single runnable script
+func (r *Review) Command() string {
+	return strings.Join(r.Commands, "\n")
+}
+
+// Corrects reports whether the review proposes a command different from the original
+func (r *Review) Corrects(original string) bool {
+	return len(r.Commands) > 0 && normalizeCommand(r.Command()) != normalizeCommand(original)
+}
+
+// ReviewProvider is an optional interface for providers that can review
+// generated commands in a second pass
+type ReviewProvider interface {
+	Provider
+	// ReviewCommand checks a command for mistakes and suggests a corrected one
+	ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error)
+}
+
+// SupportsReview checks if a provider can review commands
+func SupportsReview(p Provider) bool {
+	return supports(p, func(p Provider) bool {
+		_, ok := p.(ReviewProvider)
+		return ok
+	})
+}
+
+// reviewCommand reviews a command with a provider, if it supports reviews
+func reviewCommand(ctx context.Context, p Provider, req ReviewRequest) (*Review, error) {
+	rp, ok := p.(ReviewProvider)
+	if !ok {
+		return nil, fmt.Errorf("the provider can't review commands")
+	}
+	return rp.ReviewCommand(ctx, req)
+}
+
+// reviewSchema is the JSON schema of a Review
+var reviewSchema = map[string]interface{}{
+	"issues": map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "Problems found in the command, one short sentence each; empty if it is correct",
+	},
+	"commands": map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "The corrected command(s), or the original unchanged if it is correct",
+	},
+	"explanation": map[string]interface{}{
+		"type":        "string",
+		"description": "One or two sentences on what the corrected command does",
+	},
+	"risk": map[string]interface{}{
+		"type":        "string",
+		"enum":        []string{RiskLow, RiskMedium, RiskHigh},
+		"description": "How risky the corrected command is to run",
+	},
+}
+
+// BuildReviewPrompt builds the system prompt for reviewing a command
+func BuildReviewPrompt(shellInfo shell.ShellInfo) string {
+	return fmt.Sprintf(`You are a careful reviewer of shell commands. Given a command generated for the shell and OS below, check it for mistakes before the user runs it.
+
+Look for:
+- Options that don't exist on this OS, such as GNU-only flags on macOS or BSD
+- Wrong option or argument order
+- Quoting and escaping bugs, unquoted globs or variables, and word splitting
+- Syntax that doesn't work in this shell
+- Commands that don't do what they appear to intend
+
+Rules:
+- Respond with a single JSON object and nothing else, with these fields:
+  "issues": array of problems found, one short sentence each; empty if the command is correct
+  "commands": array of the corrected command(s); the original unchanged if it is correct
+  "explanation": one or two sentences on what the corrected command does
+  "risk": "low", "medium" or "high" depending on how destructive the corrected command is
+- Only report real problems, not style preferences
+- Keep the user's intent; change only what is needed to fix the issues
+
+Current shell: %s
+Operating system: %s`, shell.GetShellName(shellInfo.Shell), shell.GetOSName())
+}
+
+// ParseReview parses a model response into a Review. It accepts a JSON object,
+// bare or in a code fence.
+func ParseReview(raw string) (*Review, error) {
+	text := strings.TrimSpace(raw)
+	if m := codeBlockRegex.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no review found in response")
+	}
+
+	var parsed struct {
+		Issues      flexibleStrings `json:"issues"`
+		Commands    flexibleStrings `json:"commands"`
+		Command     flexibleStrings `json:"command"`
+		Explanation string          `json:"explanation"`
+		Risk        string          `json:"risk"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid review: %w", err)
+	}
+
+	review := &Review{Explanation: strings.TrimSpace(parsed.Explanation), Risk: normalizeRisk(parsed.Risk)}
+	for _, issue := range parsed.Issues {
+		if issue = strings.TrimSpace(issue); issue != "" {
+			review.Issues = append(review.Issues, issue)
+		}
+	}
+	for _, command := range append(parsed.Commands, parsed.Command...) {
+		review.Commands = append(review.Commands, commandLines(command)...)
+	}
+	return review, nil
+}
@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/cache"
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/openai/openai-go"
+)
+
+// reviewingProvider is a fake provider that can review commands
+type reviewingProvider struct {
+	fakeProvider
+	reviews int
+}
+
+func (p *reviewingProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	p.reviews++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Review{Issues: []string{"reviewed " + req.Command}, Commands: []string{p.command}}, nil
+}
+
+func TestParseReview(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		issues   []string
+		commands []string
+	}{
+		{
+			name:     "bare",
+			raw:      `{"issues":["-printf is GNU-only"],"commands":["find . -type f -exec stat -f '%z %N' {} +"]}`,
+			issues:   []string{"-printf is GNU-only"},
+			commands: []string{"find . -type f -exec stat -f '%z %N' {} +"},
+		},
+		{
+			name:     "fenced",
+			raw:      "```json\n{\"issues\": [], \"commands\": [\"ls -la\"]}\n```",
+			commands: []string{"ls -la"},
+		},
+		{
+			name:     "command string",
+			raw:      `Here is my review: {"issues":"unquoted glob","command":"rm -- \"*.tmp\""}`,
+			issues:   []string{"unquoted glob"},
+			commands: []string{`rm -- "*.tmp"`},
+		},
+		{
+			name:   "blank issues",
+			raw:    `{"issues":["", "  "]}`,
+			issues: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := ParseReview(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseReview returned error: %v", err)
+			}
+			if !reflect.DeepEqual(review.Issues, tt.issues) {
+				t.Errorf("issues = %q, expected %q", review.Issues, tt.issues)
+			}
+			if !reflect.DeepEqual(review.Commands, tt.commands) {
+				t.Errorf("commands = %q, expected %q", review.Commands, tt.commands)
+			}
+		})
+	}
+
+	review, err := ParseReview(`{"issues":["-printf is GNU-only"],"commands":["stat -f '%z %N' *"],"explanation":" Lists file sizes ","risk":"Low"}`)
+	if err != nil || review.Explanation != "Lists file sizes" || review.Risk != RiskLow {
+		t.Errorf("ParseReview = %+v, %v", review, err)
+	}
+
+	if _, err := ParseReview("looks good to me"); err == nil {
+		t.Error("ParseReview of a response without JSON returned no error")
+	}
+}
+
+func TestReviewCorrects(t *testing.T) {
+	tests := []struct {
+		review   Review
+		original string
+		expected bool
+	}{
+		{Review{Commands: []string{"ls -la"}}, "ls -la", false},
+		{Review{Commands: []string{"ls  -la;"}}, "ls -la", false},
+		{Review{Issues: []string{"-la is fine"}}, "ls -la", false},
+		{Review{Commands: []string{"ls -lA"}}, "ls -la", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.review.Corrects(tt.original); got != tt.expected {
+			t.Errorf("%v.Corrects(%q) = %v, expected %v", tt.review, tt.original, got, tt.expected)
+		}
+	}
+}
+
+func TestOpenAICompatibleReview(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"issues\":[\"sed -i needs a suffix argument on macOS\"],\"commands\":[\"sed -i '' 's/a/b/' f.txt\"]}"}}]}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Provider: config.ProviderOpenAICompatible,
+		Model:    "local",
+		BaseURL:  server.URL + "/v1",
+		Retry:    &config.RetryConfig{MaxAttempts: 1},
+	}
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+	if !SupportsReview(provider) {
+		t.Fatal("provider doesn't support reviews")
+	}
+
+	original := "sed -i 's/a/b/' f.txt"
+	review, err := provider.(ReviewProvider).ReviewCommand(context.Background(), ReviewRequest{Command: original, ShellInfo: shell.ShellInfo{Shell: shell.ShellZsh}})
+	if err != nil {
+		t.Fatalf("ReviewCommand returned error: %v", err)
+	}
+	if len(review.Issues) != 1 || !review.Corrects(original) || review.Command() != "sed -i '' 's/a/b/' f.txt" {
+		t.Errorf("review = %+v", review)
+	}
+}
+
+func TestReviewWrappers(t *testing.T) {
+	cfg := &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o"}
+	req := ReviewRequest{Command: "ls -la", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}
+	ctx := context.Background()
+
+	// Reviews are cached like other requests
+	inner := &reviewingProvider{fakeProvider: fakeProvider{command: "ls -lA"}}
+	cached := NewCachingProvider(inner, cache.New(t.TempDir(), time.Hour), cfg, false)
+	for i := 0; i < 2; i++ {
+		review, err := cached.ReviewCommand(ctx, req)
+		if err != nil || review.Command() != "ls -lA" {
+			t.Fatalf("ReviewCommand = %+v, %v", review, err)
+		}
+	}
+	if inner.reviews != 1 || !cached.CacheHit() {
+		t.Errorf("provider reviewed %d times, expected 1", inner.reviews)
+	}
+
+	// Recorded reviews replay by command
+	path := filepath.Join(t.TempDir(), "session.json")
+	recorder, err := NewRecordingProvider(inner, path, cfg)
+	if err != nil {
+		t.Fatalf("NewRecordingProvider returned error: %v", err)
+	}
+	if _, err := recorder.ReviewCommand(ctx, req); err != nil {
+		t.Fatalf("ReviewCommand returned error: %v", err)
+	}
+	replay, err := NewReplayProvider(path)
+	if err != nil {
+		t.Fatalf("NewReplayProvider returned error: %v", err)
+	}
+	review, err := replay.ReviewCommand(ctx, ReviewRequest{Command: " ls -la ", ShellInfo: shell.ShellInfo{Shell: shell.ShellZsh}})
+	if err != nil || review.Command() != "ls -lA" || len(review.Issues) != 1 {
+		t.Errorf("replayed review = %+v, %v", review, err)
+	}
+	if _, err := replay.ReviewCommand(ctx, ReviewRequest{Command: "pwd"}); err == nil {
+		t.Error("ReviewCommand of an unrecorded command returned no error")
+	}
+
+	// Fallbacks take over reviews
+	failing := &reviewingProvider{fakeProvider: fakeProvider{err: &openai.Error{StatusCode: 503}}}
+	chain := &FallbackProvider{members: []fallbackMember{
+		{name: "p0", model: "m", provider: failing},
+		{name: "p1", model: "m", provider: inner},
+	}}
+	if review, err := chain.ReviewCommand(ctx, req); err != nil || review.Command() != "ls -lA" {
+		t.Errorf("fallback review = %+v, %v", review, err)
+	}
+}
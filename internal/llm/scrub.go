@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/probe"
+	"github.com/Hermithic/aiask/internal/scrub"
+)
+
+// ScrubReport collects the secrets masked during a request
+type ScrubReport struct {
+	mu      sync.Mutex
+	matches []scrub.Match
+}
+
+// Matches returns the secrets masked so far
+func (r *ScrubReport) Matches() []scrub.Match {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]scrub.Match(nil), r.matches...)
+}
+
+// scrubReportKey is the context key of the scrub report
+type scrubReportKey struct{}
+
+// WithScrubReport returns a context that collects the secrets masked in provider calls made with it
+func WithScrubReport(ctx context.Context) (context.Context, *ScrubReport) {
+	report := &ScrubReport{}
+	return context.WithValue(ctx, scrubReportKey{}, report), report
+}
+
+// reportScrubbed adds masked secrets to the scrub report of the context, if any
+func reportScrubbed(ctx context.Context, matches []scrub.Match) {
+	report, ok := ctx.Value(scrubReportKey{}).(*ScrubReport)
+	if !ok || len(matches) == 0 {
+		return
+	}
+	report.mu.Lock()
+	report.matches = append(report.matches, matches...)
+	report.mu.Unlock()
+}
+
+// Sources of scrubbed text besides the parts of the context
+const (
+	sourceFailedCommand = "failed command"
+	sourceCommand       = "command"
+	sourceReference     = "reference"
+	sourceToolOutput    = "tool output"
+)
+
+// ScrubbingProvider wraps a provider and masks secrets in everything sent to
+// it: the prompt and piped input, the conversation, the failed command, the
+// context in the system prompt and the output of probing tools. Placeholders
+// in the answer are replaced with the original values, so commands that use
+// a secret still work. Streamed chunks are passed on as they are.
+type ScrubbingProvider struct {
+	provider Provider
+	cfg      *config.Config
+	scrubber *scrub.Scrubber
+}
+
+// NewScrubbingProvider wraps a provider, masking secrets as set in cfg.Scrub
+func NewScrubbingProvider(provider Provider, cfg *config.Config) (*ScrubbingProvider, error) {
+	scrubber, err := scrub.New(cfg.Scrub)
+	if err != nil {
+		return nil, err
+	}
+	return &ScrubbingProvider{provider: provider, cfg: cfg, scrubber: scrubber}, nil
+}
+
+// Close releases resources held by the wrapped provider
+func (p *ScrubbingProvider) Close() error {
+	return CloseProvider(p.provider)
+}
+
+// Unwrap returns the wrapped provider
+func (p *ScrubbingProvider) Unwrap() Provider {
+	return p.provider
+}
+
+// AnsweredBy returns the provider and model that answered the last request
+func (p *ScrubbingProvider) AnsweredBy() (config.Provider, string) {
+	return AnsweredBy(p.provider, p.cfg)
+}
+
+// mask replaces the secrets in a text and reports them
+func (p *ScrubbingProvider) mask(ctx context.Context, source, text string) string {
+	text, matches := p.scrubber.Scrub(source, text)
+	reportScrubbed(ctx, matches)
+	return text
+}
+
+// scrubRequest returns a copy of a request with its secrets masked. The
+// context gathered for the system prompt is masked as it is built.
+func (p *ScrubbingProvider) scrubRequest(ctx context.Context, req GenerateRequest) GenerateRequest {
+	req.Prompt = p.mask(ctx, PartPrompt, req.Prompt)
+	if len(req.History) > 0 {
+		history := make([]Turn, len(req.History))
+		for i, turn := range req.History {
+			turn.Prompt = p.mask(ctx, PartConversation, turn.Prompt)
+			turn.Command = p.mask(ctx, PartConversation, turn.Command)
+			turn.Outcome = p.mask(ctx, PartConversation, turn.Outcome)
+			history[i] = turn
+		}
+		req.History = history
+	}
+	if req.Failed != nil {
+		req.Failed = &FailedCommand{
+			Command: p.mask(ctx, sourceFailedCommand, req.Failed.Command),
+			Error:   p.mask(ctx, sourceFailedCommand, req.Failed.Error),
+		}
+	}
+	req.scrub = func(source, text string) string {
+		return p.mask(ctx, source, text)
+	}
+	return req
+}
+
+// restoreAll puts the secrets back in each text
+func (p *ScrubbingProvider) restoreAll(texts []string) []string {
+	if texts == nil {
+		return nil
+	}
+	restored := make([]string, len(texts))
+	for i, text := range texts {
+		restored[i] = p.scrubber.Restore(text)
+	}
+	return restored
+}
+
+// restoreResult puts the secrets back in a result. Placeholders of masked
+// secrets aren't for the user to fill in, so they are dropped from the
+// result's placeholders.
+func (p *ScrubbingProvider) restoreResult(result *CommandResult) *CommandResult {
+	if result == nil {
+		return nil
+	}
+	restored := *result
+	restored.Commands = p.restoreAll(result.Commands)
+	restored.Explanation = p.scrubber.Restore(result.Explanation)
+	restored.Assumptions = p.restoreAll(result.Assumptions)
+	restored.Placeholders = nil
+	for _, placeholder := range result.Placeholders {
+		if !p.scrubber.IsPlaceholder(placeholder) {
+			restored.Placeholders = append(restored.Placeholders, placeholder)
+		}
+	}
+	if result.Alternatives != nil {
+		restored.Alternatives = make([]CommandResult, len(result.Alternatives))
+		for i := range result.Alternatives {
+			restored.Alternatives[i] = *p.restoreResult(&result.Alternatives[i])
+		}
+	}
+	return &restored
+}
+
+// GenerateCommand generates a command from a request with its secrets masked
+func (p *ScrubbingProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	result, err := p.provider.GenerateCommand(ctx, p.scrubRequest(ctx, req))
+	return p.restoreResult(result), err
+}
+
+// GenerateCommandStream streams a command if the wrapped provider supports
+// streaming. The streamed chunks keep the placeholders; the result has the
+// secrets restored.
+func (p *ScrubbingProvider) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	req = p.scrubRequest(ctx, req)
+	var result *CommandResult
+	var err error
+	if sp, ok := p.provider.(StreamingProvider); ok {
+		result, err = sp.GenerateCommandStream(ctx, req, callback)
+	} else if result, err = p.provider.GenerateCommand(ctx, req); err == nil {
+		callback(result.Command())
+	}
+	return p.restoreResult(result), err
+}
+
+// GenerateCommandWithTools generates a command with probing tools if the
+// wrapped provider supports them, masking secrets in the tools' output too
+func (p *ScrubbingProvider) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	if tools != nil {
+		filter := tools.Filter
+		tools.Filter = func(output string) string {
+			return p.mask(ctx, sourceToolOutput, output)
+		}
+		defer func() { tools.Filter = filter }()
+	}
+
+	result, err := generateWithTools(ctx, p.provider, p.scrubRequest(ctx, req), tools)
+	return p.restoreResult(result), err
+}
+
+// scrubExplain returns a copy of an explain request with its secrets masked
+func (p *ScrubbingProvider) scrubExplain(ctx context.Context, req ExplainRequest) ExplainRequest {
+	req.Command = p.mask(ctx, sourceCommand, req.Command)
+	req.Reference = p.mask(ctx, sourceReference, req.Reference)
+	return req
+}
+
+// ExplainCommand explains a command with its secrets masked
+func (p *ScrubbingProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	explanation, err := p.provider.ExplainCommand(ctx, p.scrubExplain(ctx, req))
+	return p.scrubber.Restore(explanation), err
+}
+
+// ExplainCommandStream streams an explanation if the wrapped provider
+// supports streaming. The streamed chunks keep the placeholders.
+func (p *ScrubbingProvider) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	explanation, err := explainStream(ctx, p.provider, p.scrubExplain(ctx, req), callback)
+	return p.scrubber.Restore(explanation), err
+}
+
+// ReviewCommand reviews a command with its secrets masked, if the wrapped
+// provider supports reviews
+func (p *ScrubbingProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	req.Command = p.mask(ctx, sourceCommand, req.Command)
+	review, err := reviewCommand(ctx, p.provider, req)
+	if review == nil {
+		return nil, err
+	}
+	restored := *review
+	restored.Issues = p.restoreAll(review.Issues)
+	restored.Commands = p.restoreAll(review.Commands)
+	restored.Explanation = p.scrubber.Restore(review.Explanation)
+	return &restored, err
+}
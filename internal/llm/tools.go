@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/Hermithic/aiask/internal/probe"
+)
+
+// toolRules tells the model how to use the probing tools
+const toolRules = `
+
+You can call read-only tools to inspect the user's system before answering, e.g. to check whether a program is installed, read a program's --help output or look at the files in the working directory. Only probe when the result can change the command; then give your answer.`
+
+// ToolProvider is an optional interface for providers that let the model call
+// read-only probing tools before answering
+type ToolProvider interface {
+	Provider
+	// GenerateCommandWithTools generates a shell command, letting the model
+	// call the tools in the toolbox for up to tools.MaxRounds rounds first
+	GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error)
+}
+
+// SupportsTools checks if a provider supports probing tools
+func SupportsTools(p Provider) bool {
+	return supports(p, func(p Provider) bool {
+		_, ok := p.(ToolProvider)
+		return ok
+	})
+}
+
+// generateWithTools generates a command with the toolbox if the provider
+// supports tools, or without it otherwise
+func generateWithTools(ctx context.Context, p Provider, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	if tp, ok := p.(ToolProvider); ok {
+		return tp.GenerateCommandWithTools(ctx, req, tools)
+	}
+	return p.GenerateCommand(ctx, req)
+}
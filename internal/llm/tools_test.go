@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/probe"
+	"github.com/Hermithic/aiask/internal/shell"
+)
+
+// rewriteTransport sends all requests to a test server
+type rewriteTransport struct{ target *url.URL }
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOpenAICompatibleTools(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, ok := body["tools"]; ok {
+			fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"which","arguments":"{\"name\":\"surely-not-installed-xyz\"}"}}]}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"2","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{\"commands\":[\"apt install xyz\"]}"}}]}`)
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(&config.Config{
+		Provider: config.ProviderOpenAICompatible,
+		Model:    "local",
+		BaseURL:  server.URL,
+		Retry:    &config.RetryConfig{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+
+	// The model keeps calling tools, so the last round is sent without them
+	tools := probe.New(probe.Policy{}, 2)
+	result, err := provider.(ToolProvider).GenerateCommandWithTools(context.Background(), GenerateRequest{Prompt: "install xyz", ShellInfo: shell.ShellInfo{Shell: shell.ShellBash}}, tools)
+	if err != nil {
+		t.Fatalf("GenerateCommandWithTools returned error: %v", err)
+	}
+	if result.Command() != "apt install xyz" {
+		t.Errorf("command = %q", result.Command())
+	}
+	if len(requests) != 3 || len(tools.Calls) != 2 {
+		t.Fatalf("%d requests and %d tool calls, expected 3 and 2", len(requests), len(tools.Calls))
+	}
+	messages, _ := json.Marshal(requests[2]["messages"])
+	if !strings.Contains(string(messages), `"tool_call_id":"call_1"`) || !strings.Contains(string(messages), "not found") {
+		t.Errorf("tool result not sent back: %s", messages)
+	}
+}
+
+func TestAnthropicTools(t *testing.T) {
+	var choices []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ToolChoice struct {
+				Type string `json:"type"`
+			} `json:"tool_choice"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		choices = append(choices, body.ToolChoice.Type)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(choices) == 1 {
+			fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude","stop_reason":"tool_use","content":[{"type":"tool_use","id":"tu_1","name":"which","input":{"name":"surely-not-installed-xyz"}}],"usage":{"input_tokens":10,"output_tokens":5}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"msg_2","type":"message","role":"assistant","model":"claude","stop_reason":"tool_use","content":[{"type":"tool_use","id":"tu_2","name":"submit_command","input":{"commands":["brew install xyz"]}}],"usage":{"input_tokens":20,"output_tokens":5}}`)
+	}))
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	provider, err := NewAnthropic("key", "claude", "", &http.Client{Transport: rewriteTransport{target}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, usage := WithUsage(context.Background())
+	tools := probe.New(probe.Policy{}, 1)
+	result, err := provider.GenerateCommandWithTools(ctx, GenerateRequest{Prompt: "install xyz", ShellInfo: shell.ShellInfo{Shell: shell.ShellZsh}}, tools)
+	if err != nil {
+		t.Fatalf("GenerateCommandWithTools returned error: %v", err)
+	}
+	if result.Command() != "brew install xyz" {
+		t.Errorf("command = %q", result.Command())
+	}
+	// After the last probing round only the submit tool is allowed
+	if strings.Join(choices, ",") != "any,tool" {
+		t.Errorf("tool choices = %v", choices)
+	}
+	if in, out := usage.Tokens(); in != 30 || out != 10 {
+		t.Errorf("usage = %d/%d, expected 30/10", in, out)
+	}
+}
@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/probe"
+	"github.com/Hermithic/aiask/internal/trace"
+)
+
+// exchange collects what a provider sent and received during one traced call
+type exchange struct {
+	mu           sync.Mutex
+	systemPrompt string
+	response     string
+	inputTokens  int64
+	outputTokens int64
+}
+
+// exchangeKey is the context key of the exchange of a traced call
+type exchangeKey struct{}
+
+// withExchange returns a context that collects the exchange of a provider call
+func withExchange(ctx context.Context) (context.Context, *exchange) {
+	ex := &exchange{}
+	return context.WithValue(ctx, exchangeKey{}, ex), ex
+}
+
+// traceRequest records the system prompt a provider sends, if the call is traced
+func traceRequest(ctx context.Context, systemPrompt string) {
+	if ex, ok := ctx.Value(exchangeKey{}).(*exchange); ok {
+		ex.mu.Lock()
+		ex.systemPrompt = systemPrompt
+		ex.mu.Unlock()
+	}
+}
+
+// traceResponse records the raw text of a model's answer, if the call is
+// traced, and returns it
+func traceResponse(ctx context.Context, response string) string {
+	if ex, ok := ctx.Value(exchangeKey{}).(*exchange); ok {
+		ex.mu.Lock()
+		ex.response = response
+		ex.mu.Unlock()
+	}
+	return response
+}
+
+// traceUsage adds token counts to the exchange of the context, if any
+func traceUsage(ctx context.Context, input, output int64) {
+	if ex, ok := ctx.Value(exchangeKey{}).(*exchange); ok {
+		ex.mu.Lock()
+		ex.inputTokens += input
+		ex.outputTokens += output
+		ex.mu.Unlock()
+	}
+}
+
+// TracingProvider wraps a provider and appends each generate and explain
+// call to a trace file: the prompts and context sent, the raw response, the
+// parsed commands, timings and token usage, with secrets redacted. Reviews
+// are passed through untraced.
+type TracingProvider struct {
+	provider Provider
+	cfg      *config.Config
+	writer   *trace.Writer
+}
+
+// NewTracingProvider wraps a provider, tracing its calls to the file in
+// cfg.Trace. The API keys in the config are redacted from the trace.
+func NewTracingProvider(provider Provider, cfg *config.Config) *TracingProvider {
+	secrets := []string{cfg.APIKey}
+	for _, fb := range cfg.Fallbacks {
+		secrets = append(secrets, fb.APIKey)
+	}
+	return &TracingProvider{provider: provider, cfg: cfg, writer: trace.NewWriter(cfg.Trace, secrets...)}
+}
+
+// Close releases resources held by the wrapped provider
+func (p *TracingProvider) Close() error {
+	return CloseProvider(p.provider)
+}
+
+// Unwrap returns the wrapped provider
+func (p *TracingProvider) Unwrap() Provider {
+	return p.provider
+}
+
+// AnsweredBy returns the provider and model that answered the last request
+func (p *TracingProvider) AnsweredBy() (config.Provider, string) {
+	return AnsweredBy(p.provider, p.cfg)
+}
+
+// write completes an entry with what the exchange collected and appends it
+func (p *TracingProvider) write(e trace.Entry, ex *exchange, start time.Time, err error) {
+	name, model := AnsweredBy(p.provider, p.cfg)
+	e.Time, e.Provider, e.Model = start, string(name), model
+	e.DurationMs = time.Since(start).Milliseconds()
+	ex.mu.Lock()
+	e.SystemPrompt, e.Response = ex.systemPrompt, ex.response
+	e.InputTokens, e.OutputTokens = ex.inputTokens, ex.outputTokens
+	ex.mu.Unlock()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	// Tracing is best effort; the file was checked when the config was loaded
+	_ = p.writer.Write(e)
+}
+
+// generateEntry starts the entry of a generate request
+func generateEntry(req GenerateRequest) trace.Entry {
+	e := trace.Entry{Kind: trace.KindGenerate, Prompt: req.Prompt}
+	if req.Failed != nil {
+		e.Kind = trace.KindRecovery
+		e.Failure = &trace.Failure{Command: req.Failed.Command, Error: req.Failed.Error}
+	}
+	return e
+}
+
+// generate traces a generate call, with how the context fit the budget when
+// the provider built the system prompt
+func (p *TracingProvider) generate(ctx context.Context, req GenerateRequest, e *trace.Entry, start time.Time, call func(ctx context.Context, req GenerateRequest) (*CommandResult, error)) (*CommandResult, error) {
+	ctx, ex := withExchange(ctx)
+	var plan *ContextPlan
+	req.planned = func(p *ContextPlan) {
+		plan = p
+	}
+	result, err := call(ctx, req)
+	if plan != nil {
+		for i, fit := range plan.Fits {
+			section := trace.Section{Name: fit.Name, Tokens: fit.Tokens, Kept: fit.Kept, Dropped: fit.Dropped}
+			if !plan.Parts[i].Required {
+				section.Text = plan.Parts[i].Text
+			}
+			e.Context = append(e.Context, section)
+		}
+	}
+	if result != nil {
+		e.Commands = result.Commands
+	}
+	p.write(*e, ex, start, err)
+	return result, err
+}
+
+// streamTimer wraps a stream callback to note when the first chunk arrives
+func streamTimer(e *trace.Entry, start time.Time, callback func(chunk string)) func(chunk string) {
+	return func(chunk string) {
+		if e.FirstChunkMs == 0 {
+			e.FirstChunkMs = max(time.Since(start).Milliseconds(), 1)
+		}
+		callback(chunk)
+	}
+}
+
+// GenerateCommand generates a command and traces the call
+func (p *TracingProvider) GenerateCommand(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+	e := generateEntry(req)
+	return p.generate(ctx, req, &e, time.Now(), p.provider.GenerateCommand)
+}
+
+// GenerateCommandStream streams a command if the wrapped provider supports
+// streaming, and traces the call
+func (p *TracingProvider) GenerateCommandStream(ctx context.Context, req GenerateRequest, callback func(chunk string)) (*CommandResult, error) {
+	e := generateEntry(req)
+	e.Stream = true
+	start := time.Now()
+	timed := streamTimer(&e, start, callback)
+	return p.generate(ctx, req, &e, start, func(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+		if sp, ok := p.provider.(StreamingProvider); ok {
+			return sp.GenerateCommandStream(ctx, req, timed)
+		}
+		result, err := p.provider.GenerateCommand(ctx, req)
+		if err == nil {
+			timed(result.Command())
+		}
+		return result, err
+	})
+}
+
+// GenerateCommandWithTools generates a command with probing tools if the
+// wrapped provider supports them, and traces the call
+func (p *TracingProvider) GenerateCommandWithTools(ctx context.Context, req GenerateRequest, tools *probe.Toolbox) (*CommandResult, error) {
+	e := generateEntry(req)
+	e.Tools = SupportsTools(p.provider)
+	return p.generate(ctx, req, &e, time.Now(), func(ctx context.Context, req GenerateRequest) (*CommandResult, error) {
+		return generateWithTools(ctx, p.provider, req, tools)
+	})
+}
+
+// explainEntry starts the entry of an explain request, with the reference
+// documentation sent along
+func explainEntry(req ExplainRequest) trace.Entry {
+	e := trace.Entry{Kind: trace.KindExplain, Prompt: strings.TrimSpace(req.Command)}
+	if req.Reference != "" {
+		tokens := EstimateTokens(req.Reference)
+		e.Context = []trace.Section{{Name: "reference", Tokens: tokens, Kept: tokens, Text: req.Reference}}
+	}
+	return e
+}
+
+// ExplainCommand explains a command and traces the call
+func (p *TracingProvider) ExplainCommand(ctx context.Context, req ExplainRequest) (string, error) {
+	ctx, ex := withExchange(ctx)
+	start := time.Now()
+	explanation, err := p.provider.ExplainCommand(ctx, req)
+	p.write(explainEntry(req), ex, start, err)
+	return explanation, err
+}
+
+// ExplainCommandStream streams an explanation if the wrapped provider
+// supports streaming, and traces the call
+func (p *TracingProvider) ExplainCommandStream(ctx context.Context, req ExplainRequest, callback func(chunk string)) (string, error) {
+	ctx, ex := withExchange(ctx)
+	e := explainEntry(req)
+	e.Stream = true
+	start := time.Now()
+	explanation, err := explainStream(ctx, p.provider, req, streamTimer(&e, start, callback))
+	p.write(e, ex, start, err)
+	return explanation, err
+}
+
+// ReviewCommand reviews a command if the wrapped provider supports reviews
+func (p *TracingProvider) ReviewCommand(ctx context.Context, req ReviewRequest) (*Review, error) {
+	return reviewCommand(ctx, p.provider, req)
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/scrub"
+	"github.com/Hermithic/aiask/internal/shell"
+	"github.com/Hermithic/aiask/internal/trace"
+)
+
+// readTrace returns the entries of a trace file
+func readTrace(t *testing.T, path string) []trace.Entry {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []trace.Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e trace.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid trace line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestTracingProvider(t *testing.T) {
+	const apiKey = "test-key-0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"local\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", "ls -la")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		content := `{"commands":["pwd"]}`
+		if strings.Contains(string(body), `"content":"pwd"`) {
+			content = "Prints the directory"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"1","object":"chat.completion","model":"local","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":%q}}],"usage":{"prompt_tokens":50,"completion_tokens":5,"total_tokens":55}}`, content)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	provider, err := NewProvider(&config.Config{
+		Provider: config.ProviderOpenAICompatible,
+		APIKey:   apiKey,
+		Model:    "local",
+		BaseURL:  server.URL,
+		Retry:    &config.RetryConfig{MaxAttempts: 1},
+		Trace:    path,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider returned error: %v", err)
+	}
+
+	ctx := context.Background()
+	bash := shell.ShellInfo{Shell: shell.ShellBash}
+	if _, err := provider.GenerateCommand(ctx, GenerateRequest{Prompt: "where am i, my key is " + apiKey, ShellInfo: bash}); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	failed := &FailedCommand{Command: "cd /nope", Error: "no such file or directory"}
+	if _, err := provider.GenerateCommand(ctx, GenerateRequest{Prompt: "go to nope", ShellInfo: bash, Failed: failed}); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if _, err := provider.(StreamingProvider).GenerateCommandStream(ctx, GenerateRequest{Prompt: "list files", ShellInfo: bash}, func(string) {}); err != nil {
+		t.Fatalf("GenerateCommandStream returned error: %v", err)
+	}
+	if _, err := provider.ExplainCommand(ctx, ExplainRequest{Command: "pwd"}); err != nil {
+		t.Fatalf("ExplainCommand returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), apiKey) {
+		t.Errorf("trace contains the API key:\n%s", data)
+	}
+
+	entries := readTrace(t, path)
+	if len(entries) != 4 {
+		t.Fatalf("got %d trace entries, expected 4", len(entries))
+	}
+	generate, recovery, stream, explain := entries[0], entries[1], entries[2], entries[3]
+
+	if generate.Kind != trace.KindGenerate || generate.Provider != string(config.ProviderOpenAICompatible) || generate.Model != "local" {
+		t.Errorf("generate entry = %s from %s/%s", generate.Kind, generate.Provider, generate.Model)
+	}
+	if !strings.Contains(generate.SystemPrompt, "Current shell: Bash") || generate.Response != `{"commands":["pwd"]}` {
+		t.Errorf("generate entry has system prompt %q and response %q", generate.SystemPrompt, generate.Response)
+	}
+	if generate.Prompt != "where am i, my key is "+scrub.Redacted {
+		t.Errorf("prompt = %q", generate.Prompt)
+	}
+	if len(generate.Commands) != 1 || generate.Commands[0] != "pwd" || generate.InputTokens != 50 || generate.OutputTokens != 5 {
+		t.Errorf("generate entry has commands %q and tokens %d/%d", generate.Commands, generate.InputTokens, generate.OutputTokens)
+	}
+	if len(generate.Context) == 0 || generate.Context[0].Name != PartSystemPrompt {
+		t.Errorf("generate entry context = %+v", generate.Context)
+	}
+
+	if recovery.Kind != trace.KindRecovery || recovery.Failure == nil || recovery.Failure.Command != "cd /nope" {
+		t.Errorf("recovery entry = %s with failure %+v", recovery.Kind, recovery.Failure)
+	}
+	if !stream.Stream || stream.Response != "ls -la" || stream.FirstChunkMs == 0 {
+		t.Errorf("stream entry: stream %v, response %q, first chunk after %dms", stream.Stream, stream.Response, stream.FirstChunkMs)
+	}
+	if explain.Kind != trace.KindExplain || explain.Prompt != "pwd" || explain.Response != "Prints the directory" {
+		t.Errorf("explain entry = %s of %q: %q", explain.Kind, explain.Prompt, explain.Response)
+	}
+}
+
+func TestTracingProviderError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	provider := NewTracingProvider(&fakeProvider{err: fmt.Errorf("request failed")}, &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o", Trace: path})
+
+	if _, err := provider.GenerateCommand(context.Background(), GenerateRequest{Prompt: "list files"}); err == nil {
+		t.Fatal("GenerateCommand succeeded")
+	}
+	entries := readTrace(t, path)
+	if len(entries) != 1 || entries[0].Error != "request failed" || entries[0].Commands != nil {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+func TestWrapperCapabilities(t *testing.T) {
+	cfg := &config.Config{Provider: config.ProviderOpenAI, Model: "gpt-4o", Trace: filepath.Join(t.TempDir(), "trace.jsonl")}
+	wrap := func(inner Provider) Provider {
+		scrubbing, err := NewScrubbingProvider(NewTracingProvider(inner, cfg), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return scrubbing
+	}
+
+	// The wrappers only claim what the provider they wrap can do
+	plain := wrap(&capturingProvider{})
+	if SupportsStreaming(plain) || SupportsExplainStreaming(plain) || SupportsTools(plain) || SupportsReview(plain) {
+		t.Error("wrapped provider without optional interfaces reports support for them")
+	}
+	full, err := NewOpenAICompatible("key", "http://localhost", "gpt-4o", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := wrap(full)
+	if !SupportsStreaming(wrapped) || !SupportsExplainStreaming(wrapped) || !SupportsTools(wrapped) || !SupportsReview(wrapped) {
+		t.Error("wrapped provider doesn't report the optional interfaces it has")
+	}
+}
@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/usage"
+)
+
+// Usage collects the token usage reported by providers during a request
+type Usage struct {
+	mu           sync.Mutex
+	InputTokens  int64
+	OutputTokens int64
+}
+
+// Tokens returns the input and output token counts collected so far
+func (u *Usage) Tokens() (input, output int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.InputTokens, u.OutputTokens
+}
+
+// usageKey is the context key of the usage collector
+type usageKey struct{}
+
+// WithUsage returns a context that collects the token usage of provider calls made with it
+func WithUsage(ctx context.Context) (context.Context, *Usage) {
+	usage := &Usage{}
+	return context.WithValue(ctx, usageKey{}, usage), usage
+}
+
+// reportUsage adds token counts to the usage collector of the context, if
+// any, and to the exchange of a traced call
+func reportUsage(ctx context.Context, input, output int64) {
+	traceUsage(ctx, input, output)
+	usage, ok := ctx.Value(usageKey{}).(*Usage)
+	if !ok {
+		return
+	}
+	usage.mu.Lock()
+	usage.InputTokens += input
+	usage.OutputTokens += output
+	usage.mu.Unlock()
+}
+
+// RecordUsage appends a completed call to the usage log under the provider
+// and model that answered it. Responses served from the cache cost nothing
+// and are not recorded.
+func RecordUsage(callType string, provider Provider, cfg *config.Config, tokens *Usage, latency time.Duration) error {
+	if cp, ok := provider.(*CachingProvider); ok && cp.CacheHit() {
+		return nil
+	}
+	name, model := AnsweredBy(provider, cfg)
+	return AppendUsage(callType, name, model, tokens, latency)
+}
+
+// AppendUsage appends a call answered by the given provider and model to the
+// usage log
+func AppendUsage(callType string, name config.Provider, model string, tokens *Usage, latency time.Duration) error {
+	input, output := tokens.Tokens()
+	return usage.Append(usage.Record{
+		Type:         callType,
+		Provider:     string(name),
+		Model:        model,
+		InputTokens:  input,
+		OutputTokens: output,
+		LatencyMs:    latency.Milliseconds(),
+	})
+}
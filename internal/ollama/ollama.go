@@ -0,0 +1,301 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the address of a local Ollama server
+const DefaultURL = "http://localhost:11434"
+
+// Message is a chat message
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Options are model parameters sent with a chat request
+type Options struct {
+	NumCtx int `json:"num_ctx,omitempty"` // Context window size in tokens
+}
+
+// ChatRequest is a request to the /api/chat endpoint
+type ChatRequest struct {
+	Model     string      `json:"model"`
+	Messages  []Message   `json:"messages"`
+	Stream    bool        `json:"stream"`
+	Format    string      `json:"format,omitempty"`     // "json" constrains the answer to a JSON object
+	Options   *Options    `json:"options,omitempty"`    // Model parameters such as num_ctx
+	KeepAlive interface{} `json:"keep_alive,omitempty"` // How long the model stays loaded; see KeepAlive
+}
+
+// ChatResponse is a response, or a streamed chunk of a response, from /api/chat
+type ChatResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int64   `json:"prompt_eval_count"` // Input tokens, set on the final chunk
+	EvalCount       int64   `json:"eval_count"`        // Output tokens, set on the final chunk
+	Error           string  `json:"error,omitempty"`
+}
+
+// Model is a locally installed model
+type Model struct {
+	Name       string       `json:"name"`
+	Size       int64        `json:"size"`
+	ModifiedAt time.Time    `json:"modified_at"`
+	Details    ModelDetails `json:"details"`
+}
+
+// ModelDetails describes a model's family, size and quantization
+type ModelDetails struct {
+	Family            string `json:"family"`
+	ParameterSize     string `json:"parameter_size"`
+	QuantizationLevel string `json:"quantization_level"`
+}
+
+// ShowResponse describes an installed model in more detail
+type ShowResponse struct {
+	Details   ModelDetails           `json:"details"`
+	ModelInfo map[string]interface{} `json:"model_info"` // Architecture parameters, e.g. "llama.context_length"
+}
+
+// ContextLength returns the context window the model supports, or 0 if unknown
+func (s *ShowResponse) ContextLength() int {
+	for key, value := range s.ModelInfo {
+		if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// PullProgress is a progress update while pulling a model
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// StatusError is an error response from the Ollama server
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ollama: unexpected status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("ollama: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// Client talks to the native Ollama API
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New creates a client for the Ollama server at baseURL, using the default
+// URL if it is empty and http.DefaultClient if httpClient is nil
+func New(baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: httpClient}
+}
+
+// KeepAlive converts a configured keep_alive value for a request. Plain
+// numbers are seconds (-1 keeps the model loaded); anything else is passed
+// as a duration string such as "10m".
+func KeepAlive(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds
+	}
+	return value
+}
+
+// Chat sends a chat request and returns the complete response
+func (c *Client) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	req.Stream = false
+	resp, err := c.do(ctx, http.MethodPost, "/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chat ChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chat); err != nil {
+		return nil, fmt.Errorf("failed to parse chat response: %w", err)
+	}
+	return &chat, nil
+}
+
+// ChatStream sends a chat request and calls fn with each streamed chunk. It
+// returns the final chunk, which carries the token counts.
+func (c *Client) ChatStream(ctx context.Context, req ChatRequest, fn func(ChatResponse)) (*ChatResponse, error) {
+	req.Stream = true
+	resp, err := c.do(ctx, http.MethodPost, "/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var last ChatResponse
+	err = readLines(resp.Body, func(line []byte) error {
+		var chunk ChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to parse chat response: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		fn(chunk)
+		last = chunk
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &last, nil
+}
+
+// List returns the locally installed models
+func (c *Client) List(ctx context.Context) ([]Model, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []Model `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %w", err)
+	}
+	return tags.Models, nil
+}
+
+// Show returns the details of an installed model
+func (c *Client) Show(ctx context.Context, model string) (*ShowResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/api/show", map[string]string{"model": model})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var show ShowResponse
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return nil, fmt.Errorf("failed to parse model details: %w", err)
+	}
+	return &show, nil
+}
+
+// Pull downloads a model, calling fn with each progress update
+func (c *Client) Pull(ctx context.Context, model string, fn func(PullProgress)) error {
+	resp, err := c.do(ctx, http.MethodPost, "/api/pull", map[string]interface{}{"model": model, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readLines(resp.Body, func(line []byte) error {
+		var progress PullProgress
+		if err := json.Unmarshal(line, &progress); err != nil {
+			return fmt.Errorf("failed to parse pull progress: %w", err)
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", model, progress.Error)
+		}
+		fn(progress)
+		return nil
+	})
+}
+
+// HasModel reports whether name is among the models, treating a name
+// without a tag as ":latest"
+func HasModel(models []Model, name string) bool {
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	for _, m := range models {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// do sends a request with an optional JSON body and returns the response if
+// it succeeded
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		statusErr := &StatusError{StatusCode: resp.StatusCode}
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); json.Unmarshal(data, &apiErr) == nil {
+			statusErr.Message = apiErr.Error
+		}
+		return nil, statusErr
+	}
+	return resp, nil
+}
+
+// readLines calls fn for each non-empty line of a newline-delimited JSON stream
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read response stream: %w", err)
+	}
+	return nil
+}
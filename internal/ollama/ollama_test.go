@@ -0,0 +1,179 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubServer fakes the parts of the Ollama API used by the client
+func stubServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"models":[{"name":"llama3.2:latest","size":2019393189,"details":{"family":"llama","parameter_size":"3.2B","quantization_level":"Q4_K_M"}},{"name":"qwen2.5-coder:7b","size":4683087332}]}`)
+	})
+	mux.HandleFunc("/api/show", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"details":{"family":"llama"},"model_info":{"general.architecture":"llama","llama.context_length":131072,"llama.embedding_length":3072}}`)
+	})
+	mux.HandleFunc("/api/pull", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model == "missing" {
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"error":"pull model manifest: file does not exist"}`)
+			return
+		}
+		fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+		fmt.Fprintln(w, `{"status":"pulling abc","digest":"sha256:abc","total":100,"completed":50}`)
+		fmt.Fprintln(w, `{"status":"pulling abc","digest":"sha256:abc","total":100,"completed":100}`)
+		fmt.Fprintln(w, `{"status":"success"}`)
+	})
+	mux.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model == "unknown" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"model \"unknown\" not found, try pulling it first"}`)
+			return
+		}
+		// Echo the options back so the test can check what was sent
+		reply, _ := json.Marshal(map[string]interface{}{"num_ctx": req.Options.NumCtx, "keep_alive": req.KeepAlive, "format": req.Format})
+		if req.Stream {
+			fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":%q},\"done\":false}\n", reply[:10])
+			fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":%q},\"done\":false}\n", reply[10:])
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":12,"eval_count":7}`)
+			return
+		}
+		fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":%q},\"done\":true,\"prompt_eval_count\":12,\"eval_count\":7}", reply)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestList(t *testing.T) {
+	client := New(stubServer(t).URL+"/", nil)
+
+	models, err := client.List(context.Background())
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(models) != 2 || models[0].Details.ParameterSize != "3.2B" {
+		t.Fatalf("List returned %+v", models)
+	}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"llama3.2", true},
+		{"llama3.2:latest", true},
+		{"qwen2.5-coder:7b", true},
+		{"qwen2.5-coder", false},
+		{"mistral", false},
+	}
+	for _, tt := range tests {
+		if got := HasModel(models, tt.name); got != tt.expected {
+			t.Errorf("HasModel(%q) = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestShow(t *testing.T) {
+	client := New(stubServer(t).URL, nil)
+	show, err := client.Show(context.Background(), "llama3.2")
+	if err != nil {
+		t.Fatalf("Show returned error: %v", err)
+	}
+	if show.Details.Family != "llama" || show.ContextLength() != 131072 {
+		t.Errorf("Show returned %+v, context length %d", show, show.ContextLength())
+	}
+}
+
+func TestPull(t *testing.T) {
+	client := New(stubServer(t).URL, nil)
+
+	var updates []PullProgress
+	if err := client.Pull(context.Background(), "llama3.2", func(p PullProgress) { updates = append(updates, p) }); err != nil {
+		t.Fatalf("Pull returned error: %v", err)
+	}
+	if len(updates) != 4 || updates[2].Completed != 100 || updates[3].Status != "success" {
+		t.Errorf("Pull reported %+v", updates)
+	}
+
+	if err := client.Pull(context.Background(), "missing", func(PullProgress) {}); err == nil {
+		t.Error("Pull of a missing model returned no error")
+	}
+}
+
+func TestChat(t *testing.T) {
+	client := New(stubServer(t).URL, nil)
+	req := ChatRequest{
+		Model:     "llama3.2",
+		Messages:  []Message{{Role: "user", Content: "hi"}},
+		Format:    "json",
+		Options:   &Options{NumCtx: 8192},
+		KeepAlive: KeepAlive("-1"),
+	}
+	expected := `{"format":"json","keep_alive":-1,"num_ctx":8192}`
+
+	resp, err := client.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Chat returned error: %v", err)
+	}
+	if resp.Message.Content != expected {
+		t.Errorf("Chat sent %s, expected %s", resp.Message.Content, expected)
+	}
+	if resp.PromptEvalCount != 12 || resp.EvalCount != 7 {
+		t.Errorf("token counts = %d/%d, expected 12/7", resp.PromptEvalCount, resp.EvalCount)
+	}
+
+	var streamed string
+	final, err := client.ChatStream(context.Background(), req, func(chunk ChatResponse) { streamed += chunk.Message.Content })
+	if err != nil {
+		t.Fatalf("ChatStream returned error: %v", err)
+	}
+	if streamed != expected {
+		t.Errorf("ChatStream streamed %s, expected %s", streamed, expected)
+	}
+	if !final.Done || final.EvalCount != 7 {
+		t.Errorf("final chunk = %+v", final)
+	}
+}
+
+func TestChatError(t *testing.T) {
+	client := New(stubServer(t).URL, nil)
+
+	_, err := client.Chat(context.Background(), ChatRequest{Model: "unknown"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Chat returned %v, expected a StatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusNotFound || statusErr.Message == "" {
+		t.Errorf("StatusError = %+v", statusErr)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"", nil},
+		{"-1", -1},
+		{"300", 300},
+		{"10m", "10m"},
+	}
+	for _, tt := range tests {
+		if got := KeepAlive(tt.value); got != tt.expected {
+			t.Errorf("KeepAlive(%q) = %v, expected %v", tt.value, got, tt.expected)
+		}
+	}
+}
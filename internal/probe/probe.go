@@ -0,0 +1,371 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+// DefaultMaxOutput is the number of bytes of tool output sent to the model
+const DefaultMaxOutput = 4000
+
+// maxEntries is the number of directory entries list_dir returns
+const maxEntries = 100
+
+// commandTimeout bounds how long which, --help and git status may run
+const commandTimeout = 3 * time.Second
+
+// DefaultHelpCommands are the programs whose --help output the model may read
+var DefaultHelpCommands = []string{
+	"apt", "awk", "brew", "cargo", "cat", "chmod", "chown", "cp", "curl", "cut",
+	"df", "dnf", "docker", "du", "ffmpeg", "find", "gh", "git", "go", "grep",
+	"gzip", "head", "helm", "jq", "kubectl", "ln", "ls", "make", "mkdir", "mv",
+	"node", "npm", "pip", "pip3", "podman", "python", "python3", "rg", "rsync",
+	"scp", "sed", "sort", "ssh", "tail", "tar", "tr", "uniq", "unzip", "wc",
+	"wget", "xargs", "yarn", "zip",
+}
+
+// HelpCommands returns the programs whose --help output may be read: the
+// built-in list plus any configured ones
+func HelpCommands(cfg *config.Config) []string {
+	commands := append([]string{}, DefaultHelpCommands...)
+	if cfg.Tools != nil {
+		commands = append(commands, cfg.Tools.HelpCommands...)
+	}
+	return commands
+}
+
+// deniedNames are directories the tools never look into
+var deniedNames = map[string]bool{
+	".ssh":            true,
+	".gnupg":          true,
+	".aws":            true,
+	".password-store": true,
+}
+
+// binaryNameRegex matches the names of programs the tools may look up
+var binaryNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// Policy limits what the tools may access
+type Policy struct {
+	Roots        []string // Directories list_dir and stat may look inside
+	HelpCommands []string // Programs whose --help output may be read
+	MaxOutput    int      // Bytes of output per call (default: DefaultMaxOutput)
+}
+
+// Tool is a read-only probe the model can call before answering
+type Tool struct {
+	Name        string
+	Description string
+	Params      map[string]string // Parameter names and descriptions; all parameters are strings
+	Required    []string
+
+	run func(ctx context.Context, args map[string]string) (string, error)
+}
+
+// Schema returns the JSON schema properties of the tool's parameters
+func (t Tool) Schema() map[string]interface{} {
+	properties := make(map[string]interface{}, len(t.Params))
+	for name, desc := range t.Params {
+		properties[name] = map[string]interface{}{"type": "string", "description": desc}
+	}
+	return properties
+}
+
+// Call is a tool call made by the model
+type Call struct {
+	Tool   string
+	Args   map[string]string
+	Output string
+	Err    error
+}
+
+// Summary describes the call, e.g. "which docker"
+func (c Call) Summary() string {
+	keys := make([]string, 0, len(c.Args))
+	for k := range c.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{c.Tool}
+	for _, k := range keys {
+		parts = append(parts, c.Args[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// Result returns the text sent back to the model
+func (c Call) Result() string {
+	if c.Err != nil {
+		return "error: " + c.Err.Error()
+	}
+	return c.Output
+}
+
+// Toolbox is the set of tools offered to the model
+type Toolbox struct {
+	Tools     []Tool
+	MaxRounds int // Tool-calling rounds before the model must answer
+
+	// OnCall, if set, is called after each tool call, for a visible trace of
+	// what was probed
+	OnCall func(Call)
+
+	// Filter, if set, rewrites the output of each call before it is sent to
+	// the model, e.g. to mask secrets
+	Filter func(output string) string
+
+	// Calls holds the calls made so far
+	Calls []Call
+
+	policy Policy
+}
+
+// New creates a toolbox with the built-in tools, limited by policy
+func New(policy Policy, maxRounds int) *Toolbox {
+	if policy.MaxOutput <= 0 {
+		policy.MaxOutput = DefaultMaxOutput
+	}
+	t := &Toolbox{MaxRounds: maxRounds, policy: policy}
+	t.Tools = []Tool{
+		{
+			Name:        "list_dir",
+			Description: "List the entries of a directory. Directories end with a slash.",
+			Params:      map[string]string{"path": "Directory to list, relative to the working directory"},
+			Required:    []string{"path"},
+			run:         t.listDir,
+		},
+		{
+			Name:        "stat",
+			Description: "Show whether a path exists, its type, size, permissions and modification time.",
+			Params:      map[string]string{"path": "File or directory, relative to the working directory"},
+			Required:    []string{"path"},
+			run:         t.stat,
+		},
+		{
+			Name:        "which",
+			Description: "Find the full path of a program on PATH, to check whether it is installed.",
+			Params:      map[string]string{"name": "Program name, e.g. docker"},
+			Required:    []string{"name"},
+			run:         t.which,
+		},
+		{
+			Name:        "help",
+			Description: "Read the --help output of an installed program to check its options. Only common command-line tools are allowed.",
+			Params:      map[string]string{"name": "Program name, e.g. tar"},
+			Required:    []string{"name"},
+			run:         t.help,
+		},
+		{
+			Name:        "git_status",
+			Description: "Show the branch and the changed files of the git repository in the working directory.",
+			Params:      map[string]string{},
+			run:         t.gitStatus,
+		},
+	}
+	return t
+}
+
+// Run executes a tool call. args is the JSON object of arguments the model
+// sent. Errors are returned in the call so they can be reported to the model.
+func (t *Toolbox) Run(ctx context.Context, name, args string) Call {
+	call := Call{Tool: name, Args: map[string]string{}}
+	if strings.TrimSpace(args) != "" {
+		if err := json.Unmarshal([]byte(args), &call.Args); err != nil {
+			call.Err = fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	if call.Err == nil {
+		call.Err = fmt.Errorf("unknown tool %q", name)
+		for _, tool := range t.Tools {
+			if tool.Name == name {
+				call.Output, call.Err = tool.run(ctx, call.Args)
+				break
+			}
+		}
+	}
+	call.Output = limit(call.Output, t.policy.MaxOutput)
+	if t.Filter != nil {
+		call.Output = t.Filter(call.Output)
+	}
+
+	t.Calls = append(t.Calls, call)
+	if t.OnCall != nil {
+		t.OnCall(call)
+	}
+	return call
+}
+
+// resolve returns the absolute path of a path argument, checking it is inside
+// one of the allowed roots and not in a denied directory
+func (t *Toolbox) resolve(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// Follow symlinks so a link cannot point outside the roots
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	for _, part := range strings.Split(abs, string(filepath.Separator)) {
+		if deniedNames[part] {
+			return "", fmt.Errorf("access to %s is not allowed", path)
+		}
+	}
+	for _, root := range t.policy.Roots {
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return abs, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the allowed directories", path)
+}
+
+// listDir lists the entries of a directory
+func (t *Toolbox) listDir(ctx context.Context, args map[string]string) (string, error) {
+	path, err := t.resolve(args["path"])
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "(empty directory)", nil
+	}
+
+	var b strings.Builder
+	for i, entry := range entries {
+		if i == maxEntries {
+			fmt.Fprintf(&b, "... and %d more\n", len(entries)-maxEntries)
+			break
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		b.WriteString(name + "\n")
+	}
+	return b.String(), nil
+}
+
+// stat describes a file or directory
+func (t *Toolbox) stat(ctx context.Context, args map[string]string) (string, error) {
+	path, err := t.resolve(args["path"])
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "does not exist", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	kind := "file"
+	if info.IsDir() {
+		kind = "directory"
+	}
+	return fmt.Sprintf("%s, %d bytes, mode %s, modified %s", kind, info.Size(), info.Mode().Perm(), info.ModTime().Format(time.RFC3339)), nil
+}
+
+// which finds a program on PATH
+func (t *Toolbox) which(ctx context.Context, args map[string]string) (string, error) {
+	name := args["name"]
+	if !binaryNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid program name %q", name)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "not found", nil
+	}
+	return path, nil
+}
+
+// help returns the --help output of an allowed program
+func (t *Toolbox) help(ctx context.Context, args map[string]string) (string, error) {
+	name := args["name"]
+	if !binaryNameRegex.MatchString(name) || !t.helpAllowed(name) {
+		return "", fmt.Errorf("reading the help of %q is not allowed", name)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s is not installed", name)
+	}
+	// Many programs print their help to stderr or exit with an error status,
+	// so the output is used either way
+	output, _ := t.command(ctx, path, "--help")
+	if strings.TrimSpace(output) == "" {
+		return "", fmt.Errorf("%s --help printed nothing", name)
+	}
+	return output, nil
+}
+
+// helpAllowed reports whether the --help output of a program may be read
+func (t *Toolbox) helpAllowed(name string) bool {
+	for _, allowed := range t.policy.HelpCommands {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// gitStatus returns the short git status of the working directory
+func (t *Toolbox) gitStatus(ctx context.Context, args map[string]string) (string, error) {
+	path, err := exec.LookPath("git")
+	if err != nil {
+		return "", fmt.Errorf("git is not installed")
+	}
+	output, err := t.command(ctx, path, "status", "--short", "--branch")
+	if err != nil {
+		return "", fmt.Errorf("git status failed: %s", strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// command runs a program without input and returns its combined output
+func (t *Toolbox) command(ctx context.Context, path string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// limit truncates output to max bytes
+func limit(output string, max int) string {
+	if len(output) <= max {
+		return output
+	}
+	return output[:max] + "\n... (truncated)"
+}
@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToolboxPaths(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tb := New(Policy{Roots: []string{root}}, 3)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    string
+		output  string // Expected substring of the output
+		wantErr bool
+	}{
+		{"list root", "list_dir", `{"path": "` + root + `"}`, "src/\n", false},
+		{"stat file", "stat", `{"path": "` + filepath.Join(root, "go.mod") + `"}`, "file, 9 bytes", false},
+		{"stat missing", "stat", `{"path": "` + filepath.Join(root, "nope") + `"}`, "does not exist", false},
+		{"outside roots", "list_dir", `{"path": "` + outside + `"}`, "", true},
+		{"parent escape", "list_dir", `{"path": "` + filepath.Join(root, "..") + `"}`, "", true},
+		{"denied directory", "list_dir", `{"path": "` + filepath.Join(root, ".ssh") + `"}`, "", true},
+		{"unknown tool", "rm", `{"path": "` + root + `"}`, "", true},
+		{"bad arguments", "stat", `not json`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := tb.Run(ctx, tt.tool, tt.args)
+			if (call.Err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", call.Err, tt.wantErr)
+			}
+			if !strings.Contains(call.Output, tt.output) {
+				t.Errorf("output = %q, expected it to contain %q", call.Output, tt.output)
+			}
+		})
+	}
+	if len(tb.Calls) != len(tests) {
+		t.Errorf("recorded %d calls, expected %d", len(tb.Calls), len(tests))
+	}
+}
+
+func TestToolboxPrograms(t *testing.T) {
+	tb := New(Policy{HelpCommands: []string{"go"}, MaxOutput: 50}, 3)
+	ctx := context.Background()
+
+	if call := tb.Run(ctx, "which", `{"name": "go; rm -rf /"}`); call.Err == nil {
+		t.Error("which accepted a name with shell syntax")
+	}
+	if call := tb.Run(ctx, "which", `{"name": "surely-not-installed-xyz"}`); call.Output != "not found" {
+		t.Errorf("which output = %q, expected %q", call.Output, "not found")
+	}
+	if call := tb.Run(ctx, "help", `{"name": "sh"}`); call.Err == nil {
+		t.Error("help ran a program that is not allowed")
+	}
+
+	call := tb.Run(ctx, "help", `{"name": "go"}`)
+	if call.Err != nil {
+		t.Skipf("go --help unavailable: %v", call.Err)
+	}
+	if !strings.HasSuffix(call.Output, "(truncated)") {
+		t.Errorf("help output not limited: %q", call.Output)
+	}
+}
+
+func TestCallSummary(t *testing.T) {
+	call := Call{Tool: "which", Args: map[string]string{"name": "docker"}}
+	if call.Summary() != "which docker" {
+		t.Errorf("Summary() = %q", call.Summary())
+	}
+}
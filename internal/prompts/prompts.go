@@ -0,0 +1,256 @@
+// Package prompts renders the system prompts sent to the providers from Go
+// text/template files. The built-in templates are embedded in the binary, and
+// each one can be overridden by a file of the same name in ~/.aiask/prompts/.
+package prompts
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/fileutil"
+)
+
+// Tasks with a prompt template
+const (
+	TaskGenerate = "generate"
+	TaskExplain  = "explain"
+	TaskRecovery = "recovery"
+)
+
+// Tasks lists the tasks with a prompt template
+var Tasks = []string{TaskGenerate, TaskExplain, TaskRecovery}
+
+//go:embed defaults/*.tmpl
+var defaults embed.FS
+
+// Data is the data the prompt templates are executed with. Fields that don't
+// apply to a task, or weren't relevant to the request, are empty.
+type Data struct {
+	Shell     string   // Display name of the shell, e.g. "Bash"
+	OS        string   // Display name of the operating system, e.g. "macOS"
+	CWD       string   // Current directory
+	Git       Git      // Repository the current directory is in
+	Project   []string // Project types detected in the current directory, e.g. "Go", "Node.js"
+	Directory string   // Listing of the current directory, for file-related requests
+	Rules     string   // Response format rules the provider parses answers with
+	Suffix    string   // system_prompt_suffix from the config, or --system-suffix
+	Failure   Failure  // The command to fix, for the recovery task
+}
+
+// Git describes the repository the current directory is in
+type Git struct {
+	IsRepo        bool
+	Branch        string
+	Dirty         bool   // Whether there are uncommitted changes
+	Status        string // Status summary, for git-related requests
+	RecentCommits string // Last commits, one per line, for git-related requests
+}
+
+// Failure describes a command that failed
+type Failure struct {
+	Command string
+	Error   string
+}
+
+// funcs are the functions available in prompt templates
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// Valid reports whether a task has a prompt template
+func Valid(task string) bool {
+	for _, t := range Tasks {
+		if t == task {
+			return true
+		}
+	}
+	return false
+}
+
+// Dir returns the directory of the user's prompt templates
+func Dir() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "prompts"), nil
+}
+
+// Path returns the path of the user's template for a task
+func Path(task string) (string, error) {
+	if !Valid(task) {
+		return "", fmt.Errorf("unknown prompt %q (valid prompts: %s)", task, strings.Join(Tasks, ", "))
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, task+".tmpl"), nil
+}
+
+// Default returns the built-in template of a task
+func Default(task string) string {
+	data, err := defaults.ReadFile("defaults/" + task + ".tmpl")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Source returns the template used for a task: the user's override if there
+// is one, or the built-in template. It also returns the path of the override.
+func Source(task string) (source, path string, err error) {
+	path, err = Path(task)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Default(task), "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read prompt template: %w", err)
+	}
+	return string(data), path, nil
+}
+
+// parse parses the template of a task into a set with the templates of the
+// other tasks, so a template can include another, e.g. {{template "generate" .}}.
+// With overrides, the task's own override is used and its errors are
+// returned; another task's override is only used if it parses, so a broken
+// file only breaks the task it overrides. Without overrides, only the
+// built-in templates are used. It also returns the path of the task's
+// override, for error messages.
+func parse(task string, overrides bool) (*template.Template, string, error) {
+	set := template.New("").Funcs(funcs)
+	var taskPath string
+	for _, t := range Tasks {
+		source, path := Default(t), ""
+		if overrides {
+			var err error
+			if source, path, err = Source(t); err != nil {
+				if t == task {
+					return nil, "", err
+				}
+				source, path = Default(t), ""
+			}
+		}
+		if t == task {
+			taskPath = path
+		} else if path != "" {
+			if _, err := template.New(t).Funcs(funcs).Parse(source); err != nil {
+				source = Default(t)
+			}
+		}
+		if _, err := set.New(t).Parse(source); err != nil {
+			return nil, "", fmt.Errorf("invalid prompt template %s: %w", describe(t, path), err)
+		}
+	}
+	return set, taskPath, nil
+}
+
+// render executes the template of a task with the given data, with or
+// without the user's overrides
+func render(task string, data Data, overrides bool) (string, error) {
+	if !Valid(task) {
+		return "", fmt.Errorf("unknown prompt %q", task)
+	}
+	set, path, err := parse(task, overrides)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := set.ExecuteTemplate(&sb, task, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", describe(task, path), err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// Render executes the template of a task with the given data. If the user's
+// override of the task can't be read, parsed or executed, the built-in
+// template is used instead; Check reports the error.
+func Render(task string, data Data) (string, error) {
+	prompt, err := render(task, data, true)
+	if err == nil || !Valid(task) {
+		return prompt, err
+	}
+	if fallback, defaultErr := render(task, data, false); defaultErr == nil {
+		return fallback, nil
+	}
+	return "", err
+}
+
+// Check renders the template of a task with sample data, to catch mistakes
+// such as misspelled fields before the template is used. Unlike Render, it
+// doesn't fall back to the built-in template.
+func Check(task string) error {
+	_, err := render(task, SampleData(), true)
+	return err
+}
+
+// SampleData returns data with every field set, for checking and previewing
+// templates
+func SampleData() Data {
+	return Data{
+		Shell:     "Bash",
+		OS:        "Linux",
+		CWD:       "/home/user/project",
+		Git:       Git{IsRepo: true, Branch: "main", Dirty: true, Status: "Git repository detected:\n  Branch: main\n  Status: has uncommitted changes", RecentCommits: "a1b2c3d Fix the build"},
+		Project:   []string{"Go"},
+		Directory: "Current directory: /home/user/project\nContents:\n  [FILE] go.mod (120 B)",
+		Rules:     "- Return ONLY the command(s), no explanations, no markdown, no code blocks",
+		Suffix:    "Prefer long option names",
+		Failure:   Failure{Command: "go buidl ./...", Error: "exit status 2"},
+	}
+}
+
+// Create writes the built-in template of a task to the user's prompts
+// directory, unless it is already overridden, and returns its path
+func Create(task string) (string, error) {
+	path, err := Path(task)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create prompts directory: %w", err)
+	}
+	if err := fileutil.AtomicWriteFile(path, []byte(Default(task)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write prompt template: %w", err)
+	}
+	return path, nil
+}
+
+// Reset removes the user's template of a task, so the built-in one is used
+// again. It reports whether there was one.
+func Reset(task string) (bool, error) {
+	path, err := Path(task)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to remove prompt template: %w", err)
+	}
+	return true, nil
+}
+
+// describe names a template in error messages
+func describe(task, path string) string {
+	if path == "" {
+		return fmt.Sprintf("%q (built-in)", task)
+	}
+	return path
+}
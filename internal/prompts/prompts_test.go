@@ -0,0 +1,150 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useHome points the prompts directory at a temporary home directory
+func useHome(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	return filepath.Join(home, ".aiask", "prompts")
+}
+
+func TestDefaults(t *testing.T) {
+	useHome(t)
+	for _, task := range Tasks {
+		if Default(task) == "" {
+			t.Errorf("no built-in %s template", task)
+		}
+		if err := Check(task); err != nil {
+			t.Errorf("built-in %s template: %v", task, err)
+		}
+	}
+}
+
+func TestRenderGenerate(t *testing.T) {
+	useHome(t)
+	tests := []struct {
+		name     string
+		data     Data
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "minimal",
+			data:     Data{Shell: "Zsh", OS: "macOS", CWD: "/tmp", Rules: "- Respond with JSON"},
+			contains: []string{"Rules:\n- Respond with JSON\n- Use the appropriate syntax", "Current shell: Zsh\nOperating system: macOS\nCurrent directory: /tmp"},
+			excludes: []string{"Git branch", "Project:", "Additional instructions", "Recent commits"},
+		},
+		{
+			name:     "full",
+			data:     SampleData(),
+			contains: []string{"Git branch: main (has uncommitted changes)\nProject: Go", "Additional instructions:\nPrefer long option names", "\n\nCurrent directory: /home/user/project\nContents:", "Recent commits:\na1b2c3d Fix the build"},
+			excludes: []string{"go buidl"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, err := Render(TaskGenerate, tt.data)
+			if err != nil {
+				t.Fatalf("Render returned error: %v", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(prompt, s) {
+					t.Errorf("prompt doesn't contain %q:\n%s", s, prompt)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(prompt, s) {
+					t.Errorf("prompt contains %q:\n%s", s, prompt)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderRecoveryIncludesGenerate(t *testing.T) {
+	dir := useHome(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The recovery template builds on the user's generate template
+	if err := os.WriteFile(filepath.Join(dir, "generate.tmpl"), []byte("Custom prompt for {{.Shell | lower}}\n{{.Rules}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prompt, err := Render(TaskRecovery, SampleData())
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if !strings.HasPrefix(prompt, "Custom prompt for bash\n- Return ONLY") {
+		t.Errorf("recovery prompt doesn't start with the generate template:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "Failed command: go buidl ./...\nError: exit status 2") {
+		t.Errorf("recovery prompt doesn't describe the failure:\n%s", prompt)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	dir := useHome(t)
+
+	path, err := Create(TaskExplain)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if path != filepath.Join(dir, "explain.tmpl") {
+		t.Errorf("path = %q", path)
+	}
+	source, overridden, err := Source(TaskExplain)
+	if err != nil || overridden != path || source != Default(TaskExplain) {
+		t.Errorf("Source = %q, %q, %v", source, overridden, err)
+	}
+
+	// Mistakes are reported with the file they are in
+	if err := os.WriteFile(path, []byte("Explain for {{.Sehll}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(TaskExplain); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Check of a misspelled field = %v", err)
+	}
+	if err := os.WriteFile(path, []byte("Explain {{if .OS}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(TaskExplain); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Check of an unparsable template = %v", err)
+	}
+
+	// A broken override only affects its own task, which falls back to the
+	// built-in template
+	if _, err := Render(TaskGenerate, SampleData()); err != nil {
+		t.Errorf("Render of another task returned error: %v", err)
+	}
+	if err := Check(TaskGenerate); err != nil {
+		t.Errorf("Check of another task returned error: %v", err)
+	}
+	prompt, err := Render(TaskExplain, SampleData())
+	if err != nil || !strings.HasPrefix(prompt, "You are a shell command explainer") {
+		t.Errorf("Render of the broken task = %q, %v", prompt, err)
+	}
+
+	removed, err := Reset(TaskExplain)
+	if err != nil || !removed {
+		t.Errorf("Reset = %v, %v", removed, err)
+	}
+	if removed, _ := Reset(TaskExplain); removed {
+		t.Error("second Reset reported a removed template")
+	}
+	if _, overridden, _ := Source(TaskExplain); overridden != "" {
+		t.Errorf("template still overridden by %s", overridden)
+	}
+
+	if _, err := Path("review"); err == nil {
+		t.Error("Path of an unknown prompt returned no error")
+	}
+}
@@ -5,14 +5,19 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Hermithic/aiask/internal/config"
+	"github.com/Hermithic/aiask/internal/docs"
 	"github.com/Hermithic/aiask/internal/history"
+	"github.com/Hermithic/aiask/internal/interrupt"
 	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/probe"
 	"github.com/Hermithic/aiask/internal/shell"
 	"github.com/Hermithic/aiask/internal/ui"
+	"github.com/Hermithic/aiask/internal/usage"
 )
 
 // REPL represents an interactive REPL session
@@ -25,8 +30,24 @@ type REPL struct {
 	historyIdx   int
 	commandCount int
 	startTime    time.Time
+	conversation *llm.Conversation
+	alternatives int
+	tools        *probe.Toolbox
+	probing      bool
+	reviewing    bool
+	newProvider  ProviderFactory
 }
 
+// ProviderFactory creates the provider for a config, wrapped the way the
+// caller needs
+type ProviderFactory func(cfg *config.Config) (llm.Provider, error)
+
+// DefaultAlternatives is the number of candidates /alternatives turns on without an argument
+const DefaultAlternatives = 3
+
+// MaxAlternatives is the most candidates that can be asked for in one request
+const MaxAlternatives = 10
+
 // New creates a new REPL instance
 func New(cfg *config.Config, provider llm.Provider, shellInfo shell.ShellInfo) *REPL {
 	return &REPL{
@@ -38,9 +59,39 @@ func New(cfg *config.Config, provider llm.Provider, shellInfo shell.ShellInfo) *
 		historyIdx:   -1,
 		commandCount: 0,
 		startTime:    time.Now(),
+		conversation: llm.NewConversation(cfg.GetConversationTurns()),
+		newProvider:  llm.NewProvider,
 	}
 }
 
+// SetProviderFactory sets how /provider and /model create a new provider
+func (r *REPL) SetProviderFactory(f ProviderFactory) {
+	r.newProvider = f
+}
+
+// Close releases the resources of the current provider
+func (r *REPL) Close() error {
+	return llm.CloseProvider(r.provider)
+}
+
+// SetAlternatives sets how many alternative commands are generated per request
+func (r *REPL) SetAlternatives(n int) {
+	r.alternatives = n
+}
+
+// SetTools sets the probing tools offered to the model, and whether they are
+// used from the start; /probe toggles them
+func (r *REPL) SetTools(tools *probe.Toolbox, enabled bool) {
+	r.tools = tools
+	r.probing = enabled && tools != nil
+}
+
+// SetReview sets whether generated commands are reviewed in a second pass;
+// /review toggles it
+func (r *REPL) SetReview(enabled bool) {
+	r.reviewing = enabled
+}
+
 // Run starts the REPL loop
 func (r *REPL) Run() {
 	r.printWelcome()
@@ -83,6 +134,8 @@ func (r *REPL) printWelcome() {
 	fmt.Printf("%sQuick Commands:%s\n", ui.ColorBold, ui.ColorReset)
 	r.printCommand("/help", "Show all commands")
 	r.printCommand("/history", "View session history")
+	r.printCommand("/reset", "Forget the conversation")
+	r.printCommand("/explain", "Explain the last command")
 	r.printCommand("/clear", "Clear screen")
 	r.printCommand("/exit", "Exit REPL")
 	fmt.Println()
@@ -113,7 +166,8 @@ func (r *REPL) readPrompt() string {
 
 // handleCommand handles special REPL commands
 func (r *REPL) handleCommand(cmd string) bool {
-	cmd = strings.ToLower(strings.TrimPrefix(cmd, "/"))
+	raw := strings.TrimPrefix(cmd, "/")
+	cmd = strings.ToLower(raw)
 	parts := strings.Fields(cmd)
 	if len(parts) == 0 {
 		return true
@@ -132,6 +186,38 @@ func (r *REPL) handleCommand(cmd string) bool {
 		r.clearScreen()
 		return true
 
+	case "reset", "new":
+		r.resetConversation()
+		return true
+
+	case "alternatives", "alt":
+		r.toggleAlternatives(parts[1:])
+		return true
+
+	case "probe":
+		r.toggleProbing()
+		return true
+
+	case "review":
+		r.toggleReview()
+		return true
+
+	case "explain", "x":
+		// Keep the command's original case. The trimmed input starts with
+		// the name, so the command follows right after it.
+		command := strings.TrimSpace(raw)[len(parts[0]):]
+		r.explainCommand(strings.TrimSpace(command))
+		return true
+
+	case "provider":
+		r.switchProvider(parts[1:])
+		return true
+
+	case "model":
+		// Model names can be case-sensitive
+		r.switchModel(strings.Fields(raw)[1:])
+		return true
+
 	case "exit", "quit", "q":
 		r.showGoodbye()
 		return false
@@ -152,35 +238,67 @@ func (r *REPL) handleCommand(cmd string) bool {
 
 // handlePrompt processes a user prompt
 func (r *REPL) handlePrompt(prompt string) {
-	// Generate command with spinner
-	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.GetTimeout())
-	defer cancel()
-
-	stopSpinner := ui.ShowSpinner(fmt.Sprintf("Generating with %s", r.cfg.Model))
+	// Generate command with spinner; Ctrl-C cancels the request and returns to the prompt
+	ctx, cancel := interrupt.WithTimeout(context.Background(), r.cfg.GetTimeout())
+	ctx, tokens := llm.WithUsage(ctx)
+	ctx, masked := llm.WithScrubReport(ctx)
+
+	req := llm.GenerateRequest{
+		Prompt:    prompt,
+		ShellInfo: r.shellInfo,
+		History:   r.conversation.Turns(),
+
+		Alternatives: r.alternatives,
+		Budget:       llm.ContextBudget(r.cfg),
+	}
 
 	startTime := time.Now()
-	command, err := r.provider.GenerateCommand(ctx, prompt, r.shellInfo)
+	var result *llm.CommandResult
+	var err error
+	if r.probing && llm.SupportsTools(r.provider) {
+		// The probing trace is printed as it happens, so there is no spinner
+		fmt.Printf("%sGenerating with %s...%s\n", ui.ColorDim, r.cfg.Model, ui.ColorReset)
+		result, err = r.provider.(llm.ToolProvider).GenerateCommandWithTools(ctx, req, r.tools)
+	} else {
+		stopSpinner := ui.ShowSpinner(fmt.Sprintf("Generating with %s", r.cfg.Model))
+		result, err = r.provider.GenerateCommand(ctx, req)
+		stopSpinner()
+	}
 	elapsed := time.Since(startTime)
+	// Only the request is cancellable; Ctrl-C while the command runs goes to
+	// the command and must not end the session
+	cancel()
 
-	stopSpinner()
-
+	if err != nil && interrupt.Interrupted(ctx) {
+		fmt.Println(ui.WarningMessage("Cancelled."))
+		fmt.Println()
+		return
+	}
 	if err != nil {
 		ui.ShowError(fmt.Errorf("failed to generate command: %w", err))
 		fmt.Println()
 		return
 	}
 
-	// Show generation time
-	fmt.Printf("%sGenerated in %s%s\n", ui.ColorDim, ui.FormatDuration(elapsed.Seconds()), ui.ColorReset)
-
-	// Clean up the command
-	command = llm.CleanCommand(command)
+	// Show generation time, and which provider answered if a fallback took over
+	answeredProvider, answeredModel := llm.AnsweredBy(r.provider, r.cfg)
+	r.recordUsage(usage.TypeGenerate, tokens, elapsed)
 
-	// Display the command
-	ui.DisplayCommand(command)
+	if answeredProvider != r.cfg.Provider || answeredModel != r.cfg.Model {
+		fmt.Printf("%sGenerated in %s by fallback %s (%s)%s\n", ui.ColorDim, ui.FormatDuration(elapsed.Seconds()), answeredProvider, answeredModel, ui.ColorReset)
+	} else {
+		fmt.Printf("%sGenerated in %s%s\n", ui.ColorDim, ui.FormatDuration(elapsed.Seconds()), ui.ColorReset)
+	}
+	ui.ShowMasked(masked)
 
-	// Get user action
-	action := ui.PromptActionForCommand(command)
+	// Display the command (or alternatives) and get user action
+	chosen, action := ui.ChooseCommand(result, r.reviewer())
+	if chosen == nil {
+		r.conversation.Add(llm.Turn{Prompt: prompt, Command: result.Command(), Outcome: "not used"})
+		fmt.Println()
+		return
+	}
+	command := chosen.Command()
 
 	switch action {
 	case ui.ActionExecute:
@@ -189,6 +307,7 @@ func (r *REPL) handlePrompt(prompt string) {
 		if histErr := history.AddEntry(prompt, command, string(r.shellInfo.Shell), execErr == nil); histErr != nil {
 			fmt.Printf("%s[REPL] Failed to record history: %s%s\n", ui.ColorDim, histErr, ui.ColorReset)
 		}
+		r.rememberExecution(prompt, command, execErr)
 
 	case ui.ActionCopy:
 		err := ui.CopyToClipboard(command)
@@ -198,6 +317,7 @@ func (r *REPL) handlePrompt(prompt string) {
 		if err != nil {
 			ui.ShowError(err)
 		}
+		r.conversation.Add(llm.Turn{Prompt: prompt, Command: command, Outcome: "copied to clipboard, not executed"})
 
 	case ui.ActionEdit:
 		edited := ui.PromptEdit(command)
@@ -210,6 +330,7 @@ func (r *REPL) handlePrompt(prompt string) {
 			if histErr := history.AddEntry(prompt, edited, string(r.shellInfo.Shell), execErr == nil); histErr != nil {
 				fmt.Printf("%s[REPL] Failed to record history: %s%s\n", ui.ColorDim, histErr, ui.ColorReset)
 			}
+			r.rememberExecution(prompt, edited, execErr)
 		} else if editAction == ui.ActionCopy {
 			err := ui.CopyToClipboard(edited)
 			if histErr := history.AddEntry(prompt, edited, string(r.shellInfo.Shell), false); histErr != nil {
@@ -218,9 +339,14 @@ func (r *REPL) handlePrompt(prompt string) {
 			if err != nil {
 				ui.ShowError(err)
 			}
+			r.conversation.Add(llm.Turn{Prompt: prompt, Command: edited, Outcome: "edited by the user and copied to clipboard, not executed"})
+		} else {
+			r.conversation.Add(llm.Turn{Prompt: prompt, Command: edited, Outcome: "edited by the user but not used"})
 		}
 
 	case ui.ActionReprompt:
+		r.conversation.Add(llm.Turn{Prompt: prompt, Command: command, Outcome: "rejected by the user"})
+
 		// Prompt for a new request and process it
 		newPrompt := ui.PromptReprompt()
 		if newPrompt != "" {
@@ -232,11 +358,239 @@ func (r *REPL) handlePrompt(prompt string) {
 
 	case ui.ActionQuit:
 		// Just continue to next prompt in REPL mode
+		r.conversation.Add(llm.Turn{Prompt: prompt, Command: command, Outcome: "not used"})
+	}
+
+	fmt.Println()
+}
+
+// rememberExecution records an executed command and its result in the conversation
+func (r *REPL) rememberExecution(prompt, command string, execErr error) {
+	outcome := "executed successfully"
+	if execErr != nil {
+		outcome = fmt.Sprintf("executed but failed: %s", execErr)
+	}
+	r.conversation.Add(llm.Turn{Prompt: prompt, Command: command, Executed: true, Outcome: outcome})
+}
+
+// toggleAlternatives turns alternative commands on or off, or sets their number
+func (r *REPL) toggleAlternatives(args []string) {
+	if len(args) == 0 {
+		if r.alternatives > 1 {
+			r.alternatives = 0
+		} else {
+			r.alternatives = DefaultAlternatives
+		}
+	} else if args[0] == "off" {
+		r.alternatives = 0
+	} else {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > MaxAlternatives {
+			fmt.Println(ui.WarningMessage(fmt.Sprintf("Usage: /alternatives [number from 2 to %d|1 or off]", MaxAlternatives)))
+			return
+		}
+		r.alternatives = n
+	}
+
+	if r.alternatives > 1 {
+		fmt.Println(ui.SuccessMessage(fmt.Sprintf("Alternatives on: %d candidates per request.", r.alternatives)))
+	} else {
+		fmt.Println(ui.SuccessMessage("Alternatives off: one command per request."))
+	}
+}
+
+// toggleProbing turns the probing tools on or off
+func (r *REPL) toggleProbing() {
+	if r.tools == nil || !llm.SupportsTools(r.provider) {
+		fmt.Println(ui.WarningMessage("Probing tools are not supported by this provider."))
+		return
+	}
+	r.probing = !r.probing
+	if r.probing {
+		fmt.Println(ui.SuccessMessage(fmt.Sprintf("Probing on: the model may inspect the system for up to %d rounds.", r.tools.MaxRounds)))
+	} else {
+		fmt.Println(ui.SuccessMessage("Probing off."))
+	}
+}
+
+// toggleReview turns the review of generated commands on or off
+func (r *REPL) toggleReview() {
+	if !llm.SupportsReview(r.provider) {
+		fmt.Println(ui.WarningMessage("Reviews are not supported by this provider."))
+		return
+	}
+	r.reviewing = !r.reviewing
+	if r.reviewing {
+		fmt.Println(ui.SuccessMessage("Review on: each command is checked in a second pass before it is shown."))
+	} else {
+		fmt.Println(ui.SuccessMessage("Review off."))
+	}
+}
+
+// reviewer returns the function that reviews generated commands with the
+// current provider, or nil when reviews are off
+func (r *REPL) reviewer() ui.ReviewFunc {
+	if !r.reviewing || !llm.SupportsReview(r.provider) {
+		return nil
+	}
+	rp := r.provider.(llm.ReviewProvider)
+
+	return func(command string) (*llm.Review, error) {
+		ctx, cancel := interrupt.WithTimeout(context.Background(), r.cfg.GetTimeout())
+		defer cancel()
+		ctx, tokens := llm.WithUsage(ctx)
+
+		startTime := time.Now()
+		stopSpinner := ui.ShowSpinner("Reviewing command")
+		review, err := rp.ReviewCommand(ctx, llm.ReviewRequest{Command: command, ShellInfo: r.shellInfo})
+		stopSpinner()
+		if err != nil {
+			return nil, err
+		}
+
+		r.recordUsage(usage.TypeReview, tokens, time.Since(startTime))
+		return review, nil
+	}
+}
+
+// switchProvider shows the current provider, or switches to another one for
+// the rest of the session. The conversation is kept, so the same request can
+// be compared across providers.
+func (r *REPL) switchProvider(args []string) {
+	if len(args) == 0 {
+		fmt.Printf("  %sProvider:%s %s%s%s (%s)\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.cfg.Provider, ui.ColorReset, r.cfg.Model)
+		fmt.Printf("  %sAvailable:%s %s\n", ui.ColorDim, ui.ColorReset, strings.Join(config.ValidProviders(), ", "))
+		fmt.Println(ui.InfoMessage("Usage: /provider <name>"))
+		return
+	}
+	r.applyOverrides(config.Overrides{Provider: config.Provider(args[0])})
+}
+
+// switchModel lists the provider's models, or switches to another model for
+// the rest of the session
+func (r *REPL) switchModel(args []string) {
+	if len(args) > 0 {
+		r.applyOverrides(config.Overrides{Model: args[0]})
+		return
+	}
+
+	fmt.Printf("  %sModel:%s %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.cfg.Model, ui.ColorReset)
+	ctx, cancel := interrupt.WithTimeout(context.Background(), r.cfg.GetTimeout())
+	defer cancel()
+	models, err := llm.ListModels(ctx, r.cfg)
+	if err != nil {
+		fmt.Println(ui.WarningMessage(fmt.Sprintf("Could not list models: %s", err)))
+		return
+	}
+	for _, m := range models {
+		marker := " "
+		if llm.HasModel([]llm.ModelInfo{m}, r.cfg.Model) {
+			marker = ui.IconCheck
+		}
+		fmt.Printf("  %s%s%s %s\n", ui.ColorGreen, marker, ui.ColorReset, m.ID)
+	}
+	fmt.Println(ui.InfoMessage("Usage: /model <name>"))
+}
+
+// applyOverrides switches to a provider built from the current config with
+// the overrides applied, keeping the current one if that fails
+func (r *REPL) applyOverrides(o config.Overrides) {
+	cfg, err := r.cfg.Override(o)
+	if err != nil {
+		ui.ShowError(err)
+		return
+	}
+	provider, err := r.newProvider(cfg)
+	if err != nil {
+		ui.ShowError(err)
+		return
+	}
+
+	if err := llm.CloseProvider(r.provider); err != nil {
+		fmt.Printf("%s[REPL] Failed to close the previous provider: %s%s\n", ui.ColorDim, err, ui.ColorReset)
+	}
+	r.cfg, r.provider = cfg, provider
+	fmt.Println(ui.SuccessMessage(fmt.Sprintf("Now using %s (%s).", cfg.Provider, cfg.Model)))
+	if r.probing && !llm.SupportsTools(provider) {
+		fmt.Println(ui.WarningMessage("Probing tools are not supported by this provider and won't be used."))
 	}
+	if r.reviewing && !llm.SupportsReview(provider) {
+		fmt.Println(ui.WarningMessage("Reviews are not supported by this provider and won't be done."))
+	}
+}
+
+// explainCommand explains a command, defaulting to the last one generated.
+// The explanation streams in when the provider supports it.
+func (r *REPL) explainCommand(command string) {
+	if command == "" {
+		turns := r.conversation.Turns()
+		if len(turns) == 0 {
+			fmt.Println(ui.WarningMessage("Usage: /explain <command>, or generate a command first."))
+			return
+		}
+		command = turns[len(turns)-1].Command
+	}
+
+	ctx, cancel := interrupt.WithTimeout(context.Background(), r.cfg.GetTimeout())
+	defer cancel()
+	ctx, tokens := llm.WithUsage(ctx)
+	ctx, masked := llm.WithScrubReport(ctx)
+
+	fmt.Printf("\n%s%sExplanation of%s %s%s%s\n", ui.ColorBold, ui.ColorCyan, ui.ColorReset, ui.ColorGreen, command, ui.ColorReset)
 
+	// Ground the explanation in the local documentation of each program
+	refs := docs.Lookup(ctx, command, probe.HelpCommands(r.cfg))
+	req := llm.ExplainRequest{Command: command, ShellInfo: r.shellInfo, Reference: docs.Format(refs, docs.DefaultBudget)}
+
+	startTime := time.Now()
+	var err error
+	if llm.SupportsExplainStreaming(r.provider) {
+		renderer := ui.NewMarkdownRenderer(os.Stdout, "  ")
+		_, err = r.provider.(llm.ExplainStreamingProvider).ExplainCommandStream(ctx, req, renderer.Write)
+		renderer.Flush()
+	} else {
+		stopSpinner := ui.ShowSpinner(fmt.Sprintf("Explaining with %s", r.cfg.Model))
+		var explanation string
+		explanation, err = r.provider.ExplainCommand(ctx, req)
+		stopSpinner()
+		if err == nil {
+			ui.RenderMarkdown(os.Stdout, explanation, "  ")
+		}
+	}
+	elapsed := time.Since(startTime)
+
+	if err != nil && interrupt.Interrupted(ctx) {
+		fmt.Println(ui.WarningMessage("Cancelled."))
+		fmt.Println()
+		return
+	}
+	if err != nil {
+		ui.ShowError(fmt.Errorf("failed to explain command: %w", err))
+		fmt.Println()
+		return
+	}
+
+	r.recordUsage(usage.TypeExplain, tokens, elapsed)
+	for _, ref := range refs {
+		fmt.Printf("%s  ℹ %s%s\n", ui.ColorDim, ref.Note(), ui.ColorReset)
+	}
+	ui.ShowMasked(masked)
 	fmt.Println()
 }
 
+// recordUsage appends a completed provider call to the usage log
+func (r *REPL) recordUsage(callType string, tokens *llm.Usage, latency time.Duration) {
+	if err := llm.RecordUsage(callType, r.provider, r.cfg, tokens, latency); err != nil {
+		fmt.Printf("%s[REPL] Failed to record usage: %s%s\n", ui.ColorDim, err, ui.ColorReset)
+	}
+}
+
+// resetConversation forgets all prior turns so the next prompt starts fresh
+func (r *REPL) resetConversation() {
+	r.conversation.Reset()
+	fmt.Println(ui.SuccessMessage("Conversation reset. The next request starts fresh."))
+}
+
 // showHelp displays help information
 func (r *REPL) showHelp() {
 	fmt.Println()
@@ -246,6 +600,13 @@ func (r *REPL) showHelp() {
 	fmt.Printf("%sNavigation Commands:%s\n", ui.ColorBold, ui.ColorReset)
 	r.printCommand("/help, /?", "Show this help message")
 	r.printCommand("/history", "Show session history")
+	r.printCommand("/reset", "Forget previous requests and commands")
+	r.printCommand("/alt [n|off]", "Toggle alternative commands per request")
+	r.printCommand("/explain, /x", "Explain a command, or the last one generated")
+	r.printCommand("/probe", "Toggle read-only probing tools")
+	r.printCommand("/review", "Toggle the review of generated commands")
+	r.printCommand("/provider", "Show the provider, or switch with /provider <name>")
+	r.printCommand("/model", "List models, or switch with /model <name>")
 	r.printCommand("/clear", "Clear the screen")
 	r.printCommand("/config", "Show current configuration")
 	r.printCommand("/stats", "Show session statistics")
@@ -261,6 +622,7 @@ func (r *REPL) showHelp() {
 	fmt.Printf("%sUsage:%s\n", ui.ColorBold, ui.ColorReset)
 	fmt.Printf("  Just type your request in natural language and press Enter.\n")
 	fmt.Printf("  %sExample:%s list all files larger than 100MB\n", ui.ColorDim, ui.ColorReset)
+	fmt.Printf("  Follow-ups remember earlier requests, e.g. %snow only the .js files%s\n", ui.ColorDim, ui.ColorReset)
 	fmt.Println()
 }
 
@@ -289,9 +651,21 @@ func (r *REPL) showConfig() {
 
 	fmt.Printf("  %sProvider:%s    %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.cfg.Provider, ui.ColorReset)
 	fmt.Printf("  %sModel:%s       %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.cfg.Model, ui.ColorReset)
+	if r.cfg.BaseURL != "" {
+		fmt.Printf("  %sBase URL:%s    %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.cfg.GetBaseURL(), ui.ColorReset)
+	}
 	fmt.Printf("  %sShell:%s       %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, shell.GetShellName(r.shellInfo.Shell), ui.ColorReset)
 	fmt.Printf("  %sOS:%s          %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, shell.GetOSName(), ui.ColorReset)
 	fmt.Printf("  %sTimeout:%s     %s%v%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.cfg.GetTimeout(), ui.ColorReset)
+	for _, fb := range r.cfg.Fallbacks {
+		fmt.Printf("  %sFallback:%s    %s%s (%s)%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, fb.Provider, r.cfg.WithProvider(fb).Model, ui.ColorReset)
+	}
+	if r.alternatives > 1 {
+		fmt.Printf("  %sAlternatives:%s%s%d%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.alternatives, ui.ColorReset)
+	}
+	if r.reviewing {
+		fmt.Printf("  %sReview:%s      %son%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, ui.ColorReset)
+	}
 	fmt.Println()
 }
 
@@ -306,6 +680,7 @@ func (r *REPL) showStats() {
 	fmt.Printf("  %sSession Duration:%s  %s%s%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, ui.FormatDuration(sessionDuration.Seconds()), ui.ColorReset)
 	fmt.Printf("  %sPrompts Entered:%s   %s%d%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, len(r.history), ui.ColorReset)
 	fmt.Printf("  %sCommands Executed:%s %s%d%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.commandCount, ui.ColorReset)
+	fmt.Printf("  %sRemembered Turns:%s  %s%d/%d%s\n", ui.ColorDim, ui.ColorReset, ui.ColorCyan, r.conversation.Len(), r.cfg.GetConversationTurns(), ui.ColorReset)
 	fmt.Println()
 }
 
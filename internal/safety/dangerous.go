@@ -129,6 +129,21 @@ func RequiresConfirmation(command string) bool {
 	return result.Level >= Dangerous
 }
 
+// ConfirmationPhrase returns what the user must type before a command runs,
+// or "" if no confirmation is needed. A disputed command, one that different
+// models disagreed on, needs one step more: "yes" even when it looks safe, and
+// "run anyway" when it is dangerous.
+func ConfirmationPhrase(command string, disputed bool) string {
+	dangerous := RequiresConfirmation(command)
+	switch {
+	case disputed && dangerous:
+		return "run anyway"
+	case disputed || dangerous:
+		return "yes"
+	}
+	return ""
+}
+
 // GetWarningMessage returns a formatted warning message for a dangerous command
 func GetWarningMessage(command string) string {
 	result := Analyze(command)
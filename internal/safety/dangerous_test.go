@@ -83,6 +83,29 @@ func TestRequiresConfirmation(t *testing.T) {
 	}
 }
 
+func TestConfirmationPhrase(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		disputed bool
+		expected string
+	}{
+		{"safe command", "ls -la", false, ""},
+		{"dangerous command", "rm -rf ./folder", false, "yes"},
+		{"disputed safe command", "ls -la", true, "yes"},
+		{"disputed caution command", "rm file.txt", true, "yes"},
+		{"disputed dangerous command", "rm -rf ./folder", true, "run anyway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConfirmationPhrase(tt.command, tt.disputed); got != tt.expected {
+				t.Errorf("ConfirmationPhrase(%q, %v) = %q, expected %q", tt.command, tt.disputed, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestGetLevelName(t *testing.T) {
 	tests := []struct {
 		level    DangerLevel
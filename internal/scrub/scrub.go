@@ -0,0 +1,281 @@
+// Package scrub masks secrets such as API keys, tokens, private keys and
+// passwords in text before it is sent to a provider. Each secret is replaced
+// with a placeholder like <AWS_ACCESS_KEY_1>, which is the same wherever the
+// secret appears, so the model can use it and the original value can be put
+// back in the answer.
+package scrub
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+// Kinds of secrets
+const (
+	KindPrivateKey     = "private key"
+	KindURLCredentials = "URL credentials"
+	KindAnthropicKey   = "Anthropic API key"
+	KindAPIKey         = "API key"
+	KindAWSAccessKey   = "AWS access key"
+	KindAWSSecretKey   = "AWS secret key"
+	KindGitHubToken    = "GitHub token"
+	KindSlackToken     = "Slack token"
+	KindGoogleAPIKey   = "Google API key"
+	KindJWT            = "JWT"
+	KindBearerToken    = "bearer token"
+	KindPassword       = "password"
+	KindRandomString   = "random string"
+	KindCustom         = "custom secret"
+)
+
+// Detector finds one kind of secret. If the pattern has a group named
+// "secret", only that group is masked, so "password=hunter2" keeps its key.
+type Detector struct {
+	Kind    string
+	Pattern *regexp.Regexp
+}
+
+// Detectors are the built-in detectors of common credential formats, in the
+// order they are applied. Values already replaced by a placeholder start
+// with "<" and aren't matched again.
+var Detectors = []Detector{
+	{KindPrivateKey, regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{KindURLCredentials, regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.\-]*://[^\s:/@<]+:(?P<secret>[^\s@/<]+)@`)},
+	{KindAnthropicKey, regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_\-]{20,}`)},
+	{KindAPIKey, regexp.MustCompile(`\b(?:sk|xai|gsk)-[A-Za-z0-9_\-]{16,}`)},
+	{KindAWSAccessKey, regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{KindAWSSecretKey, regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})\b`)},
+	{KindGitHubToken, regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}\b|\bgithub_pat_[A-Za-z0-9_]{22,}`)},
+	{KindSlackToken, regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`)},
+	{KindGoogleAPIKey, regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{KindJWT, regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{8,}\.eyJ[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,}`)},
+	{KindBearerToken, regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/\-]{16,}=*)`)},
+	{KindPassword, regexp.MustCompile(`(?i)(?:\b|_)(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret)["']?\s*[:=]\s*["']?(?P<secret>[^\s"'<>,;]{6,})`)},
+}
+
+// candidatePattern matches strings checked for randomness
+var candidatePattern = regexp.MustCompile(`[A-Za-z0-9+=_\-]{24,}`)
+
+// Match is a secret found in a text
+type Match struct {
+	Kind        string
+	Source      string // Where the secret was found, e.g. "directory"
+	Placeholder string
+}
+
+// Scrubber masks secrets, giving each distinct secret its own placeholder.
+// It is safe for concurrent use.
+type Scrubber struct {
+	detectors []Detector
+	entropy   bool
+
+	mu           sync.Mutex
+	placeholders map[string]string // Secret to placeholder
+	secrets      map[string]string // Placeholder to secret
+	counts       map[string]int    // Placeholders made per kind
+}
+
+// New creates a scrubber with the built-in detectors and the patterns in the
+// settings, which are applied first
+func New(cfg *config.ScrubConfig) (*Scrubber, error) {
+	s := &Scrubber{
+		entropy:      true,
+		placeholders: map[string]string{},
+		secrets:      map[string]string{},
+		counts:       map[string]int{},
+	}
+	if cfg != nil {
+		s.entropy = !cfg.NoEntropy
+		for _, pattern := range cfg.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scrub pattern %q: %w", pattern, err)
+			}
+			s.detectors = append(s.detectors, Detector{KindCustom, re})
+		}
+	}
+	s.detectors = append(s.detectors, Detectors...)
+	return s, nil
+}
+
+// Scrub replaces the secrets in a text with placeholders and returns the
+// text with the secrets found. source names where the text comes from, for
+// the summary.
+func (s *Scrubber) Scrub(source, text string) (string, []Match) {
+	if text == "" {
+		return text, nil
+	}
+	var matches []Match
+	mask := func(kind, secret string) string {
+		placeholder := s.placeholder(kind, secret)
+		matches = append(matches, Match{Kind: kind, Source: source, Placeholder: placeholder})
+		return placeholder
+	}
+
+	for _, d := range s.detectors {
+		text = replace(d.Pattern, text, func(secret string) string {
+			return mask(d.Kind, secret)
+		})
+	}
+	if s.entropy {
+		text = candidatePattern.ReplaceAllStringFunc(text, func(candidate string) string {
+			if !looksRandom(candidate) {
+				return candidate
+			}
+			return mask(KindRandomString, candidate)
+		})
+	}
+	return text, matches
+}
+
+// Restore puts the secrets back in place of their placeholders
+func (s *Scrubber) Restore(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.secrets) == 0 || !strings.Contains(text, "<") {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(s.secrets))
+	for placeholder, secret := range s.secrets {
+		pairs = append(pairs, placeholder, secret)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// IsPlaceholder reports whether a text is a placeholder made by the scrubber
+func (s *Scrubber) IsPlaceholder(text string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.secrets[strings.TrimSpace(text)]
+	return ok
+}
+
+// placeholder returns the placeholder of a secret, making one on first use
+func (s *Scrubber) placeholder(kind, secret string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if placeholder, ok := s.placeholders[secret]; ok {
+		return placeholder
+	}
+	s.counts[kind]++
+	name := strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(kind))
+	placeholder := fmt.Sprintf("<%s_%d>", name, s.counts[kind])
+	s.placeholders[secret] = placeholder
+	s.secrets[placeholder] = secret
+	return placeholder
+}
+
+// replace replaces each match of a pattern, or its "secret" group, with the
+// result of fn
+func replace(re *regexp.Regexp, text string, fn func(secret string) string) string {
+	group := re.SubexpIndex("secret")
+	indexes := re.FindAllStringSubmatchIndex(text, -1)
+	if indexes == nil {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, loc := range indexes {
+		start, end := loc[0], loc[1]
+		if group > 0 {
+			start, end = loc[2*group], loc[2*group+1]
+		}
+		if start < 0 || start == end {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(fn(text[start:end]))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// looksRandom reports whether a string looks like a generated key or token:
+// a long hex string, or a mix of upper and lower case letters and digits
+// with high entropy. File names, words and dates rarely pass.
+func looksRandom(s string) bool {
+	var upper, lower, digit, hex bool
+	hex = true
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			hex = false
+		}
+	}
+	if hex {
+		return len(s) >= 32 && digit && (upper || lower) && entropy(s) >= 3
+	}
+	return upper && lower && digit && entropy(s) >= 4
+}
+
+// entropy returns the Shannon entropy of a string in bits per character
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var bits float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+// Redact replaces the given secrets and anything a built-in detector finds
+// with "[REDACTED]", for logs that should never hold secrets. Unlike Scrub,
+// it can't be undone.
+func Redact(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		// Short values would redact ordinary words
+		if len(secret) >= 8 {
+			text = strings.ReplaceAll(text, secret, Redacted)
+		}
+	}
+	for _, d := range Detectors {
+		text = replace(d.Pattern, text, func(string) string { return Redacted })
+	}
+	return text
+}
+
+// Redacted replaces secrets removed by Redact
+const Redacted = "[REDACTED]"
+
+// Summary describes the secrets masked, e.g. "2 secrets (AWS access key in
+// prompt, password in directory)". Each kind is listed once per source.
+func Summary(matches []Match) string {
+	seen := map[string]bool{}
+	var items []string
+	secrets := map[string]bool{}
+	for _, m := range matches {
+		secrets[m.Placeholder] = true
+		item := m.Kind + " in " + m.Source
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+	noun := "secrets"
+	if len(secrets) == 1 {
+		noun = "secret"
+	}
+	return fmt.Sprintf("%d %s (%s)", len(secrets), noun, strings.Join(items, ", "))
+}
@@ -0,0 +1,148 @@
+// Package trace writes a log of provider requests and responses as JSON
+// lines, for debugging bad answers. API keys and other secrets are redacted
+// before anything is written.
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/scrub"
+)
+
+// Kinds of traced calls
+const (
+	KindGenerate = "generate"
+	KindRecovery = "recovery"
+	KindExplain  = "explain"
+)
+
+// Entry is one provider call in the trace log
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Kind         string    `json:"kind"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	Stream       bool      `json:"stream,omitempty"`
+	Tools        bool      `json:"tools,omitempty"` // Probing tools were offered
+	SystemPrompt string    `json:"system_prompt,omitempty"`
+	Prompt       string    `json:"prompt"`
+	Failure      *Failure  `json:"failure,omitempty"` // The command a recovery call asks to fix
+	Context      []Section `json:"context,omitempty"`
+	Response     string    `json:"response,omitempty"` // Raw text of the model's answer
+	Commands     []string  `json:"commands,omitempty"` // Commands parsed from the answer
+	Error        string    `json:"error,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+	FirstChunkMs int64     `json:"first_chunk_ms,omitempty"` // Time to the first streamed chunk
+	InputTokens  int64     `json:"input_tokens,omitempty"`
+	OutputTokens int64     `json:"output_tokens,omitempty"`
+}
+
+// Failure is a command that failed, with its error
+type Failure struct {
+	Command string `json:"command"`
+	Error   string `json:"error"`
+}
+
+// Section describes a part of the request's context and how it fit the
+// context budget. Only optional context has its text included; the system
+// prompt and the prompt are in their own fields.
+type Section struct {
+	Name    string `json:"name"`
+	Tokens  int    `json:"tokens"`
+	Kept    int    `json:"kept"`
+	Dropped bool   `json:"dropped,omitempty"`
+	Text    string `json:"text,omitempty"`
+}
+
+// Writer appends entries to a trace file
+type Writer struct {
+	path    string
+	secrets []string
+}
+
+// writeMu serializes appends from all writers, since consensus runs
+// providers concurrently and each has its own writer
+var writeMu sync.Mutex
+
+// NewWriter returns a writer appending to the file at path, which may start
+// with ~ for the home directory. The given secrets, such as API keys, are
+// redacted along with common credential formats.
+func NewWriter(path string, secrets ...string) *Writer {
+	return &Writer{path: expandHome(path), secrets: secrets}
+}
+
+// Check reports whether a trace file can be opened for appending, so a bad
+// path is reported before any request is made
+func Check(path string) error {
+	f, err := os.OpenFile(expandHome(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return f.Close()
+}
+
+// Write redacts an entry and appends it to the trace file as one JSON line
+func (w *Writer) Write(e Entry) error {
+	e.redact(w.Redact)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode trace entry: %w", err)
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open trace file: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write trace file: %w", err)
+	}
+	return f.Close()
+}
+
+// Redact replaces the writer's secrets and anything that looks like a
+// credential in a text
+func (w *Writer) Redact(text string) string {
+	return scrub.Redact(text, w.secrets...)
+}
+
+// redact applies a redaction function to every text field of the entry
+func (e *Entry) redact(redact func(string) string) {
+	e.SystemPrompt = redact(e.SystemPrompt)
+	e.Prompt = redact(e.Prompt)
+	e.Response = redact(e.Response)
+	e.Error = redact(e.Error)
+	if e.Failure != nil {
+		failure := Failure{Command: redact(e.Failure.Command), Error: redact(e.Failure.Error)}
+		e.Failure = &failure
+	}
+	commands := make([]string, len(e.Commands))
+	for i, c := range e.Commands {
+		commands[i] = redact(c)
+	}
+	e.Commands = commands
+	sections := make([]Section, len(e.Context))
+	for i, s := range e.Context {
+		s.Text = redact(s.Text)
+		sections[i] = s
+	}
+	e.Context = sections
+}
+
+// expandHome replaces a leading ~ in a path with the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
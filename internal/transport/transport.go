@@ -0,0 +1,234 @@
+// Package transport builds the HTTP transport shared by the provider clients
+// and the update check, with the proxy and TLS settings from the config.
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+var (
+	mu     sync.Mutex
+	shared = map[string]*http.Transport{}
+)
+
+// Shared returns the transport for the network settings, creating it on
+// first use so that all providers and the update check reuse its
+// connections. Nil settings give the defaults: the proxy from the
+// environment and the system's CA certificates.
+func Shared(cfg *config.NetworkConfig) (*http.Transport, error) {
+	if cfg == nil {
+		cfg = &config.NetworkConfig{}
+	}
+	key := fmt.Sprintf("%+v", *cfg)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := shared[key]; ok {
+		return t, nil
+	}
+	t, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	shared[key] = t
+	return t, nil
+}
+
+// New creates a transport for the network settings
+func New(cfg *config.NetworkConfig) (*http.Transport, error) {
+	if cfg == nil {
+		cfg = &config.NetworkConfig{}
+	}
+	proxy, err := proxyFunc(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxy
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
+
+// Describe summarizes the network settings for verbose output and the doctor
+func Describe(cfg *config.NetworkConfig) string {
+	if cfg == nil {
+		cfg = &config.NetworkConfig{}
+	}
+	parts := []string{"proxy from environment"}
+	if cfg.Proxy != "" {
+		parts[0] = "proxy " + cfg.Proxy
+	}
+	if len(cfg.NoProxy) > 0 {
+		parts = append(parts, "no proxy for "+strings.Join(cfg.NoProxy, ", "))
+	}
+	if cfg.CACert != "" {
+		parts = append(parts, "CA certificates from "+cfg.CACert)
+	}
+	if cfg.ClientCert != "" {
+		parts = append(parts, "client certificate "+cfg.ClientCert)
+	}
+	if cfg.InsecureSkipVerify {
+		parts = append(parts, "certificate verification disabled")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// proxyFunc returns the function choosing the proxy of each request: the
+// configured proxy, or the one from HTTPS_PROXY and HTTP_PROXY, except for
+// hosts in no_proxy or NO_PROXY and the local machine
+func proxyFunc(cfg *config.NetworkConfig) (func(*http.Request) (*url.URL, error), error) {
+	var proxyURL *url.URL
+	if cfg.Proxy != "" {
+		raw := cfg.Proxy
+		if !strings.Contains(raw, "://") {
+			raw = "http://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", cfg.Proxy)
+		}
+		proxyURL = u
+	}
+
+	// The config's entries are added to those in NO_PROXY, which also apply
+	// to a configured proxy
+	noProxy := append([]string(nil), cfg.NoProxy...)
+	for _, env := range []string{"NO_PROXY", "no_proxy"} {
+		for _, entry := range strings.Split(os.Getenv(env), ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				noProxy = append(noProxy, entry)
+			}
+		}
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if Bypass(req.URL, noProxy) {
+			return nil, nil
+		}
+		if proxyURL != nil {
+			return proxyURL, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}, nil
+}
+
+// Bypass reports whether requests to a URL skip the proxy: requests to the
+// local machine, and to hosts matching a no_proxy entry. Entries are host
+// names, which also match their subdomains ("corp.com" or ".corp.com"), IP
+// addresses, CIDR ranges and "*"; any of them may end with a port.
+func Bypass(u *url.URL, noProxy []string) bool {
+	host := strings.ToLower(u.Hostname())
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, port, err := net.SplitHostPort(entry); err == nil {
+			if port != portOf(u) {
+				continue
+			}
+			entry = h
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		domain := strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// portOf returns the port of a URL, or the default port of its scheme
+func portOf(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// newTLSConfig returns the TLS settings: the system's CA certificates plus
+// those in ca_cert, and the client certificate for mutual TLS
+func newTLSConfig(cfg *config.NetworkConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	if cfg.CACert != "" {
+		data, err := os.ReadFile(expandHome(cfg.CACert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in ca_cert %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case cfg.ClientCert != "":
+		certPEM, err := os.ReadFile(expandHome(cfg.ClientCert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client_cert: %w", err)
+		}
+		keyPEM := certPEM
+		if cfg.ClientKey != "" {
+			if keyPEM, err = os.ReadFile(expandHome(cfg.ClientKey)); err != nil {
+				return nil, fmt.Errorf("failed to read client_key: %w", err)
+			}
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case cfg.ClientKey != "":
+		return nil, fmt.Errorf("client_key is set without client_cert")
+	}
+	return tlsConfig, nil
+}
+
+// expandHome replaces a leading ~ in a path with the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -0,0 +1,262 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+// writePEM writes PEM blocks to a file in a temporary directory and returns its path
+func writePEM(t *testing.T, name string, blocks ...*pem.Block) string {
+	var data []byte
+	for _, b := range blocks {
+		data = append(data, pem.EncodeToMemory(b)...)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serverCA writes the certificate of a TLS test server to a PEM file
+func serverCA(t *testing.T, server *httptest.Server) string {
+	return writePEM(t, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+// get requests a URL through a transport for the settings and returns the body
+func get(cfg *config.NetworkConfig, url string) (string, error) {
+	tr, err := New(cfg)
+	if err != nil {
+		return "", err
+	}
+	resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestTLSSettings(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		cfg     *config.NetworkConfig
+		wantErr string
+	}{
+		{"system CAs only", nil, "certificate"},
+		{"extra CA", &config.NetworkConfig{CACert: serverCA(t, server)}, ""},
+		{"insecure", &config.NetworkConfig{InsecureSkipVerify: true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := get(tt.cfg, server.URL)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, expected one about %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || body != "ok" {
+				t.Errorf("got %q, %v", body, err)
+			}
+		})
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	// A self-signed client certificate, trusted by the server
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "aiask"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBlock := &pem.Block{Type: "CERTIFICATE", Bytes: der}
+	keyBlock := &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	ca := serverCA(t, server)
+
+	tests := []struct {
+		name string
+		cfg  *config.NetworkConfig
+		ok   bool
+	}{
+		{"no client certificate", &config.NetworkConfig{CACert: ca}, false},
+		{"separate key", &config.NetworkConfig{CACert: ca, ClientCert: writePEM(t, "cert.pem", certBlock), ClientKey: writePEM(t, "key.pem", keyBlock)}, true},
+		{"key in the certificate file", &config.NetworkConfig{CACert: ca, ClientCert: writePEM(t, "both.pem", certBlock, keyBlock)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := get(tt.cfg, server.URL)
+			if !tt.ok {
+				if err == nil {
+					t.Error("request without a client certificate succeeded")
+				}
+				return
+			}
+			if err != nil || body != "aiask" {
+				t.Errorf("got %q, %v", body, err)
+			}
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, "from proxy")
+	}))
+	defer proxy.Close()
+
+	body, err := get(&config.NetworkConfig{Proxy: proxy.URL}, "http://api.example.test/v1/models")
+	if err != nil || body != "from proxy" {
+		t.Fatalf("got %q, %v", body, err)
+	}
+	if proxied != "http://api.example.test/v1/models" {
+		t.Errorf("proxy got request for %q", proxied)
+	}
+
+	// The local machine, no_proxy hosts and hosts in NO_PROXY are reached
+	// directly
+	t.Setenv("NO_PROXY", "gateway.internal, 10.1.0.0/16")
+	t.Setenv("no_proxy", "ollama.lan:11434")
+	tr, err := New(&config.NetworkConfig{Proxy: strings.TrimPrefix(proxy.URL, "http://"), NoProxy: []string{".corp.example"}})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	for target, expected := range map[string]string{
+		"https://api.openai.com/v1":        proxy.URL,
+		"https://llm.corp.example/v1":      "",
+		"http://localhost:11434":           "",
+		"https://gateway.internal/v1":      "",
+		"http://10.1.2.3:8080/v1":          "",
+		"http://ollama.lan:11434/api/chat": "",
+		"http://ollama.lan:8080/v1":        proxy.URL,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		u, err := tr.Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy(%s) returned error: %v", target, err)
+		}
+		if got := urlString(u); got != expected {
+			t.Errorf("proxy for %s = %q, expected %q", target, got, expected)
+		}
+	}
+}
+
+// urlString returns the URL as a string, or "" if it is nil
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+func TestBypass(t *testing.T) {
+	noProxy := []string{"corp.example", ".internal.test", "10.0.0.0/8", "192.168.1.5", "gateway.test:8443"}
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://corp.example/v1", true},
+		{"https://llm.corp.example/v1", true},
+		{"https://notcorp.example/v1", false},
+		{"https://a.internal.test", true},
+		{"http://10.1.2.3:8080", true},
+		{"http://11.1.2.3", false},
+		{"http://192.168.1.5", true},
+		{"https://gateway.test:8443", true},
+		{"https://gateway.test", false},
+		{"http://127.0.0.1:11434", true},
+		{"http://[::1]:11434", true},
+		{"https://api.anthropic.com", false},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Bypass(u, noProxy); got != tt.expected {
+			t.Errorf("Bypass(%s) = %v, expected %v", tt.url, got, tt.expected)
+		}
+	}
+	if u, _ := url.Parse("https://anything.test"); !Bypass(u, []string{"*"}) {
+		t.Error("* doesn't bypass the proxy")
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	empty := writePEM(t, "empty.pem")
+	tests := []struct {
+		name    string
+		cfg     config.NetworkConfig
+		wantErr string
+	}{
+		{"bad proxy", config.NetworkConfig{Proxy: "http://"}, "invalid proxy URL"},
+		{"missing CA file", config.NetworkConfig{CACert: filepath.Join(t.TempDir(), "missing.pem")}, "failed to read ca_cert"},
+		{"CA file without certificates", config.NetworkConfig{CACert: empty}, "no PEM certificates"},
+		{"key without certificate", config.NetworkConfig{ClientKey: empty}, "without client_cert"},
+		{"bad client certificate", config.NetworkConfig{ClientCert: empty}, "invalid client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&tt.cfg); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, expected one about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/safety"
+)
+
+// consensusWidth is the width of the side-by-side comparison of commands
+const consensusWidth = 100
+
+// minColumnWidth is the narrowest column of the comparison; with more
+// commands than fit, they are shown one below the other
+const minColumnWidth = 28
+
+// colorCodeRegex matches the ANSI color codes in a string
+var colorCodeRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// DisplayConsensus shows which providers answered and whether they agree.
+// When they disagree, their commands are shown side by side with each one's
+// safety level, and the words that differ highlighted.
+func DisplayConsensus(c *llm.Consensus) {
+	fmt.Println()
+	for _, a := range c.Answers {
+		label := fmt.Sprintf("%s (%s)", a.Provider, a.Model)
+		if a.Err != nil {
+			fmt.Printf("  %s%s%s %s %s%s%s\n", ColorRed, IconCross, ColorReset, label, ColorDim, a.Err, ColorReset)
+			continue
+		}
+		fmt.Printf("  %s%s%s %s %s%s%s\n", ColorGreen, IconCheck, ColorReset, label, ColorDim, FormatDuration(a.Latency.Seconds()), ColorReset)
+	}
+	fmt.Println()
+
+	groups := c.Groups()
+	switch {
+	case c.Agreed():
+		fmt.Println(SuccessMessage(fmt.Sprintf("All %d providers agree", len(groups[0]))))
+		return
+	case len(groups) == 1:
+		fmt.Println(WarningMessage("Only one provider answered, so there is no second opinion"))
+		return
+	}
+
+	fmt.Println(WarningMessage(fmt.Sprintf("The providers disagree: %d different commands", len(groups))))
+	fmt.Println()
+
+	headers := make([]string, len(groups))
+	commands := make([]string, len(groups))
+	for i, group := range groups {
+		var names []string
+		for _, a := range group {
+			names = append(names, fmt.Sprintf("%s (%s)", a.Provider, a.Model))
+		}
+		commands[i] = group[0].Result.Command()
+		level := safety.Analyze(commands[i]).Level
+		headers[i] = fmt.Sprintf("%s %s[%s]%s", strings.Join(names, ", "), safety.GetLevelColor(level), safety.GetLevelName(level), ColorReset)
+	}
+	for _, line := range sideBySide(headers, commands, consensusWidth) {
+		fmt.Println("  " + line)
+	}
+}
+
+// ChooseConsensus displays the answers to a consensus request and prompts the
+// user for an action. When the providers disagree, the user picks one of the
+// commands, and running it needs a stronger confirmation than usual. With a
+// review function, the chosen command is reviewed as in ChooseCommand. It
+// returns the chosen result and the action, or nil if the user cancelled.
+func ChooseConsensus(c *llm.Consensus, review ReviewFunc) (*llm.CommandResult, Action) {
+	DisplayConsensus(c)
+
+	groups := c.Groups()
+	if len(groups) == 1 {
+		chosen := groups[0][0].Result
+		DisplayCommand(chosen.Command())
+		DisplayCommandDetails(chosen.Explanation, chosen.Assumptions, chosen.Placeholders, chosen.Risk)
+		if chosen = reviewResult(chosen, review); chosen == nil {
+			return nil, ActionQuit
+		}
+		return chosen, promptActionForCommand(chosen.Command(), false, !c.Agreed())
+	}
+
+	items := make([]candidateItem, len(groups))
+	for i, group := range groups {
+		answer := group[0]
+		explanation := fmt.Sprintf("%s (%s)", answer.Provider, answer.Model)
+		if answer.Result.Explanation != "" {
+			explanation += ": " + answer.Result.Explanation
+		}
+		items[i] = newCandidateItem(i+1, answer.Result.Command(), explanation)
+	}
+
+	for {
+		fmt.Println()
+		idx := promptCandidates(items, "Pick a command:")
+		if idx < 0 {
+			return nil, ActionQuit
+		}
+
+		chosen := groups[idx][0].Result
+		DisplayCommand(chosen.Command())
+		DisplayCommandDetails(chosen.Explanation, chosen.Assumptions, chosen.Placeholders, chosen.Risk)
+		if chosen = reviewResult(chosen, review); chosen == nil {
+			return nil, ActionQuit
+		}
+
+		if action := promptActionForCommand(chosen.Command(), true, true); action != ActionAlternatives {
+			return chosen, action
+		}
+	}
+}
+
+// cell is a line of a column in the comparison, with its width without colors
+type cell struct {
+	text  string
+	width int
+}
+
+// sideBySide lays out commands in columns under their headers, highlighting
+// the words of each command that the others don't all contain. When the
+// columns would be narrower than minColumnWidth, the commands are shown one
+// below the other instead.
+func sideBySide(headers, commands []string, width int) []string {
+	const separator = " │ "
+	n := len(commands)
+	columnWidth := (width - len(separator)*(n-1)) / n
+	if columnWidth < minColumnWidth {
+		var lines []string
+		for i, command := range commands {
+			lines = append(lines, headers[i])
+			for _, c := range wrapWords(command, differingWords(commands, i), width) {
+				lines = append(lines, "  "+c.text)
+			}
+		}
+		return lines
+	}
+
+	columns := make([][]cell, n)
+	rows := 0
+	for i, command := range commands {
+		header := cell{text: headers[i], width: utf8.RuneCountInString(colorCodeRegex.ReplaceAllString(headers[i], ""))}
+		rule := cell{text: ColorDim + strings.Repeat("─", columnWidth) + ColorReset, width: columnWidth}
+		columns[i] = append([]cell{header, rule}, wrapWords(command, differingWords(commands, i), columnWidth)...)
+		if len(columns[i]) > rows {
+			rows = len(columns[i])
+		}
+	}
+
+	lines := make([]string, rows)
+	for row := range lines {
+		parts := make([]string, n)
+		for i, column := range columns {
+			c := cell{}
+			if row < len(column) {
+				c = column[row]
+			}
+			parts[i] = c.text
+			if i < n-1 {
+				parts[i] += strings.Repeat(" ", max(columnWidth-c.width, 0))
+			}
+		}
+		lines[row] = strings.TrimRight(strings.Join(parts, separator), " ")
+	}
+	return lines
+}
+
+// differingWords returns the words of commands[i] that are missing from at
+// least one of the other commands
+func differingWords(commands []string, i int) map[string]bool {
+	differing := map[string]bool{}
+	for _, word := range strings.Fields(commands[i]) {
+		for j, other := range commands {
+			if j != i && !containsWord(other, word) {
+				differing[word] = true
+				break
+			}
+		}
+	}
+	return differing
+}
+
+// containsWord reports whether a command contains a word
+func containsWord(command, word string) bool {
+	for _, w := range strings.Fields(command) {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapWords wraps a command to the given width, keeping its line breaks and
+// highlighting the given words. Words longer than the width are split.
+func wrapWords(command string, highlight map[string]bool, width int) []cell {
+	var cells []cell
+	for _, line := range strings.Split(command, "\n") {
+		current := cell{}
+		for _, word := range strings.Fields(line) {
+			marked := highlight[word]
+			runes := []rune(word)
+			for len(runes) > width {
+				if current.width > 0 {
+					cells = append(cells, current)
+					current = cell{}
+				}
+				cells = append(cells, cell{text: markWord(string(runes[:width]), marked), width: width})
+				runes = runes[width:]
+			}
+
+			if current.width > 0 && current.width+1+len(runes) > width {
+				cells = append(cells, current)
+				current = cell{}
+			}
+			if current.width > 0 {
+				current.text += " "
+				current.width++
+			}
+			current.text += markWord(string(runes), marked)
+			current.width += len(runes)
+		}
+		if current.width > 0 {
+			cells = append(cells, current)
+		}
+	}
+	return cells
+}
+
+// markWord highlights a word that differs between commands
+func markWord(word string, marked bool) string {
+	if !marked {
+		return word
+	}
+	return ColorBold + ColorYellow + word + ColorReset
+}
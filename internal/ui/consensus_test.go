@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDifferingWords(t *testing.T) {
+	commands := []string{
+		`find . -name "*.tmp" -delete`,
+		`find . -name "*.tmp" -exec rm {} +`,
+	}
+	differing := differingWords(commands, 0)
+	if !differing["-delete"] || differing["find"] || differing[`"*.tmp"`] {
+		t.Errorf("differing words of the first command = %v", differing)
+	}
+	if differing := differingWords(commands, 1); !differing["-exec"] || !differing["rm"] || differing["-name"] {
+		t.Errorf("differing words of the second command = %v", differing)
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	headers := []string{"openai " + ColorGreen + "[Safe]" + ColorReset, "anthropic [Dangerous]"}
+	commands := []string{
+		"find . -name '*.tmp' -delete",
+		"rm -rf ./build/tmp/cache/a-very-long-directory-name-that-needs-wrapping",
+	}
+
+	lines := sideBySide(headers, commands, 80)
+	if len(lines) < 4 {
+		t.Fatalf("expected a header, a rule and wrapped commands, got %q", lines)
+	}
+	for _, line := range lines {
+		if width := utf8.RuneCountInString(colorCodeRegex.ReplaceAllString(line, "")); width > 80 {
+			t.Errorf("line is %d columns wide: %q", width, line)
+		}
+	}
+	// The second column starts at the same place on every line
+	column := func(line string) int {
+		plain := colorCodeRegex.ReplaceAllString(line, "")
+		return utf8.RuneCountInString(plain[:strings.Index(plain, "│")])
+	}
+	for _, line := range lines[1:] {
+		if column(line) != column(lines[0]) {
+			t.Errorf("separator at column %d, expected %d: %q", column(line), column(lines[0]), line)
+		}
+	}
+	if !strings.Contains(lines[2], ColorYellow+"-delete") {
+		t.Errorf("expected -delete to be highlighted: %q", lines[2])
+	}
+
+	// Too many commands for columns are stacked
+	stacked := sideBySide([]string{"a", "b", "c", "d"}, []string{"ls", "ls -a", "ls -l", "dir"}, 80)
+	if len(stacked) != 8 || stacked[0] != "a" || !strings.HasPrefix(stacked[1], "  ") {
+		t.Errorf("stacked layout = %q", stacked)
+	}
+}
@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdHeading = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	mdBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdCode    = regexp.MustCompile("`([^`]+)`")
+	mdBold    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+)
+
+// MarkdownRenderer renders the simple markdown used in LLM explanations to
+// the terminal. Text can be written in arbitrary chunks as it streams in;
+// each line is rendered once it is complete.
+type MarkdownRenderer struct {
+	w           io.Writer
+	indent      string
+	highlighter *Highlighter
+	pending     string
+	inCode      bool
+}
+
+// NewMarkdownRenderer creates a renderer that writes lines to w, prefixed with indent
+func NewMarkdownRenderer(w io.Writer, indent string) *MarkdownRenderer {
+	return &MarkdownRenderer{w: w, indent: indent, highlighter: NewHighlighter()}
+}
+
+// Write renders every complete line in chunk, buffering the rest
+func (r *MarkdownRenderer) Write(chunk string) {
+	r.pending += chunk
+	for {
+		i := strings.IndexByte(r.pending, '\n')
+		if i < 0 {
+			return
+		}
+		r.renderLine(r.pending[:i])
+		r.pending = r.pending[i+1:]
+	}
+}
+
+// Flush renders any remaining partial line
+func (r *MarkdownRenderer) Flush() {
+	if r.pending != "" {
+		r.renderLine(r.pending)
+		r.pending = ""
+	}
+}
+
+// renderLine writes one rendered line
+func (r *MarkdownRenderer) renderLine(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.HasPrefix(strings.TrimSpace(line), "```") {
+		r.inCode = !r.inCode
+		return
+	}
+	if r.inCode {
+		fmt.Fprintf(r.w, "%s    %s\n", r.indent, r.highlighter.Highlight(line))
+		return
+	}
+	if strings.TrimSpace(line) == "" {
+		fmt.Fprintln(r.w)
+		return
+	}
+	fmt.Fprintf(r.w, "%s%s\n", r.indent, RenderMarkdownLine(line))
+}
+
+// RenderMarkdownLine renders headings, bullets, inline code and bold text in
+// a single line of markdown
+func RenderMarkdownLine(line string) string {
+	if m := mdHeading.FindStringSubmatch(line); m != nil {
+		return ColorBold + ColorCyan + m[1] + ColorReset
+	}
+
+	prefix := ""
+	if m := mdBullet.FindStringSubmatch(line); m != nil {
+		prefix, line = m[1]+"• ", m[2]
+	}
+	line = mdCode.ReplaceAllString(line, ColorGreen+"$1"+ColorReset)
+	line = mdBold.ReplaceAllString(line, ColorBold+"$1"+ColorReset)
+	return prefix + line
+}
+
+// RenderMarkdown renders a complete markdown text to w, prefixing each line with indent
+func RenderMarkdown(w io.Writer, text, indent string) {
+	r := NewMarkdownRenderer(w, indent)
+	r.Write(text)
+	r.Flush()
+}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"## Options", ColorBold + ColorCyan + "Options" + ColorReset},
+		{"- removes files", "• removes files"},
+		{"  * nested", "  • nested"},
+		{"runs `ls -la`", "runs " + ColorGreen + "ls -la" + ColorReset},
+		{"**Warning**: deletes", ColorBold + "Warning" + ColorReset + ": deletes"},
+	}
+
+	for _, tt := range tests {
+		if got := RenderMarkdownLine(tt.line); got != tt.expected {
+			t.Errorf("RenderMarkdownLine(%q) = %q, expected %q", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestMarkdownRendererChunks(t *testing.T) {
+	var out strings.Builder
+	r := NewMarkdownRenderer(&out, "  ")
+	for _, chunk := range []string{"First ", "line\n\n- it", "em\n```\n", "echo\n```\nlast"} {
+		r.Write(chunk)
+	}
+	if strings.Contains(out.String(), "last") {
+		t.Error("partial line rendered before Flush")
+	}
+	r.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("rendered %d lines, expected 5: %q", len(lines), out.String())
+	}
+	if lines[0] != "  First line" || lines[1] != "" || lines[2] != "  • item" || lines[4] != "  last" {
+		t.Errorf("rendered %q", lines)
+	}
+	if !strings.HasPrefix(lines[3], "      ") || strings.Contains(lines[3], "```") {
+		t.Errorf("code line rendered as %q", lines[3])
+	}
+}
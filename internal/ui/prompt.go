@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Hermithic/aiask/internal/llm"
 	"github.com/Hermithic/aiask/internal/safety"
 	"github.com/Hermithic/aiask/internal/shell"
 	"github.com/Hermithic/aiask/internal/undo"
@@ -25,6 +26,7 @@ const (
 	ActionEdit
 	ActionReprompt
 	ActionQuit
+	ActionAlternatives
 )
 
 // Colors for terminal output
@@ -64,6 +66,27 @@ func DisplayCommand(command string) {
 	}
 }
 
+// DisplayCommandDetails shows the model's explanation, assumptions and placeholders for a command
+func DisplayCommandDetails(explanation string, assumptions, placeholders []string, risk string) {
+	if explanation == "" && len(assumptions) == 0 && len(placeholders) == 0 && risk != "high" {
+		return
+	}
+
+	if explanation != "" {
+		fmt.Printf("%s%s %s%s\n", ColorDim, IconInfo, explanation, ColorReset)
+	}
+	for _, assumption := range assumptions {
+		fmt.Printf("%s  Assumes: %s%s\n", ColorDim, assumption, ColorReset)
+	}
+	if len(placeholders) > 0 {
+		fmt.Printf("%s%s Replace before running: %s%s\n", ColorYellow, IconEdit, strings.Join(placeholders, ", "), ColorReset)
+	}
+	if risk == "high" {
+		fmt.Printf("%s%s The model rates this command as high risk%s\n", ColorYellow, IconWarning, ColorReset)
+	}
+	fmt.Println()
+}
+
 // actionItem represents a selectable action in the menu
 type actionItem struct {
 	Label  string
@@ -74,13 +97,23 @@ type actionItem struct {
 
 // PromptAction prompts the user for an action using an interactive menu
 func PromptAction() Action {
+	return promptAction(false)
+}
+
+// promptAction shows the action menu, optionally offering to go back to the alternatives
+func promptAction(withAlternatives bool) Action {
 	items := []actionItem{
 		{Label: "Execute", Action: ActionExecute, Icon: IconRocket, Key: "e"},
 		{Label: "Copy to clipboard", Action: ActionCopy, Icon: IconCopy, Key: "c"},
 		{Label: "Edit command", Action: ActionEdit, Icon: IconEdit, Key: "d"},
-		{Label: "New prompt", Action: ActionReprompt, Icon: IconRefresh, Key: "r"},
-		{Label: "Quit", Action: ActionQuit, Icon: IconExit, Key: "q"},
 	}
+	if withAlternatives {
+		items = append(items, actionItem{Label: "Other alternatives", Action: ActionAlternatives, Icon: IconArrow, Key: "a"})
+	}
+	items = append(items,
+		actionItem{Label: "New prompt", Action: ActionReprompt, Icon: IconRefresh, Key: "r"},
+		actionItem{Label: "Quit", Action: ActionQuit, Icon: IconExit, Key: "q"},
+	)
 
 	templates := &promptui.SelectTemplates{
 		Label:    "{{ . }}",
@@ -102,7 +135,7 @@ func PromptAction() Action {
 		Label:     fmt.Sprintf("%sWhat would you like to do?%s", ColorBold, ColorReset),
 		Items:     items,
 		Templates: templates,
-		Size:      5,
+		Size:      len(items),
 		Searcher:  searcher,
 		// Start with cursor at position 0 so the user can press enter to execute immediately
 		CursorPos:    0,
@@ -117,19 +150,23 @@ func PromptAction() Action {
 			return ActionQuit
 		}
 		// Fallback to text-based prompt if interactive mode fails
-		return promptActionFallback()
+		return promptActionFallback(withAlternatives)
 	}
 
 	return items[idx].Action
 }
 
 // promptActionFallback provides text-based input as a fallback
-func promptActionFallback() Action {
+func promptActionFallback(withAlternatives bool) Action {
 	fmt.Printf("%sWhat would you like to do?%s\n", ColorBold, ColorReset)
-	fmt.Printf("  [%se%s]xecute  |  [%sc%s]opy  |  e[%sd%s]it  |  [%sr%s]e-prompt  |  [%sq%s]uit\n",
-		ColorYellow, ColorReset,
+	fmt.Printf("  [%se%s]xecute  |  [%sc%s]opy  |  e[%sd%s]it  |  ",
 		ColorYellow, ColorReset,
 		ColorYellow, ColorReset,
+		ColorYellow, ColorReset)
+	if withAlternatives {
+		fmt.Printf("[%sa%s]lternatives  |  ", ColorYellow, ColorReset)
+	}
+	fmt.Printf("[%sr%s]e-prompt  |  [%sq%s]uit\n",
 		ColorYellow, ColorReset,
 		ColorYellow, ColorReset)
 	fmt.Print("> ")
@@ -149,6 +186,12 @@ func promptActionFallback() Action {
 		return ActionCopy
 	case "d", "edit":
 		return ActionEdit
+	case "a", "alternatives":
+		if withAlternatives {
+			return ActionAlternatives
+		}
+		fmt.Printf("%sInvalid option. Please try again.%s\n", ColorDim, ColorReset)
+		return promptActionFallback(withAlternatives)
 	case "r", "re-prompt", "reprompt":
 		return ActionReprompt
 	case "q", "quit", "exit":
@@ -159,32 +202,189 @@ func promptActionFallback() Action {
 			return ActionExecute
 		}
 		fmt.Printf("%sInvalid option. Please try again.%s\n", ColorDim, ColorReset)
-		return promptActionFallback()
+		return promptActionFallback(withAlternatives)
 	}
 }
 
 // PromptActionForCommand prompts the user for an action, with safety checks for the command
 func PromptActionForCommand(command string) Action {
-	action := PromptAction()
+	return promptActionForCommand(command, false, false)
+}
+
+// promptActionForCommand prompts for an action with safety checks, optionally
+// offering to go back to the alternatives. Disputed commands need a stronger
+// confirmation.
+func promptActionForCommand(command string, withAlternatives, disputed bool) Action {
+	action := promptAction(withAlternatives)
 
 	// If executing a dangerous command, require explicit confirmation
-	if action == ActionExecute && safety.RequiresConfirmation(command) {
-		fmt.Printf("%s%sThis is a potentially dangerous command. Type 'yes' to confirm: %s", ColorBold, ColorRed, ColorReset)
+	if action == ActionExecute && !confirmExecution(command, disputed) {
+		return ActionQuit
+	}
 
-		reader := bufio.NewReader(os.Stdin)
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			return ActionQuit
+	return action
+}
+
+// confirmExecution asks the user to type the confirmation the command needs,
+// if any, and reports whether they did
+func confirmExecution(command string, disputed bool) bool {
+	phrase := safety.ConfirmationPhrase(command, disputed)
+	if phrase == "" {
+		return true
+	}
+
+	reason := "This is a potentially dangerous command."
+	if disputed && safety.RequiresConfirmation(command) {
+		reason = "The providers disagree and this is a potentially dangerous command."
+	} else if disputed {
+		reason = "The providers disagree on this command."
+	}
+	fmt.Printf("%s%s%s Type '%s' to confirm: %s", ColorBold, ColorRed, reason, phrase, ColorReset)
+
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	input = strings.TrimSpace(strings.ToLower(input))
+	if input != phrase {
+		fmt.Printf("%sExecution cancelled.%s\n", ColorYellow, ColorReset)
+		return false
+	}
+	return true
+}
+
+// ChooseCommand displays a generated command and prompts the user for an action.
+// When the result has alternatives, the user first picks one of the candidates
+// and can return to the list from the action menu. With a review function, the
+// command is reviewed before the action menu and the user may switch to the
+// corrected version. It returns the chosen candidate and the action, or nil if
+// the user cancelled the selection.
+func ChooseCommand(result *llm.CommandResult, review ReviewFunc) (*llm.CommandResult, Action) {
+	candidates := result.Candidates()
+	if len(candidates) == 1 {
+		DisplayCommand(result.Command())
+		DisplayCommandDetails(result.Explanation, result.Assumptions, result.Placeholders, result.Risk)
+		if result = reviewResult(result, review); result == nil {
+			return nil, ActionQuit
 		}
+		return result, PromptActionForCommand(result.Command())
+	}
 
-		input = strings.TrimSpace(strings.ToLower(input))
-		if input != "yes" {
-			fmt.Printf("%sExecution cancelled.%s\n", ColorYellow, ColorReset)
-			return ActionQuit
+	for {
+		idx := PromptCandidate(candidates)
+		if idx < 0 {
+			return nil, ActionQuit
+		}
+
+		chosen := &candidates[idx]
+		DisplayCommand(chosen.Command())
+		DisplayCommandDetails(chosen.Explanation, chosen.Assumptions, chosen.Placeholders, chosen.Risk)
+		if chosen = reviewResult(chosen, review); chosen == nil {
+			return nil, ActionQuit
+		}
+
+		if action := promptActionForCommand(chosen.Command(), true, false); action != ActionAlternatives {
+			return chosen, action
 		}
 	}
+}
 
-	return action
+// candidateItem represents a selectable candidate command in the alternatives menu
+type candidateItem struct {
+	Number      int
+	Preview     string
+	Level       string
+	Explanation string
+}
+
+// PromptCandidate lets the user pick one of several candidate commands, each
+// shown with its safety level. It returns the index of the chosen candidate,
+// or -1 if the user cancelled.
+func PromptCandidate(candidates []llm.CommandResult) int {
+	items := make([]candidateItem, len(candidates))
+	for i, candidate := range candidates {
+		items[i] = newCandidateItem(i+1, candidate.Command(), candidate.Explanation)
+	}
+	return promptCandidates(items, fmt.Sprintf("%d alternatives — pick one:", len(items)))
+}
+
+// newCandidateItem creates a menu entry for a candidate command
+func newCandidateItem(number int, command, explanation string) candidateItem {
+	level := safety.Analyze(command).Level
+
+	preview := strings.ReplaceAll(command, "\n", " && ")
+	if runes := []rune(preview); len(runes) > 70 {
+		preview = string(runes[:67]) + "..."
+	}
+
+	return candidateItem{
+		Number:      number,
+		Preview:     preview,
+		Level:       fmt.Sprintf("%s[%s]%s", safety.GetLevelColor(level), safety.GetLevelName(level), ColorReset),
+		Explanation: explanation,
+	}
+}
+
+// promptCandidates shows a menu of candidate commands under a label
+func promptCandidates(items []candidateItem, label string) int {
+	fmt.Println()
+	templates := &promptui.SelectTemplates{
+		Label:    "{{ . }}",
+		Active:   fmt.Sprintf("%s%s {{ .Number }}. {{ .Preview | cyan | bold }}%s {{ .Level }}", ColorCyan, IconArrow, ColorReset),
+		Inactive: "  {{ .Number }}. {{ .Preview }} {{ .Level }}",
+		Selected: fmt.Sprintf("%s%s {{ .Number }}. {{ .Preview }}%s", ColorGreen, IconCheck, ColorReset),
+		Details:  fmt.Sprintf("{{ if .Explanation }}%s  {{ .Explanation }}%s{{ end }}", ColorDim, ColorReset),
+	}
+
+	prompt := promptui.Select{
+		Label:     fmt.Sprintf("%s%s %s%s", ColorBold, IconTerminal, label, ColorReset),
+		Items:     items,
+		Templates: templates,
+		Size:      len(items),
+		HideHelp:  true,
+	}
+
+	idx, _, err := prompt.Run()
+	if err != nil {
+		if err == promptui.ErrInterrupt {
+			return -1
+		}
+		return promptCandidateFallback(items, label)
+	}
+
+	return idx
+}
+
+// promptCandidateFallback provides text-based candidate selection as a fallback
+func promptCandidateFallback(items []candidateItem, label string) int {
+	fmt.Printf("%s%s%s\n", ColorBold, label, ColorReset)
+	for _, item := range items {
+		fmt.Printf("  [%s%d%s] %s %s\n", ColorYellow, item.Number, ColorReset, item.Preview, item.Level)
+	}
+	fmt.Printf("Choose [1-%d], or q to quit: ", len(items))
+
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return -1
+	}
+
+	input = strings.TrimSpace(strings.ToLower(input))
+	if input == "" {
+		return 0
+	}
+	if input == "q" || input == "quit" {
+		return -1
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(input, "%d", &n); err != nil || n < 1 || n > len(items) {
+		fmt.Printf("%sInvalid option. Please try again.%s\n", ColorDim, ColorReset)
+		return promptCandidateFallback(items, label)
+	}
+	return n - 1
 }
 
 // PromptEdit prompts the user to edit the command
@@ -253,6 +453,12 @@ func CopyToClipboard(command string) error {
 	return nil
 }
 
+// ClipboardAvailable reports whether a clipboard backend was found, such as
+// xclip, xsel or wl-copy on Linux
+func ClipboardAvailable() bool {
+	return !clipboard.Unsupported
+}
+
 // ExecuteCommand executes the command in the current shell
 func ExecuteCommand(command string, shellInfo shell.ShellInfo) error {
 	var cmd *exec.Cmd
@@ -266,7 +472,7 @@ func ExecuteCommand(command string, shellInfo shell.ShellInfo) error {
 		}
 	default:
 		// Unix-like systems - use dynamic shell path detection
-		shellPath := getShellPath(shellInfo.Shell)
+		shellPath := ShellPath(shellInfo.Shell)
 		cmd = exec.Command(shellPath, "-c", command)
 	}
 
@@ -345,8 +551,8 @@ func ShowSpinner(message string) func() {
 	}
 }
 
-// getShellPath returns the path to the shell executable using dynamic detection
-func getShellPath(shellType shell.ShellType) string {
+// ShellPath returns the path to the shell executable using dynamic detection
+func ShellPath(shellType shell.ShellType) string {
 	// First, try to use the $SHELL environment variable if it matches the detected shell
 	envShell := os.Getenv("SHELL")
 	if envShell != "" {
@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/Hermithic/aiask/internal/llm"
+)
+
+// ReviewFunc reviews a command in a second pass before the user acts on it
+type ReviewFunc func(command string) (*llm.Review, error)
+
+// DisplayReview shows the issues a review found in a command and the
+// corrected command, if the review proposes one
+func DisplayReview(review *llm.Review, original string) {
+	if len(review.Issues) == 0 && !review.Corrects(original) {
+		fmt.Println(SuccessMessage("Review found no issues"))
+		fmt.Println()
+		return
+	}
+
+	fmt.Println(WarningMessage("Review notes:"))
+	for _, issue := range review.Issues {
+		fmt.Printf("  %s-%s %s\n", ColorYellow, ColorReset, issue)
+	}
+	if review.Corrects(original) {
+		fmt.Println()
+		fmt.Printf("%s%s%s Corrected command:%s\n", ColorBold, ColorGreen, IconTerminal, ColorReset)
+		highlighter := NewHighlighter()
+		for _, command := range review.Commands {
+			fmt.Printf("  %s\n", highlighter.Highlight(command))
+		}
+	}
+	fmt.Println()
+}
+
+// reviewResult reviews the command of a result and shows the review. When
+// the review corrects the command, the user picks the original or the
+// corrected version. It returns the chosen result, or nil if the user
+// cancelled.
+func reviewResult(result *llm.CommandResult, review ReviewFunc) *llm.CommandResult {
+	if review == nil {
+		return result
+	}
+
+	original := result.Command()
+	r, err := review(original)
+	if err != nil {
+		fmt.Printf("%s%s Review failed: %s%s\n\n", ColorDim, IconWarning, err, ColorReset)
+		return result
+	}
+	DisplayReview(r, original)
+	if !r.Corrects(original) {
+		return result
+	}
+
+	items := []candidateItem{
+		newCandidateItem(1, r.Command(), "Corrected by the review"),
+		newCandidateItem(2, original, "Original"),
+	}
+	switch promptCandidates(items, "Which command do you want to use?") {
+	case 0:
+		// The explanation and risk of the original describe another command
+		corrected := *result
+		corrected.Commands = r.Commands
+		corrected.Explanation = r.Explanation
+		corrected.Risk = r.Risk
+		DisplayCommand(corrected.Command())
+		DisplayCommandDetails(corrected.Explanation, corrected.Assumptions, corrected.Placeholders, corrected.Risk)
+		return &corrected
+	case 1:
+		return result
+	default:
+		return nil
+	}
+}
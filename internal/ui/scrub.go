@@ -0,0 +1,15 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/Hermithic/aiask/internal/llm"
+	"github.com/Hermithic/aiask/internal/scrub"
+)
+
+// ShowMasked notes the secrets that were masked before a request was sent
+func ShowMasked(report *llm.ScrubReport) {
+	if matches := report.Matches(); len(matches) > 0 {
+		fmt.Println(InfoMessage("Masked " + scrub.Summary(matches) + " before sending"))
+	}
+}
@@ -35,10 +35,12 @@ type CheckResult struct {
 	ReleaseNotes    string
 }
 
-// CheckForUpdates checks if a newer version is available
-func CheckForUpdates(currentVersion string) (*CheckResult, error) {
+// CheckForUpdates checks if a newer version is available. Requests go
+// through base, or http.DefaultTransport if it is nil.
+func CheckForUpdates(currentVersion string, base http.RoundTripper) (*CheckResult, error) {
 	client := &http.Client{
-		Timeout: CheckTimeout,
+		Transport: base,
+		Timeout:   CheckTimeout,
 	}
 
 	req, err := http.NewRequest("GET", GitHubReleaseURL, nil)
@@ -77,9 +79,9 @@ func CheckForUpdates(currentVersion string) (*CheckResult, error) {
 }
 
 // CheckForUpdatesAsync checks for updates in the background
-func CheckForUpdatesAsync(currentVersion string, callback func(*CheckResult)) {
+func CheckForUpdatesAsync(currentVersion string, base http.RoundTripper, callback func(*CheckResult)) {
 	go func() {
-		result, err := CheckForUpdates(currentVersion)
+		result, err := CheckForUpdates(currentVersion, base)
 		if err == nil && result != nil {
 			callback(result)
 		}
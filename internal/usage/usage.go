@@ -0,0 +1,170 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+// Types of provider calls
+const (
+	TypeGenerate = "generate"
+	TypeExplain  = "explain"
+	TypeRecovery = "recovery"
+	TypeReview   = "review"
+)
+
+// Record is a single provider call in the usage log
+type Record struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+	LatencyMs    int64     `json:"latency_ms"`
+}
+
+// Row is one line of a usage summary
+type Row struct {
+	Key          string  `json:"key"`
+	Calls        int     `json:"calls"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+	Cost         float64 `json:"cost,omitempty"`     // Estimated cost in USD of the priced calls
+	Unpriced     int     `json:"unpriced,omitempty"` // Calls without a price in the config
+}
+
+// GetUsagePath returns the path to the usage log
+func GetUsagePath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "usage.jsonl"), nil
+}
+
+// Append adds a record to the usage log. The log is append-only JSON Lines,
+// so concurrent aiask processes don't overwrite each other's records.
+func Append(record Record) error {
+	usagePath, err := GetUsagePath()
+	if err != nil {
+		return err
+	}
+
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(usagePath), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	f, err := os.OpenFile(usagePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage log: %w", err)
+	}
+	return nil
+}
+
+// Load reads the usage records made at or after since. Malformed lines are skipped.
+func Load(since time.Time) ([]Record, error) {
+	usagePath, err := GetUsagePath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(usagePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if json.Unmarshal(scanner.Bytes(), &record) != nil {
+			continue
+		}
+		if !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	return records, nil
+}
+
+// Grouping functions for Summarize
+var (
+	ByDay      = func(r Record) string { return r.Time.Local().Format("2006-01-02") }
+	ByProvider = func(r Record) string { return r.Provider }
+	ByModel    = func(r Record) string { return r.Model }
+	ByType     = func(r Record) string { return r.Type }
+)
+
+// Summarize groups records by key and totals their tokens, latency and
+// estimated cost, sorted by key
+func Summarize(records []Record, key func(Record) string, prices map[string]config.Price) []Row {
+	rows := map[string]*Row{}
+	latency := map[string]int64{}
+	for _, r := range records {
+		k := key(r)
+		row, ok := rows[k]
+		if !ok {
+			row = &Row{Key: k}
+			rows[k] = row
+		}
+		row.Calls++
+		row.InputTokens += r.InputTokens
+		row.OutputTokens += r.OutputTokens
+		latency[k] += r.LatencyMs
+
+		if cost, ok := Cost(r, prices); ok {
+			row.Cost += cost
+		} else {
+			row.Unpriced++
+		}
+	}
+
+	result := make([]Row, 0, len(rows))
+	for k, row := range rows {
+		row.AvgLatencyMs = latency[k] / int64(row.Calls)
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// Cost estimates the cost of a record in USD from the price table, which is
+// keyed by "provider/model" or by model name
+func Cost(r Record, prices map[string]config.Price) (float64, bool) {
+	price, ok := prices[r.Provider+"/"+r.Model]
+	if !ok {
+		price, ok = prices[r.Model]
+	}
+	if !ok {
+		return 0, false
+	}
+	return (float64(r.InputTokens)*price.Input + float64(r.OutputTokens)*price.Output) / 1e6, true
+}
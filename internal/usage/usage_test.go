@@ -0,0 +1,78 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hermithic/aiask/internal/config"
+)
+
+func TestSummarize(t *testing.T) {
+	records := []Record{
+		{Type: TypeGenerate, Provider: "openai", Model: "gpt-4o", InputTokens: 1000, OutputTokens: 100, LatencyMs: 400},
+		{Type: TypeExplain, Provider: "openai", Model: "gpt-4o", InputTokens: 2000, OutputTokens: 300, LatencyMs: 800},
+		{Type: TypeGenerate, Provider: "ollama", Model: "llama3.2", InputTokens: 500, OutputTokens: 50, LatencyMs: 1200},
+	}
+	prices := map[string]config.Price{"gpt-4o": {Input: 2.5, Output: 10}}
+
+	rows := Summarize(records, ByProvider, prices)
+	if len(rows) != 2 || rows[0].Key != "ollama" || rows[1].Key != "openai" {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+
+	openai := rows[1]
+	if openai.Calls != 2 || openai.InputTokens != 3000 || openai.OutputTokens != 400 || openai.AvgLatencyMs != 600 {
+		t.Errorf("unexpected openai row: %+v", openai)
+	}
+	if expected := (3000*2.5 + 400*10) / 1e6; math.Abs(openai.Cost-expected) > 1e-12 {
+		t.Errorf("openai cost = %v, expected %v", openai.Cost, expected)
+	}
+	if rows[0].Unpriced != 1 || rows[0].Cost != 0 {
+		t.Errorf("ollama should be unpriced: %+v", rows[0])
+	}
+}
+
+func TestCostPrefersProviderModel(t *testing.T) {
+	prices := map[string]config.Price{
+		"gpt-4o":      {Input: 1, Output: 1},
+		"grok/gpt-4o": {Input: 2, Output: 2},
+	}
+	cost, ok := Cost(Record{Provider: "grok", Model: "gpt-4o", InputTokens: 1e6}, prices)
+	if !ok || cost != 2 {
+		t.Errorf("Cost = %v, %v; expected 2, true", cost, ok)
+	}
+}
+
+func TestAppendLoad(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	old := Record{Time: time.Now().AddDate(0, 0, -40), Type: TypeGenerate, Provider: "openai", Model: "gpt-4o"}
+	recent := Record{Type: TypeExplain, Provider: "anthropic", Model: "claude", InputTokens: 10}
+	for _, r := range []Record{old, recent} {
+		if err := Append(r); err != nil {
+			t.Fatalf("Append returned error: %v", err)
+		}
+	}
+
+	// Malformed lines are skipped
+	path := filepath.Join(home, ".aiask", "usage.jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not json\n")
+	f.Close()
+
+	records, err := Load(time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(records) != 1 || records[0].Provider != "anthropic" || records[0].Time.IsZero() {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}